@@ -56,17 +56,22 @@ import (
 	"github.com/inspektor-gadget/inspektor-gadget/gadget-container/entrypoint"
 	// Blank import for some operators
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/btfgen"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/cgroupresolver"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/ebpf"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/exepathresolver"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/filter"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/formatters"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/geoipresolver"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/hostnameannotator"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/kubeipresolver"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/kubemanager"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/limiter"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/otel-logs"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/otel-metrics"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/reversednsresolver"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/socketenricher"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/sort"
-	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/uidgidresolver"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators/uidgidresolver"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/ustack"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/operators/wasm"
 
@@ -415,6 +420,24 @@ func main() {
 			}
 		}()
 
+		// SIGUSR1 logs the uids and gids known by the resolver, to debug
+		// wrong names, and SIGHUP makes it re-read the passwd and group
+		// files
+		cacheSignal := make(chan os.Signal, 1)
+		signal.Notify(cacheSignal, syscall.SIGUSR1, syscall.SIGHUP)
+		go func() {
+			for sig := range cacheSignal {
+				cache := uidgidresolver.GetUserGroupCache()
+				if sig == syscall.SIGUSR1 {
+					cache.LogDump()
+					continue
+				}
+				if err := cache.Reload(); err != nil {
+					log.Warnf("Reloading the users and groups: %v", err)
+				}
+			}
+		}()
+
 		exitSignal := make(chan os.Signal, 1)
 		signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
 		<-exitSignal
@@ -38,7 +38,9 @@ import (
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/block-io/tracer"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/ebpf/tracer"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/file/tracer"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp-sockets/tracer"
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/tracer"
+	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/udp/tracer"
 
 	// Trace Category
 	_ "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/trace/bind/tracer"
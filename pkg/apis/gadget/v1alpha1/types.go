@@ -38,6 +38,41 @@ const (
 	// OperationDelete indicates we want to delete a resource which is owned by a
 	// trace. At the moment, this is only used by traceloop.
 	OperationDelete Operation = "delete"
+	// OperationColumns indicates to report the description of the columns
+	// of the gadget output. At the moment, this is only used by tcptop.
+	OperationColumns Operation = "columns"
+	// OperationHistory indicates to report the last results of the gadget,
+	// kept in memory. At the moment, this is only used by tcptop.
+	OperationHistory Operation = "history"
+	// OperationValidate indicates to check the parameters of the trace
+	// without starting it. At the moment, this is only used by tcptop.
+	OperationValidate Operation = "validate"
+	// OperationUpdate indicates to apply the parameters of the trace to the
+	// running gadget without restarting it. At the moment, this is only used
+	// by tcptop.
+	OperationUpdate Operation = "update"
+	// OperationReset indicates to reset the counters of the running gadget
+	// without restarting it. At the moment, this is only used by tcptop.
+	OperationReset Operation = "reset"
+)
+
+// OperationErrorCode classifies the OperationError of a Trace, so that it can
+// be handled programmatically
+type OperationErrorCode string
+
+const (
+	// OperationErrorCodeBadParam indicates that a parameter of the trace is
+	// invalid
+	OperationErrorCodeBadParam OperationErrorCode = "bad-param"
+	// OperationErrorCodeEBPFLoad indicates that the eBPF programs or maps of
+	// the gadget couldn't be loaded, e.g. because the kernel doesn't support
+	// them
+	OperationErrorCodeEBPFLoad OperationErrorCode = "ebpf-load"
+	// OperationErrorCodePermission indicates that the gadget lacks the
+	// privileges it requires
+	OperationErrorCodePermission OperationErrorCode = "permission"
+	// OperationErrorCodeInternal is used for the other errors
+	OperationErrorCodeInternal OperationErrorCode = "internal"
 )
 
 // RunMode defines running mode for the Trace
@@ -151,6 +186,10 @@ type TraceStatus struct {
 	// annotation gadget.kinvolk.io/operation=
 	OperationError string `json:"operationError,omitempty"`
 
+	// OperationErrorCode classifies the OperationError. It's only set by the
+	// gadgets supporting it, at the moment tcptop when starting.
+	OperationErrorCode OperationErrorCode `json:"operationErrorCode,omitempty"`
+
 	// OperationWarning is returned by the gadget to notify about a malfunction
 	// when applying the annotation gadget.kinvolk.io/operation=. Unlike the
 	// OperationError that represents a fatal error, the OperationWarning could
@@ -83,7 +83,8 @@ type Attributes struct {
 
 type Column[T any] struct {
 	Attributes
-	Extractor func(*T) any // Extractor to be used; this can be defined to transform the output before retrieving the actual value
+	Extractor  func(*T) any      // Extractor to be used; this can be defined to transform the output before retrieving the actual value
+	Comparator func(a, b *T) int // Comparator, if set, is used to sort by this column instead of its underlying value
 
 	explicitName  bool                    // true, if the name has been set explicitly
 	offset        uintptr                 // offset to the field (relative to root non-ptr struct)
@@ -403,6 +404,11 @@ func (ci *Column[T]) IsVirtual() bool {
 	return ci.fieldIndex == virtualIndex
 }
 
+// HasCustomComparator returns true, if the column has a user defined comparator set
+func (ci *Column[T]) HasCustomComparator() bool {
+	return ci.Comparator != nil
+}
+
 // HasCustomExtractor returns true, if the column has a user defined extractor set
 func (ci *Column[T]) HasCustomExtractor() bool {
 	return ci.Extractor != nil
@@ -431,6 +431,30 @@ func (c *Columns[T]) SetExtractor(columnName string, extractor func(*T) any) err
 	return nil
 }
 
+// SetComparator sets the function used to sort entries by a specific column. It
+// must return a negative number if a sorts before b, a positive number if a
+// sorts after b and zero if they are equal. It makes virtual columns sortable.
+func (c *Columns[T]) SetComparator(columnName string, comparator func(a, b *T) int) error {
+	if comparator == nil {
+		return fmt.Errorf("comparator func must be non-nil")
+	}
+	column, ok := c.ColumnMap[strings.ToLower(columnName)]
+	if !ok {
+		return fmt.Errorf("field %q not found", columnName)
+	}
+
+	column.Comparator = comparator
+	return nil
+}
+
+// MustSetComparator sets the comparator of a column and panics if it cannot successfully do so
+func (c *Columns[T]) MustSetComparator(columnName string, comparator func(a, b *T) int) {
+	err := c.SetComparator(columnName, comparator)
+	if err != nil {
+		panic(fmt.Errorf("setting comparator for %q column: %w", columnName, err))
+	}
+}
+
 // MustSetExtractor adds a new extractor to a column and panics if it cannot successfully do so
 func (c *Columns[T]) MustSetExtractor(columnName string, extractor func(*T) any) {
 	err := c.SetExtractor(columnName, extractor)
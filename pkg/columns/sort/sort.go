@@ -41,6 +41,11 @@ func (csc *ColumnSorterCollection[T]) Sort(entries []*T) {
 		var sortFunc func(i, j int) bool
 		order := s.order
 
+		if s.column.HasCustomComparator() {
+			sort.SliceStable(entries, getComparatorLessFunc(entries, s.column.Comparator, order))
+			continue
+		}
+
 		kind := s.column.Kind()
 		if s.column.HasCustomExtractor() {
 			kind = s.column.GetRaw(entries[0]).Kind()
@@ -130,12 +135,33 @@ func getLessFunc[OT constraints.Ordered, T any](array []*T, column columns.Colum
 		if array[j] == nil {
 			return true
 		}
-		return !(fieldFunc(array[i]) < fieldFunc(array[j])) != order
+		// Both directions must be strict orderings, otherwise equal entries get
+		// swapped and the order established by lower priority rules is lost
+		if order == columns.OrderDesc {
+			return fieldFunc(array[j]) < fieldFunc(array[i])
+		}
+		return fieldFunc(array[i]) < fieldFunc(array[j])
+	}
+}
+
+func getComparatorLessFunc[T any](array []*T, comparator func(a, b *T) int, order columns.Order) func(i, j int) bool {
+	return func(i, j int) bool {
+		if array[i] == nil {
+			return false
+		}
+		if array[j] == nil {
+			return true
+		}
+		if order == columns.OrderDesc {
+			return comparator(array[j], array[i]) < 0
+		}
+		return comparator(array[i], array[j]) < 0
 	}
 }
 
 // CanSortBy returns true, if all requested sortBy arguments can be used for sorting
-// This is not the case for a virtual column, which has no underlying value type
+// This is not the case for a virtual column, which has no underlying value type,
+// unless it has a custom comparator
 func CanSortBy[T any](cols columns.ColumnMap[T], sortBy []string) bool {
 	valid, _ := FilterSortableColumns(cols, sortBy)
 
@@ -165,8 +191,9 @@ func FilterSortableColumns[T any](cols columns.ColumnMap[T], sortBy []string) ([
 			continue
 		}
 
-		// Skip virtual columns, they have no underlying value to sort by
-		if column.IsVirtual() {
+		// Skip virtual columns, they have no underlying value to sort by unless
+		// they have a comparator
+		if column.IsVirtual() && !column.HasCustomComparator() {
 			invalid = append(invalid, sortField)
 			continue
 		}
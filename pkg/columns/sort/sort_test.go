@@ -240,3 +240,40 @@ func TestFilterSortableColumns(t *testing.T) {
 		t.Errorf("expected FilterSortableColumns to not change the ordering")
 	}
 }
+
+func TestSortComparator(t *testing.T) {
+	cols := getTestCol(t)
+	cols.MustAddColumn(columns.Attributes{
+		Name: "virtual_comparator",
+	}, func(d *testData) any {
+		return fmt.Sprint(d.Int)
+	})
+	// Sort by the number of digits first, then by value
+	cols.MustSetComparator("virtual_comparator", func(a, b *testData) int {
+		la, lb := len(fmt.Sprint(a.Int)), len(fmt.Sprint(b.Int))
+		if la != lb {
+			return la - lb
+		}
+		return a.Int - b.Int
+	})
+	cmap := cols.GetColumnMap()
+
+	if !CanSortBy(cmap, []string{"virtual_comparator"}) {
+		t.Errorf("expected sort to be able to sort by \"virtual_comparator\" (virtual column with comparator)")
+	}
+
+	testEntries := []*testData{{Int: 10}, nil, {Int: 2}, {Int: 100}, {Int: 9}}
+
+	SortEntries(cmap, testEntries, []string{"virtual_comparator"})
+	if got := []int{testEntries[0].Int, testEntries[1].Int, testEntries[2].Int, testEntries[3].Int}; !reflect.DeepEqual(got, []int{2, 9, 10, 100}) {
+		t.Errorf("expected entries sorted by comparator, got %v", got)
+	}
+	if testEntries[4] != nil {
+		t.Errorf("expected nil entry to be last")
+	}
+
+	SortEntries(cmap, testEntries, []string{"-virtual_comparator"})
+	if got := []int{testEntries[0].Int, testEntries[1].Int, testEntries[2].Int, testEntries[3].Int}; !reflect.DeepEqual(got, []int{100, 10, 9, 2}) {
+		t.Errorf("expected entries sorted by comparator in descending order, got %v", got)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	ebpftop "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/top/ebpf"
 	filetop "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/top/file"
 	tcptop "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/top/tcp"
+	udptop "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/top/udp"
 	bindsnoop "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/trace/bind"
 	capabilities "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/trace/capabilities"
 	dns "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/trace/dns"
@@ -68,5 +69,6 @@ func TraceFactories() map[string]gadgets.TraceFactory {
 		"tcptop":            tcptop.NewFactory(),
 		"tcptracer":         tcptracer.NewFactory(),
 		"traceloop":         traceloop.NewFactory(),
+		"udptop":            udptop.NewFactory(),
 	}
 }
@@ -0,0 +1,47 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgets
+
+import (
+	"errors"
+	"os"
+
+	"github.com/cilium/ebpf"
+
+	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
+)
+
+// ClassifyError returns the code of err, an error returned while creating a
+// tracer: whether the gadget lacks privileges, its eBPF objects couldn't be
+// loaded or anything else happened.
+func ClassifyError(err error) gadgetv1alpha1.OperationErrorCode {
+	var ve *ebpf.VerifierError
+	switch {
+	// Both EPERM and EACCES match os.ErrPermission
+	case errors.Is(err, os.ErrPermission):
+		return gadgetv1alpha1.OperationErrorCodePermission
+	case errors.As(err, &ve), errors.Is(err, ebpf.ErrNotSupported):
+		return gadgetv1alpha1.OperationErrorCodeEBPFLoad
+	default:
+		return gadgetv1alpha1.OperationErrorCodeInternal
+	}
+}
+
+// SetOperationError sets the error of the operation applied to trace, both
+// the message displayed to the user and its code
+func SetOperationError(trace *gadgetv1alpha1.Trace, code gadgetv1alpha1.OperationErrorCode, msg string) {
+	trace.Status.OperationError = msg
+	trace.Status.OperationErrorCode = code
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gadgets
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/require"
+
+	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected gadgetv1alpha1.OperationErrorCode
+	}{
+		"permission": {
+			err:      fmt.Errorf("loading ebpf spec: %w", syscall.EPERM),
+			expected: gadgetv1alpha1.OperationErrorCodePermission,
+		},
+		"access": {
+			err:      fmt.Errorf("attaching kprobe: %w", syscall.EACCES),
+			expected: gadgetv1alpha1.OperationErrorCodePermission,
+		},
+		"verifier": {
+			err:      fmt.Errorf("loading ebpf spec: %w", &ebpf.VerifierError{}),
+			expected: gadgetv1alpha1.OperationErrorCodeEBPFLoad,
+		},
+		"not supported": {
+			err:      fmt.Errorf("creating map: %w", ebpf.ErrNotSupported),
+			expected: gadgetv1alpha1.OperationErrorCodeEBPFLoad,
+		},
+		"other": {
+			err:      errors.New("something else"),
+			expected: gadgetv1alpha1.OperationErrorCodeInternal,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, ClassifyError(test.err))
+		})
+	}
+}
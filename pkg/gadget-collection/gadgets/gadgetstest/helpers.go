@@ -0,0 +1,178 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gadgetstest provides a fake implementation of gadgets.GadgetHelpers
+// to test the gadgets of the collection without a cluster.
+package gadgetstest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	containercollection "github.com/inspektor-gadget/inspektor-gadget/pkg/container-collection"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+// ErrNoMountNsMap is returned by TracerMountNsMap when the helpers are
+// created with FailMountNsMap set
+var ErrNoMountNsMap = errors.New("no mount namespace map")
+
+// Event is an event published by a gadget
+type Event struct {
+	TracerID string
+	Line     string
+}
+
+// Helpers records the events published by the gadgets. It doesn't know any
+// container: the gadgets run without mount namespace filtering and their
+// events aren't enriched, except with the node name.
+type Helpers struct {
+	// Node is the node name set by EnrichNode
+	Node string
+	// FailMountNsMap makes TracerMountNsMap fail with ErrNoMountNsMap
+	FailMountNsMap bool
+
+	mu         sync.Mutex
+	events     []Event
+	published  chan struct{}
+	mountNsIDs []string
+}
+
+var _ gadgets.GadgetHelpers = (*Helpers)(nil)
+
+func NewHelpers() *Helpers {
+	return &Helpers{
+		published: make(chan struct{}, 1),
+	}
+}
+
+func (h *Helpers) PublishEvent(tracerID string, line string) error {
+	h.mu.Lock()
+	h.events = append(h.events, Event{TracerID: tracerID, Line: line})
+	h.mu.Unlock()
+
+	select {
+	case h.published <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Events returns a copy of the events published so far
+func (h *Helpers) Events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Event(nil), h.events...)
+}
+
+// Lines returns the lines published so far by the given tracer
+func (h *Helpers) Lines(tracerID string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var lines []string
+	for _, e := range h.events {
+		if e.TracerID == tracerID {
+			lines = append(lines, e.Line)
+		}
+	}
+	return lines
+}
+
+// Published is notified after events are published. Several events can be
+// published between two notifications.
+func (h *Helpers) Published() <-chan struct{} {
+	return h.published
+}
+
+// TracerMountNsMap returns a nil map, which disables the mount namespace
+// filtering of the tracers, and records the tracer ID
+func (h *Helpers) TracerMountNsMap(tracerID string) (*ebpf.Map, error) {
+	if h.FailMountNsMap {
+		return nil, ErrNoMountNsMap
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.mountNsIDs = append(h.mountNsIDs, tracerID)
+	return nil, nil
+}
+
+// MountNsMapRequests returns the tracer IDs given to TracerMountNsMap
+func (h *Helpers) MountNsMapRequests() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string(nil), h.mountNsIDs...)
+}
+
+func (h *Helpers) ContainersMap() *ebpf.Map {
+	return nil
+}
+
+func (h *Helpers) EnrichByMntNs(event *types.CommonData, mountnsid uint64) {
+	h.EnrichNode(event)
+}
+
+func (h *Helpers) EnrichByNetNs(event *types.CommonData, netnsid uint64) {
+	h.EnrichNode(event)
+}
+
+func (h *Helpers) EnrichNode(event *types.CommonData) {
+	event.K8s.Node = h.Node
+}
+
+func (h *Helpers) LookupMntnsByContainer(namespace, pod, container string) uint64 {
+	return 0
+}
+
+func (h *Helpers) LookupContainerByMntns(mntnsid uint64) *containercollection.Container {
+	return nil
+}
+
+func (h *Helpers) LookupContainersByNetns(netnsid uint64) []*containercollection.Container {
+	return nil
+}
+
+func (h *Helpers) LookupMntnsByPod(namespace, pod string) map[string]uint64 {
+	return map[string]uint64{}
+}
+
+func (h *Helpers) LookupPIDByContainer(namespace, pod, container string) uint32 {
+	return 0
+}
+
+func (h *Helpers) LookupPIDByPod(namespace, pod string) map[string]uint32 {
+	return map[string]uint32{}
+}
+
+func (h *Helpers) LookupOwnerReferenceByMntns(mntns uint64) *metav1.OwnerReference {
+	return nil
+}
+
+func (h *Helpers) GetContainersBySelector(containerSelector *containercollection.ContainerSelector) []*containercollection.Container {
+	return nil
+}
+
+func (h *Helpers) Subscribe(key interface{}, s containercollection.ContainerSelector, f containercollection.FuncNotify) []*containercollection.Container {
+	return nil
+}
+
+func (h *Helpers) Unsubscribe(key interface{}) {}
@@ -15,16 +15,13 @@
 package biotop
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
-	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns/sort"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	biotoptracer "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/block-io/tracer"
@@ -50,17 +47,21 @@ func NewFactory() gadgets.TraceFactory {
 
 func (f *TraceFactory) Description() string {
 	cols := types.GetColumns()
-	validCols, _ := sort.FilterSortableColumns(cols.ColumnMap, cols.GetColumnNames())
+	validCols := top.SortableColumns(cols)
 
 	t := `biotop shows command generating block I/O, with container details.
 
 The following parameters are supported:
- - %s: Output interval, in seconds. (default %d)
+ - %s: Output interval, in seconds or as a duration, e.g. "1500ms". (default %d)
+ - %s: Accept intervals shorter than %s. (default false)
  - %s: Maximum rows to print. (default %d)
- - %s: The field to sort the results by (%s). (default %s)`
+ - %s: Comma-separated fields to sort the results by (%s). Prefix a field with "-" to sort it in descending order. (default %s)
+ - %s: End the intervals on multiples of the interval on the wall clock, e.g. on the second, so that the samples are evenly spaced. The first interval is shorter. (default false)
+ - %s: Output format, "batch" for one JSON object per interval or "jsonl" for one JSON object per row. (default %s)`
 	return fmt.Sprintf(t, top.IntervalParam, top.IntervalDefault,
+		top.AllowShortIntervalParam, top.MinInterval,
 		top.MaxRowsParam, top.MaxRowsDefault,
-		top.SortByParam, strings.Join(validCols, ","), strings.Join(types.SortByDefault, ","))
+		top.SortByParam, strings.Join(validCols, ","), strings.Join(types.SortByDefault, ","), top.AlignToClockParam, top.OutputFormatParam, top.OutputFormatDefault)
 }
 
 func (f *TraceFactory) OutputModesSupported() map[gadgetv1alpha1.TraceOutputMode]struct{} {
@@ -107,41 +108,10 @@ func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
 
 	traceName := gadgets.TraceName(trace.ObjectMeta.Namespace, trace.ObjectMeta.Name)
 
-	maxRows := top.MaxRowsDefault
-	intervalSeconds := top.IntervalDefault
-	sortBy := types.SortByDefault
-
-	if trace.Spec.Parameters != nil {
-		params := trace.Spec.Parameters
-		var err error
-
-		if val, ok := params[top.MaxRowsParam]; ok {
-			maxRows, err = strconv.Atoi(val)
-			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, top.MaxRowsParam)
-				return
-			}
-		}
-
-		if val, ok := params[top.IntervalParam]; ok {
-			intervalSeconds, err = strconv.Atoi(val)
-			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, top.IntervalParam)
-				return
-			}
-		}
-
-		if val, ok := params[top.SortByParam]; ok {
-			sortByColumns := strings.Split(val, ",")
-
-			_, invalidCols := sort.FilterSortableColumns(types.GetColumns().ColumnMap, sortByColumns)
-			if len(invalidCols) > 0 {
-				trace.Status.OperationError = fmt.Sprintf("%q are not valid for %q", strings.Join(invalidCols, ","), top.SortByParam)
-				return
-			}
-
-			sortBy = sortByColumns
-		}
+	common, err := top.ParseCommonParams(trace.Spec.Parameters, types.GetColumns(), types.SortByDefault, false)
+	if err != nil {
+		trace.Status.OperationError = err.Error()
+		return
 	}
 
 	mountNsMap, err := t.helpers.TracerMountNsMap(traceName)
@@ -150,24 +120,27 @@ func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
 		return
 	}
 	config := &biotoptracer.Config{
-		MaxRows:    maxRows,
-		Interval:   time.Second * time.Duration(intervalSeconds),
-		SortBy:     sortBy,
-		MountnsMap: mountNsMap,
+		MaxRows:      common.MaxRows,
+		Interval:     common.Interval,
+		SortBy:       common.SortBy,
+		MountnsMap:   mountNsMap,
+		AlignToClock: common.AlignToClock,
 	}
 
 	eventCallback := func(ev *top.Event[types.Stats]) {
-		r, err := json.Marshal(ev)
+		lines, err := top.MarshalEvent(ev, common.OutputFormat, time.Now())
 		if err != nil {
 			log.Warnf("Gadget %s: Failed to marshall event: %s", trace.Spec.Gadget, err)
 			return
 		}
-		t.helpers.PublishEvent(traceName, string(r))
+		for _, line := range lines {
+			t.helpers.PublishEvent(traceName, line)
+		}
 	}
 
 	tracer, err := biotoptracer.NewTracer(config, t.helpers, eventCallback)
 	if err != nil {
-		trace.Status.OperationError = fmt.Sprintf("failed to create tracer: %s", err)
+		trace.Status.OperationError = fmt.Sprintf("failed to create tracer: %s", top.DescribeError(err))
 		return
 	}
 
@@ -15,7 +15,6 @@
 package filetop
 
 import (
-	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -24,7 +23,6 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
-	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns/sort"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	filetoptracer "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/file/tracer"
@@ -50,19 +48,23 @@ func NewFactory() gadgets.TraceFactory {
 
 func (f *TraceFactory) Description() string {
 	cols := types.GetColumns()
-	validCols, _ := sort.FilterSortableColumns(cols.ColumnMap, cols.GetColumnNames())
+	validCols := top.SortableColumns(cols)
 
 	t := `filetop shows reads and writes by file, with container details.
 
 The following parameters are supported:
- - %s: Output interval, in seconds. (default %d)
+ - %s: Output interval, in seconds or as a duration, e.g. "1500ms". (default %d)
+ - %s: Accept intervals shorter than %s. (default false)
  - %s: Maximum rows to print. (default %d)
- - %s: The field to sort the results by (%s). (default %s)
- - %s: Show all files. (default %v, i.e. show regular files only)`
+ - %s: Comma-separated fields to sort the results by (%s). Prefix a field with "-" to sort it in descending order. (default %s)
+ - %s: Show all files. (default %v, i.e. show regular files only)
+ - %s: End the intervals on multiples of the interval on the wall clock, e.g. on the second, so that the samples are evenly spaced. The first interval is shorter. (default false)
+ - %s: Output format, "batch" for one JSON object per interval or "jsonl" for one JSON object per row. (default %s)`
 	return fmt.Sprintf(t, top.IntervalParam, top.IntervalDefault,
+		top.AllowShortIntervalParam, top.MinInterval,
 		top.MaxRowsParam, top.MaxRowsDefault,
 		top.SortByParam, strings.Join(validCols, ","), strings.Join(types.SortByDefault, ","),
-		types.AllFilesParam, types.AllFilesDefault)
+		types.AllFilesParam, types.AllFilesDefault, top.AlignToClockParam, top.OutputFormatParam, top.OutputFormatDefault)
 }
 
 func (f *TraceFactory) OutputModesSupported() map[gadgetv1alpha1.TraceOutputMode]struct{} {
@@ -109,42 +111,15 @@ func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
 
 	traceName := gadgets.TraceName(trace.ObjectMeta.Namespace, trace.ObjectMeta.Name)
 
-	maxRows := top.MaxRowsDefault
-	intervalSeconds := top.IntervalDefault
-	sortBy := types.SortByDefault
+	common, err := top.ParseCommonParams(trace.Spec.Parameters, types.GetColumns(), types.SortByDefault, false)
+	if err != nil {
+		trace.Status.OperationError = err.Error()
+		return
+	}
 	allFiles := types.AllFilesDefault
 
 	if trace.Spec.Parameters != nil {
 		params := trace.Spec.Parameters
-		var err error
-
-		if val, ok := params[top.MaxRowsParam]; ok {
-			maxRows, err = strconv.Atoi(val)
-			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %s: %v", val, top.MaxRowsParam, err)
-				return
-			}
-		}
-
-		if val, ok := params[top.IntervalParam]; ok {
-			intervalSeconds, err = strconv.Atoi(val)
-			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %s: %v", val, top.IntervalParam, err)
-				return
-			}
-		}
-
-		if val, ok := params[top.SortByParam]; ok {
-			sortByColumns := strings.Split(val, ",")
-
-			_, invalidCols := sort.FilterSortableColumns(types.GetColumns().ColumnMap, sortByColumns)
-			if len(invalidCols) > 0 {
-				trace.Status.OperationError = fmt.Sprintf("%q are not valid for %q", strings.Join(invalidCols, ","), top.SortByParam)
-				return
-			}
-
-			sortBy = sortByColumns
-		}
 
 		if val, ok := params[types.AllFilesParam]; ok {
 			allFiles, err = strconv.ParseBool(val)
@@ -162,25 +137,28 @@ func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
 	}
 
 	config := &filetoptracer.Config{
-		AllFiles:   allFiles,
-		MaxRows:    maxRows,
-		Interval:   time.Second * time.Duration(intervalSeconds),
-		SortBy:     sortBy,
-		MountnsMap: mountNsMap,
+		AllFiles:     allFiles,
+		MaxRows:      common.MaxRows,
+		Interval:     common.Interval,
+		SortBy:       common.SortBy,
+		MountnsMap:   mountNsMap,
+		AlignToClock: common.AlignToClock,
 	}
 
 	eventCallback := func(ev *top.Event[types.Stats]) {
-		r, err := json.Marshal(ev)
+		lines, err := top.MarshalEvent(ev, common.OutputFormat, time.Now())
 		if err != nil {
 			log.Warnf("Gadget %s: Failed to marshall event: %s", trace.Spec.Gadget, err)
 			return
 		}
-		t.helpers.PublishEvent(traceName, string(r))
+		for _, line := range lines {
+			t.helpers.PublishEvent(traceName, line)
+		}
 	}
 
 	tracer, err := filetoptracer.NewTracer(config, t.helpers, eventCallback)
 	if err != nil {
-		trace.Status.OperationError = fmt.Sprintf("failed to create tracer: %s", err)
+		trace.Status.OperationError = fmt.Sprintf("failed to create tracer: %s", top.DescribeError(err))
 		return
 	}
 
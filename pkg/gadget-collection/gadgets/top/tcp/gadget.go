@@ -15,27 +15,59 @@
 package tcptop
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
-	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns/sort"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	tcptoptracer "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/tracer"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
 )
 
 type Trace struct {
 	helpers gadgets.GadgetHelpers
+	client  client.Client
 
+	// mu protects started, tracer and history, that are also updated once
+	// the tracer stops by itself when a duration is set
+	mu      sync.Mutex
 	started bool
 	tracer  *tcptoptracer.Tracer
+	// history outlives the tracer, so the last intervals can still be
+	// retrieved once it's stopped
+	history *top.History[types.Stats]
+	// params are the parameters the tracer was started with, to detect the
+	// ones the update operation can't apply
+	params map[string]string
+	// publisher is nil unless top.DropOnBackpressureParam is set
+	publisher *top.Publisher
+	// sink is nil unless top.OutputFileParam is set
+	sink *top.FileSink
+}
+
+// updatableParams are the parameters the update operation applies to the
+// running tracer. Changing any other one requires restarting the gadget.
+var updatableParams = map[string]struct{}{
+	top.IntervalParam:           {},
+	top.AllowShortIntervalParam: {},
+	top.MaxRowsParam:            {},
+	top.SortByParam:             {},
 }
 
 type TraceFactory struct {
@@ -50,32 +82,77 @@ func NewFactory() gadgets.TraceFactory {
 
 func (f *TraceFactory) Description() string {
 	cols := types.GetColumns()
-	validCols, _ := sort.FilterSortableColumns(cols.ColumnMap, cols.GetColumnNames())
+	validCols := top.SortableColumns(cols)
 
 	t := `tcptop shows command generating TCP connections, with container details.
 
 The following parameters are supported:
-- %s: Output interval, in seconds. (default %d)
+- %s: Output interval, in seconds or as a duration, e.g. "1500ms". 0 collects a single interval and stops. (default %d)
+- %s: Accept intervals shorter than %s. (default false)
 - %s: Maximum rows to print. (default %d)
-- %s: The field to sort the results by (%s). (default %s)
-- %s: Only get events for this PID (default to all).
-- %s: Only get events for this IP version. (either 4 or 6, default to all)`
+- %s: Comma-separated fields to sort the results by (%s). Prefix a field with "-" to sort it in descending order. (default %s)
+- %s: Only get events for this PID, or for any of these comma-separated PIDs (default to all).
+- %s: Don't get events for these comma-separated PIDs. The PIDs given to %s are always included. (default to none)
+- %s: Only get events for this IP version. (either 4 or 6, also spelled ipv4, v4, ipv6 or v6, default to all)
+- %s: Only get events to or from this remote port (default to all).
+- %s: Only get events on this local port (default to all).
+- %s: Only get events on this local IP address or in this CIDR, e.g. 10.0.0.0/8 (default to all).
+- %s: Only get events for processes with this name, truncated to %d characters (default to all).
+- %s: Match the process name regardless of the case, e.g. "chrome" matches "Chrome". (default false)
+- %s: Only get events for processes in the network namespace with this inode, as shown in the netns column. (default 0, all)
+- %s: Only get events for connections initiated by the process ("active") or accepted by it ("passive"). Connections opened before the trace started are only shown with "all". (default "all")
+- %s: Only show connections in the ESTABLISHED state, hiding the ones being opened or closed. (default false)
+- %s: Hide the connections whose both endpoints are loopback addresses (127.0.0.0/8 or ::1). (default false)
+- %s: Hide the connections of kernel threads, like the traffic handled on behalf of the idle task. (default false)
+- %s: Only show connections of the containers managed by this runtime (%s), hiding the host processes. (default %s)
+- %s: Report bytes since the gadget started instead of per interval, until the connection is closed. (default false)
+- %s: Show first the connections whose bytes changed the most compared to the previous interval, reported in the delta column. The first interval has no delta. It can't be used with %s. (default false)
+- %s: Sum the bytes of all the connections of each "container", "pod" or container "image", shown in the group column. (default to none)
+- %s: Show the top connections of each group instead of summing them, applying max_rows to each group. Requires grouping. (default false)
+- %s: Report the traffic of each connection on each CPU separately, in the cpu column, instead of summing it. It can't be used with %s. (default false)
+- %s: Don't show connections that sent and received less than this number of bytes combined. (default 0, show all)
+- %s: Only show connections whose smoothed round trip time is at least this number of milliseconds. Connections with an unknown RTT are always shown. (default 0, show all)
+- %s: Only get events for pods in this namespace, excluding host processes. (default to all)
+- %s: Only get events for pods with these comma-separated key=value labels, excluding host processes. (default to all)
+- %s: Stop automatically after this number of seconds. 0 runs until stopped. (default 0)
+- %s: Publish an event with "heartbeat" set for the intervals without any connection, so consumers know the gadget is alive. (default false)
+- %s: End the intervals on multiples of the interval on the wall clock, e.g. on the second, so that the samples are evenly spaced. The first interval is shorter. (default false)
+- %s: Keep this number of intervals in memory, to be retrieved with the "history" operation, even after the gadget is stopped. (default 0, disabled)
+- %s: Trace all the processes of the host, ignoring the filter of the trace, without enriching the events with their container or pod. It can't be used with the parameters relying on them. (default false)
+- %s: Number of connections tracked per interval, between %d and %d. Each one takes around 150 bytes of kernel memory, the traffic of the connections beyond it is missed. (default %d)
+- %s: Path, in the gadget pod, of a BTF file describing the kernel of the node, e.g. from BTFHub, for kernels that don't expose their BTF in /sys/kernel/btf/vmlinux. (default to the BTF of the kernel)
+- %s: Output format, "batch" for one JSON object per interval or "jsonl" for one JSON object per row. (default %s)
+- %s: Drop the oldest intervals not published yet instead of delaying the next ones when the consumers are too slow, up to %d intervals are kept. The events report the number of dropped intervals in "droppedBatches". (default false)
+- %s: Also append the events to this file on the node, relative to %s, in the output format, e.g. when running the agent without anything consuming the events. (default to none)
+- %s: Size the output file is rotated at, the previous one being kept with the ".1" suffix. 0 disables the rotation. (default %s)`
 	return fmt.Sprintf(t, top.IntervalParam, top.IntervalDefault,
+		top.AllowShortIntervalParam, top.MinInterval,
 		top.MaxRowsParam, top.MaxRowsDefault,
 		top.SortByParam, strings.Join(validCols, ","), strings.Join(types.SortByDefault, ","),
-		types.PidParam, types.FamilyParam)
+		types.PidParam, types.ExcludePidsParam, types.PidParam, types.FamilyParam, types.RemotePortParam, types.LocalPortParam, types.LocalAddrParam, types.CommParam, types.TaskCommLen, types.CommIgnoreCaseParam, types.NetNsParam, types.DirectionParam, types.EstablishedOnlyParam, types.ExcludeLoopbackParam, types.ExcludeKthreadsParam, types.RuntimeParam, strings.Join(types.Runtimes, ", "), types.RuntimeAll, types.CumulativeParam, types.DeltaParam, types.CumulativeParam, types.GroupByParam, types.PerGroupRowsParam, types.PerCPUParam, types.GroupByParam, types.MinBytesParam, types.MinRttParam,
+		types.K8sNamespaceParam, types.K8sLabelsParam, types.DurationParam, types.HeartbeatParam, top.AlignToClockParam, types.BufferIntervalsParam,
+		types.NoMountNsFilterParam,
+		types.MaxConnectionsParam, types.MaxConnectionsMin, types.MaxConnectionsMax, types.MaxConnectionsDefault,
+		types.BTFPathParam,
+		top.OutputFormatParam, top.OutputFormatDefault,
+		top.DropOnBackpressureParam, top.PublisherQueueSize,
+		top.OutputFileParam, top.OutputDir,
+		top.OutputFileMaxSizeParam, top.OutputFileMaxSizeDefault)
 }
 
 func (f *TraceFactory) OutputModesSupported() map[gadgetv1alpha1.TraceOutputMode]struct{} {
 	return map[gadgetv1alpha1.TraceOutputMode]struct{}{
 		gadgetv1alpha1.TraceOutputModeStream: {},
+		gadgetv1alpha1.TraceOutputModeStatus: {},
 	}
 }
 
 func deleteTrace(name string, t interface{}) {
 	trace := t.(*Trace)
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
 	if trace.tracer != nil {
-		trace.tracer.Stop()
+		trace.stopTracer()
 	}
 }
 
@@ -83,6 +160,7 @@ func (f *TraceFactory) Operations() map[gadgetv1alpha1.Operation]gadgets.TraceOp
 	n := func() interface{} {
 		return &Trace{
 			helpers: f.Helpers,
+			client:  f.Client,
 		}
 	}
 
@@ -99,118 +177,771 @@ func (f *TraceFactory) Operations() map[gadgetv1alpha1.Operation]gadgets.TraceOp
 				f.LookupOrCreate(name, n).(*Trace).Stop(trace)
 			},
 		},
+		gadgetv1alpha1.OperationValidate: {
+			Doc: "Check the parameters without starting the tcptop gadget",
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				validate(trace)
+			},
+		},
+		gadgetv1alpha1.OperationUpdate: {
+			Doc: fmt.Sprintf("Apply %s, %s and %s to the running tcptop gadget", top.IntervalParam, top.MaxRowsParam, top.SortByParam),
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				f.LookupOrCreate(name, n).(*Trace).Update(trace)
+			},
+		},
+		gadgetv1alpha1.OperationReset: {
+			Doc: fmt.Sprintf("Zero the totals of the running tcptop gadget when %s is set", types.CumulativeParam),
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				f.LookupOrCreate(name, n).(*Trace).Reset(trace)
+			},
+		},
+		gadgetv1alpha1.OperationHistory: {
+			Doc: "Report the last intervals kept in memory",
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				f.LookupOrCreate(name, n).(*Trace).History(trace)
+			},
+		},
+		gadgetv1alpha1.OperationColumns: {
+			Doc: "Report the columns of the tcptop output",
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				reportColumns(trace)
+			},
+		},
 	}
 }
 
-func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
-	if t.started {
-		trace.Status.State = gadgetv1alpha1.TraceStateStarted
+func (t *Trace) History(trace *gadgetv1alpha1.Trace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.history == nil {
+		trace.Status.OperationError = fmt.Sprintf("No history, %q must be set when starting the gadget", types.BufferIntervalsParam)
 		return
 	}
 
-	traceName := gadgets.TraceName(trace.ObjectMeta.Namespace, trace.ObjectMeta.Name)
+	output, err := json.Marshal(t.history.Events())
+	if err != nil {
+		trace.Status.OperationError = fmt.Sprintf("failed marshaling history: %s", err)
+		return
+	}
+
+	trace.Status.Output = string(output)
+}
+
+// Update applies the parameters that don't require reloading the eBPF programs
+// to the running tracer, keeping its counters. Changing any other parameter is
+// refused.
+func (t *Trace) Update(trace *gadgetv1alpha1.Trace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tracer == nil {
+		trace.Status.OperationError = "Gadget is not running"
+		return
+	}
+
+	if err := checkUpdatable(trace.Spec.Parameters, t.params); err != nil {
+		trace.Status.OperationError = err.Error()
+		return
+	}
+
+	t.update(trace)
+}
+
+// update applies the parameters of trace to the running tracer. It must be
+// called with t.mu held, once checkUpdatable succeeded.
+func (t *Trace) update(trace *gadgetv1alpha1.Trace) {
+	config, options, err := parseParams(trace)
+	if err != nil {
+		trace.Status.OperationError = err.Error()
+		return
+	}
+	if options.singleShot {
+		trace.Status.OperationError = fmt.Sprintf("%q can't be set to 0 while the gadget is running", top.IntervalParam)
+		return
+	}
+
+	t.tracer.UpdateConfig(tcptoptracer.ConfigUpdate{
+		MaxRows:  config.MaxRows,
+		Interval: config.Interval,
+		SortBy:   config.SortBy,
+	})
+	t.params = maps.Clone(trace.Spec.Parameters)
+}
 
-	maxRows := top.MaxRowsDefault
-	intervalSeconds := top.IntervalDefault
-	sortBy := types.SortByDefault
-	targetPid := int32(0)
+// Reset zeroes the totals of the running tracer in cumulative mode, without
+// reloading the eBPF programs. It does nothing otherwise.
+func (t *Trace) Reset(trace *gadgetv1alpha1.Trace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tracer == nil {
+		trace.Status.OperationError = "Gadget is not running"
+		return
+	}
+
+	t.tracer.ResetCumulative()
+}
+
+// checkUpdatable returns an error if params changes any parameter that isn't
+// in updatableParams compared to the ones the tracer was started with
+func checkUpdatable(params, startParams map[string]string) error {
+	changed := func(key string) bool {
+		_, updatable := updatableParams[key]
+		return !updatable && params[key] != startParams[key]
+	}
+
+	for key := range params {
+		if changed(key) {
+			return fmt.Errorf("%q can't be changed while the gadget is running, restart it instead", key)
+		}
+	}
+	for key := range startParams {
+		if changed(key) {
+			return fmt.Errorf("%q can't be changed while the gadget is running, restart it instead", key)
+		}
+	}
+	return nil
+}
+
+// validate reports the first invalid parameter, if any, as Start would do,
+// without loading the eBPF programs
+func validate(trace *gadgetv1alpha1.Trace) {
+	if _, _, err := parseParams(trace); err != nil {
+		trace.Status.OperationError = err.Error()
+	}
+}
+
+func reportColumns(trace *gadgetv1alpha1.Trace) {
+	output, err := json.MarshalIndent(types.ColumnsInfo(), "", " ")
+	if err != nil {
+		trace.Status.OperationError = fmt.Sprintf("failed marshaling columns: %s", err)
+		return
+	}
+
+	trace.Status.Output = string(output)
+}
+
+// traceOptions holds the parameters of the trace that don't configure the
+// tracer but how it's created and how its events are published
+type traceOptions struct {
+	outputFormat string
+	// outputFile is the file the events are also appended to, if any
+	outputFile        string
+	outputFileMaxSize int64
+	// singleShot is set when a single interval has to be collected
+	singleShot         bool
+	dropOnBackpressure bool
+	// noMountNsFilter runs the tracer host-wide, without looking up the
+	// mount namespace map of the trace nor enriching the events
+	noMountNsFilter bool
+}
+
+// parseParams parses the parameters of the trace into the configuration of
+// the tracer, without the mount namespace map, and the options of the trace.
+func parseParams(trace *gadgetv1alpha1.Trace) (*tcptoptracer.Config, traceOptions, error) {
+	dropOnBackpressure := false
+	noMountNsFilter := false
+	var targetPids map[int32]struct{}
+	var excludePids []int32
 	targetFamily := int32(-1)
+	targetRemotePort := int32(0)
+	targetLocalPort := int32(0)
+	var targetLocalAddr netip.Prefix
+	targetComm := ""
+	commIgnoreCase := false
+	targetNetNs := uint64(0)
+	targetDirection := types.DirectionAll
+	establishedOnly := false
+	excludeLoopback := false
+	excludeKthreads := false
+	var targetRuntime eventtypes.RuntimeName
+	cumulative := false
+	delta := false
+	heartbeat := false
+	groupBy := types.GroupByNone
+	perGroupRows := false
+	perCPU := false
+	var minBytes uint64
+	minRttMs := uint64(0)
+	targetK8sNamespace := ""
+	targetK8sLabels := map[string]string{}
+	durationSeconds := 0
+	bufferIntervals := 0
+	maxConnections := uint32(types.MaxConnectionsDefault)
+	btfPath := ""
+	outputFile := ""
+	outputFileMaxSize, _ := top.ParseOutputFileMaxSize(top.OutputFileMaxSizeDefault)
+
+	common, err := top.ParseCommonParams(trace.Spec.Parameters, types.GetColumns(), types.SortByDefault, true)
+	if err != nil {
+		return nil, traceOptions{}, err
+	}
+	interval := common.Interval
 
 	if trace.Spec.Parameters != nil {
 		params := trace.Spec.Parameters
-		var err error
 
-		if val, ok := params[top.MaxRowsParam]; ok {
-			maxRows, err = strconv.Atoi(val)
+		if val, ok := params[top.DropOnBackpressureParam]; ok {
+			dropOnBackpressure, err = strconv.ParseBool(val)
 			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, top.MaxRowsParam)
-				return
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, top.DropOnBackpressureParam)
 			}
 		}
 
-		if val, ok := params[top.IntervalParam]; ok {
-			intervalSeconds, err = strconv.Atoi(val)
+		if val, ok := params[types.NoMountNsFilterParam]; ok {
+			noMountNsFilter, err = strconv.ParseBool(val)
 			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, top.IntervalParam)
-				return
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.NoMountNsFilterParam)
 			}
 		}
 
-		if val, ok := params[top.SortByParam]; ok {
-			sortByColumns := strings.Split(val, ",")
+		if val, ok := params[types.PidParam]; ok {
+			targetPids, err = types.ParseTargetPids(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.PidParam)
+			}
+		}
 
-			_, invalidCols := sort.FilterSortableColumns(types.GetColumns().ColumnMap, sortByColumns)
-			if len(invalidCols) > 0 {
-				trace.Status.OperationError = fmt.Sprintf("%q are not valid for %q", strings.Join(invalidCols, ","), top.SortByParam)
-				return
+		if val, ok := params[types.ExcludePidsParam]; ok {
+			excludePids, err = types.ParseExcludePids(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q: %s", val, types.ExcludePidsParam, err)
 			}
+		}
 
-			sortBy = sortByColumns
+		if val, ok := params[types.FamilyParam]; ok {
+			targetFamily, err = types.ParseFilterByFamily(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q: %s", val, types.FamilyParam, err)
+			}
 		}
 
-		if val, ok := params[types.PidParam]; ok {
-			pid, err := strconv.ParseInt(val, 10, 32)
+		if val, ok := params[types.RemotePortParam]; ok {
+			port, err := strconv.ParseUint(val, 10, 16)
 			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, types.PidParam)
-				return
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.RemotePortParam)
 			}
 
-			targetPid = int32(pid)
+			targetRemotePort = int32(port)
 		}
 
-		if val, ok := params[types.FamilyParam]; ok {
-			targetFamily, err = types.ParseFilterByFamily(val)
+		if val, ok := params[types.LocalPortParam]; ok {
+			port, err := strconv.ParseUint(val, 10, 16)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.LocalPortParam)
+			}
+
+			targetLocalPort = int32(port)
+		}
+
+		if val, ok := params[types.LocalAddrParam]; ok {
+			targetLocalAddr, err = types.ParseLocalAddr(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q: %s", val, types.LocalAddrParam, err)
+			}
+		}
+
+		if val, ok := params[types.CommParam]; ok {
+			targetComm = val
+		}
+
+		if val, ok := params[types.CommIgnoreCaseParam]; ok {
+			commIgnoreCase, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.CommIgnoreCaseParam)
+			}
+		}
+
+		if val, ok := params[types.NetNsParam]; ok {
+			targetNetNs, err = strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.NetNsParam)
+			}
+		}
+
+		if val, ok := params[types.DirectionParam]; ok {
+			targetDirection, err = types.ParseDirection(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.DirectionParam)
+			}
+		}
+
+		if val, ok := params[types.EstablishedOnlyParam]; ok {
+			establishedOnly, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.EstablishedOnlyParam)
+			}
+		}
+
+		if val, ok := params[types.ExcludeLoopbackParam]; ok {
+			excludeLoopback, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.ExcludeLoopbackParam)
+			}
+		}
+
+		if val, ok := params[types.ExcludeKthreadsParam]; ok {
+			excludeKthreads, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.ExcludeKthreadsParam)
+			}
+		}
+
+		if val, ok := params[types.CumulativeParam]; ok {
+			cumulative, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.CumulativeParam)
+			}
+		}
+
+		if val, ok := params[types.DeltaParam]; ok {
+			delta, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.DeltaParam)
+			}
+		}
+
+		if val, ok := params[types.HeartbeatParam]; ok {
+			heartbeat, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.HeartbeatParam)
+			}
+		}
+
+		if val, ok := params[types.GroupByParam]; ok {
+			groupBy, err = types.ParseGroupBy(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.GroupByParam)
+			}
+		}
+
+		if val, ok := params[types.PerGroupRowsParam]; ok {
+			perGroupRows, err = strconv.ParseBool(val)
 			if err != nil {
-				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, types.FamilyParam)
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.PerGroupRowsParam)
+			}
+		}
+
+		if val, ok := params[types.PerCPUParam]; ok {
+			perCPU, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.PerCPUParam)
+			}
+		}
+
+		if val, ok := params[types.MinBytesParam]; ok {
+			minBytes, err = strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.MinBytesParam)
+			}
+		}
+
+		if val, ok := params[types.MinRttParam]; ok {
+			minRttMs, err = strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.MinRttParam)
+			}
+		}
+
+		if val, ok := params[types.RuntimeParam]; ok {
+			targetRuntime, err = types.ParseRuntime(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.RuntimeParam)
+			}
+		}
+
+		if val, ok := params[types.K8sNamespaceParam]; ok {
+			targetK8sNamespace = val
+		}
+
+		if val, ok := params[types.K8sLabelsParam]; ok {
+			targetK8sLabels, err = types.ParseK8sLabels(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.K8sLabelsParam)
+			}
+		}
+
+		if val, ok := params[types.DurationParam]; ok {
+			durationSeconds, err = strconv.Atoi(val)
+			if err != nil || durationSeconds < 0 {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.DurationParam)
+			}
+		}
+
+		if val, ok := params[types.BufferIntervalsParam]; ok {
+			bufferIntervals, err = strconv.Atoi(val)
+			if err != nil || bufferIntervals < 0 {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q", val, types.BufferIntervalsParam)
+			}
+		}
+
+		if val, ok := params[types.MaxConnectionsParam]; ok {
+			maxConnections, err = types.ParseMaxConnections(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q: %w", val, types.MaxConnectionsParam, err)
+			}
+		}
+
+		if val, ok := params[types.BTFPathParam]; ok {
+			btfPath = val
+		}
+
+		if val, ok := params[top.OutputFileParam]; ok {
+			outputFile, err = top.ResolveOutputFile(top.OutputDir, val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q: %s", val, top.OutputFileParam, err)
+			}
+		}
+
+		if val, ok := params[top.OutputFileMaxSizeParam]; ok {
+			outputFileMaxSize, err = top.ParseOutputFileMaxSize(val)
+			if err != nil {
+				return nil, traceOptions{}, fmt.Errorf("%q is not valid for %q: %s", val, top.OutputFileMaxSizeParam, err)
+			}
+		}
+	}
+
+	if perGroupRows && groupBy == types.GroupByNone {
+		return nil, traceOptions{}, fmt.Errorf("%q requires %q", types.PerGroupRowsParam, types.GroupByParam)
+	}
+
+	if perCPU && groupBy != types.GroupByNone {
+		return nil, traceOptions{}, fmt.Errorf("%q can't be used with %q", types.PerCPUParam, types.GroupByParam)
+	}
+
+	if delta && cumulative {
+		return nil, traceOptions{}, fmt.Errorf("%q can't be used with %q", types.DeltaParam, types.CumulativeParam)
+	}
+
+	// The events aren't enriched, so nothing identifies their pod or container
+	if noMountNsFilter {
+		for _, param := range []struct {
+			key string
+			set bool
+		}{
+			{types.GroupByParam, groupBy != types.GroupByNone},
+			{types.K8sNamespaceParam, targetK8sNamespace != ""},
+			{types.K8sLabelsParam, len(targetK8sLabels) > 0},
+			{types.RuntimeParam, targetRuntime != ""},
+		} {
+			if param.set {
+				return nil, traceOptions{}, fmt.Errorf("%q can't be used with %q", param.key, types.NoMountNsFilterParam)
+			}
+		}
+	}
+
+	// An interval of 0 means collecting a single interval and stopping
+	singleShot := interval == 0
+	iterations := 0
+	if singleShot {
+		interval = time.Duration(top.IntervalDefault) * time.Second
+		iterations = 1
+	}
+
+	config := &tcptoptracer.Config{
+		MaxRows:              common.MaxRows,
+		Interval:             interval,
+		Iterations:           iterations,
+		SortBy:               common.SortBy,
+		TargetPids:           targetPids,
+		TargetFamily:         targetFamily,
+		TargetRemotePort:     targetRemotePort,
+		TargetLocalPort:      targetLocalPort,
+		TargetLocalAddr:      targetLocalAddr,
+		TargetComm:           targetComm,
+		CommIgnoreCase:       commIgnoreCase,
+		TargetNetNs:          targetNetNs,
+		ExcludePids:          excludePids,
+		Cumulative:           cumulative,
+		Delta:                delta,
+		GroupBy:              groupBy,
+		MinBytes:             minBytes,
+		MinRtt:               time.Millisecond * time.Duration(minRttMs),
+		TargetK8sNamespace:   targetK8sNamespace,
+		TargetK8sLabels:      targetK8sLabels,
+		Duration:             time.Second * time.Duration(durationSeconds),
+		PerGroupRows:         perGroupRows,
+		PerCPU:               perCPU,
+		TargetDirection:      targetDirection,
+		EstablishedOnly:      establishedOnly,
+		ExcludeLoopback:      excludeLoopback,
+		ExcludeKernelThreads: excludeKthreads,
+		TargetRuntime:        targetRuntime,
+		BufferIntervals:      bufferIntervals,
+		Heartbeat:            heartbeat,
+		AlignToClock:         common.AlignToClock,
+		MaxConnections:       maxConnections,
+		BTFPath:              btfPath,
+	}
+
+	options := traceOptions{
+		outputFormat:       common.OutputFormat,
+		singleShot:         singleShot,
+		dropOnBackpressure: dropOnBackpressure,
+		noMountNsFilter:    noMountNsFilter,
+		outputFile:         outputFile,
+		outputFileMaxSize:  outputFileMaxSize,
+	}
+
+	return config, options, nil
+}
+
+func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		// Don't silently ignore the parameters changed since the tracer
+		// was started: apply them if possible, refuse them otherwise.
+		if !maps.Equal(trace.Spec.Parameters, t.params) {
+			if err := checkUpdatable(trace.Spec.Parameters, t.params); err != nil {
+				gadgets.SetOperationError(trace, gadgetv1alpha1.OperationErrorCodeBadParam,
+					fmt.Sprintf("Gadget is already running: %s", err))
+				return
+			}
+			t.update(trace)
+			if trace.Status.OperationError != "" {
+				trace.Status.OperationErrorCode = gadgetv1alpha1.OperationErrorCodeBadParam
 				return
 			}
 		}
+		trace.Status.State = gadgetv1alpha1.TraceStateStarted
+		return
 	}
 
-	mountNsMap, err := t.helpers.TracerMountNsMap(traceName)
+	traceName := gadgets.TraceName(trace.ObjectMeta.Namespace, trace.ObjectMeta.Name)
+
+	config, options, err := parseParams(trace)
 	if err != nil {
-		trace.Status.OperationError = fmt.Sprintf("failed to find tracer's mount ns map: %s", err)
+		gadgets.SetOperationError(trace, gadgetv1alpha1.OperationErrorCodeBadParam, err.Error())
 		return
 	}
-	config := &tcptoptracer.Config{
-		MaxRows:      maxRows,
-		Interval:     time.Second * time.Duration(intervalSeconds),
-		SortBy:       sortBy,
-		MountnsMap:   mountNsMap,
-		TargetPid:    targetPid,
-		TargetFamily: targetFamily,
+
+	var enricher gadgets.GadgetHelpers
+	if !options.noMountNsFilter {
+		mountNsMap, err := t.helpers.TracerMountNsMap(traceName)
+		if err != nil {
+			gadgets.SetOperationError(trace, gadgetv1alpha1.OperationErrorCodeInternal,
+				fmt.Sprintf("failed to find tracer's mount ns map: %s", err))
+			return
+		}
+		config.MountnsMap = mountNsMap
+		enricher = t.helpers
+	}
+
+	// In the Status output mode, each interval replaces the output of the
+	// trace as a single JSON object instead of being streamed. The intervals
+	// are reported after this operation returned, so the trace has to be
+	// patched manually.
+	statusMode := trace.Spec.OutputMode == gadgetv1alpha1.TraceOutputModeStatus
+	statusTrace := trace.DeepCopy()
+
+	// A single interval doesn't need to be decoupled from its consumers
+	var publisher *top.Publisher
+	if options.dropOnBackpressure && !options.singleShot && !statusMode {
+		publisher = top.NewPublisher(func(line string) {
+			t.helpers.PublishEvent(traceName, line)
+		})
+	}
+
+	var sink *top.FileSink
+	if options.outputFile != "" {
+		err = os.MkdirAll(filepath.Dir(options.outputFile), 0o755)
+		if err == nil {
+			sink, err = top.NewFileSink(options.outputFile, options.outputFileMaxSize)
+		}
+		if err != nil {
+			if publisher != nil {
+				publisher.Close()
+			}
+			gadgets.SetOperationError(trace, gadgets.ClassifyError(err), err.Error())
+			return
+		}
 	}
 
+	// The node is the same for all the stats, it's only known when the
+	// agent is deployed with it
+	var nodeData eventtypes.CommonData
+	t.helpers.EnrichNode(&nodeData)
+
 	eventCallback := func(ev *top.Event[types.Stats]) {
-		r, err := json.Marshal(ev)
+		ev.Node = nodeData.K8s.Node
+
+		if statusMode {
+			output, err := json.Marshal(ev)
+			if err != nil {
+				log.Warnf("Gadget %s: Failed to marshall event: %s", trace.Spec.Gadget, err)
+				return
+			}
+			writeSink(sink, []string{string(output)})
+			t.patchStatusOutput(statusTrace, string(output))
+			return
+		}
+
+		if publisher != nil {
+			ev.DroppedBatches = publisher.Dropped()
+		}
+		lines, err := top.MarshalEvent(ev, options.outputFormat, time.Now())
 		if err != nil {
 			log.Warnf("Gadget %s: Failed to marshall event: %s", trace.Spec.Gadget, err)
 			return
 		}
-		t.helpers.PublishEvent(traceName, string(r))
+		writeSink(sink, lines)
+		if publisher != nil {
+			publisher.Publish(lines)
+			return
+		}
+		for _, line := range lines {
+			t.helpers.PublishEvent(traceName, line)
+		}
 	}
 
-	tracer, err := tcptoptracer.NewTracer(config, t.helpers, eventCallback)
+	tracer, err := tcptoptracer.NewTracer(config, enricher, eventCallback)
 	if err != nil {
-		trace.Status.OperationError = fmt.Sprintf("failed to create tracer: %s", err)
+		if publisher != nil {
+			publisher.Close()
+		}
+		closeSink(sink)
+		gadgets.SetOperationError(trace, gadgets.ClassifyError(err),
+			fmt.Sprintf("failed to create tracer: %s", top.DescribeError(err)))
 		return
 	}
 
+	t.history = tracer.History()
 	t.tracer = tracer
+	t.publisher = publisher
+	t.sink = sink
+	t.params = maps.Clone(trace.Spec.Parameters)
 	t.started = true
 
+	// A single shot stops after its interval, don't hold the operation
+	// until then
+	if config.Duration > 0 || options.singleShot {
+		go t.waitCompletion(tracer, trace.DeepCopy())
+	}
+
 	trace.Status.State = gadgetv1alpha1.TraceStateStarted
 }
 
+// waitCompletion marks the trace as completed once the tracer stopped by
+// itself, after the requested duration or the single interval. The tracer
+// also exits when the trace is stopped or deleted before, so it doesn't
+// outlive it, waiting then at most completionTimeout for the controller.
+func (t *Trace) waitCompletion(tracer *tcptoptracer.Tracer, trace *gadgetv1alpha1.Trace) {
+	<-tracer.Exited()
+
+	t.mu.Lock()
+	if t.tracer != tracer {
+		// Stopped through the stop operation
+		t.mu.Unlock()
+		return
+	}
+	t.stopTracer()
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	if err := t.patchCompleted(ctx, trace); err != nil {
+		log.Errorf("Gadget %s: Failed to update trace status: %s", trace.Spec.Gadget, err)
+	}
+}
+
+// completionTimeout is how long waitCompletion waits for the controller to
+// write the state returned by the start operation
+const completionTimeout = time.Minute
+
+// patchCompleted sets the state of trace to completed. This isn't called from
+// an operation, so the trace CRD has to be patched manually, and only once the
+// controller wrote the started state of the start operation, which would
+// overwrite the completed one otherwise: a short tracer can exit before.
+func (t *Trace) patchCompleted(ctx context.Context, trace *gadgetv1alpha1.Trace) error {
+	key := client.ObjectKeyFromObject(trace)
+	return wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		current := &gadgetv1alpha1.Trace{}
+		if err := t.client.Get(ctx, key, current); err != nil {
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, nil
+		}
+		if current.Status.State != gadgetv1alpha1.TraceStateStarted {
+			return false, nil
+		}
+
+		patch := client.MergeFromWithOptions(current.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		current.Status.State = gadgetv1alpha1.TraceStateCompleted
+		if err := t.client.Status().Patch(ctx, current, patch); err != nil {
+			if apierrors.IsConflict(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	})
+}
+
+// patchStatusOutput replaces the output of trace with the last interval. This
+// isn't called from an operation, so the trace CRD has to be patched manually.
+func (t *Trace) patchStatusOutput(trace *gadgetv1alpha1.Trace, output string) {
+	traceBeforePatch := trace.DeepCopy()
+	trace.Status.Output = output
+	patch := client.MergeFrom(traceBeforePatch)
+
+	if err := t.client.Status().Patch(context.TODO(), trace, patch); err != nil {
+		log.Errorf("Gadget %s: Failed to update trace output: %s", trace.Spec.Gadget, err)
+	}
+}
+
 func (t *Trace) Stop(trace *gadgetv1alpha1.Trace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	if !t.started {
+		// The tracer already stopped by itself
+		if trace.Status.State == gadgetv1alpha1.TraceStateCompleted {
+			return
+		}
 		trace.Status.OperationError = "Not started"
 		return
 	}
 
+	t.stopTracer()
+
+	trace.Status.State = gadgetv1alpha1.TraceStateStopped
+}
+
+// stopTracer stops the running tracer and publishes the intervals it reported
+// that are still queued. t.mu must be held.
+func (t *Trace) stopTracer() {
 	t.tracer.Stop()
 	t.tracer = nil
+	if t.publisher != nil {
+		t.publisher.Close()
+		t.publisher = nil
+	}
+	closeSink(t.sink)
+	t.sink = nil
 	t.started = false
+}
 
-	trace.Status.State = gadgetv1alpha1.TraceStateStopped
+// writeSink appends lines to sink, if any. The events are still published
+// when it fails, e.g. because the disk is full.
+func writeSink(sink *top.FileSink, lines []string) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Write(lines); err != nil {
+		log.Warnf("Gadget tcptop: Failed to write to output file: %s", err)
+	}
+}
+
+// closeSink flushes and closes sink, if any
+func closeSink(sink *top.FileSink) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Close(); err != nil {
+		log.Warnf("Gadget tcptop: Failed to close output file: %s", err)
+	}
 }
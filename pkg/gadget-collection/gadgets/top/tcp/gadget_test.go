@@ -0,0 +1,418 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcptop
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	utilstest "github.com/inspektor-gadget/inspektor-gadget/internal/test"
+	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets/gadgetstest"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	tcptoptracer "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/tracer"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+func newTrace(params map[string]string) *gadgetv1alpha1.Trace {
+	return &gadgetv1alpha1.Trace{
+		Spec: gadgetv1alpha1.TraceSpec{Parameters: params},
+	}
+}
+
+// sortByError returns the error reported for the sort_by value val, which
+// lists all the sortable columns
+func sortByError(val string) string {
+	_, err := top.ParseSortBy(types.GetColumns(), val)
+	return err.Error()
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		params        map[string]string
+		expectedError string
+	}{
+		"no parameters": {},
+		"valid": {
+			params: map[string]string{
+				"interval":     "2",
+				"sort_by":      "-sent,pid",
+				"family":       "ipv4",
+				"exclude-pids": "1,2",
+				"group-by":     "pod",
+				"local-addr":   "10.0.0.0/8",
+				"runtime":      "cri-o",
+			},
+		},
+		"invalid interval": {
+			params:        map[string]string{"interval": "-1"},
+			expectedError: `"-1" is not valid for "interval": must not be negative`,
+		},
+		"interval below the floor": {
+			params:        map[string]string{"interval": "10ms"},
+			expectedError: `"10ms" is not valid for "interval": must be at least 1s unless "allow-short-interval" is set`,
+		},
+		"interval below the floor allowed": {
+			params: map[string]string{"interval": "10ms", "allow-short-interval": "true"},
+		},
+		"invalid local address": {
+			params:        map[string]string{"local-addr": "10.0.0"},
+			expectedError: `"10.0.0" is not valid for "local-addr": "10.0.0" is neither an IP address nor a CIDR`,
+		},
+		"invalid sort column": {
+			params:        map[string]string{"sort_by": "foo"},
+			expectedError: sortByError("foo"),
+		},
+		"invalid output file max size": {
+			params:        map[string]string{"output-file": "tcptop.jsonl", "output-file-max-size": "1XB"},
+			expectedError: `"1XB" is not valid for "output-file-max-size": invalid suffix: 'xb'`,
+		},
+		"absolute output file": {
+			params:        map[string]string{"output-file": "/etc/cron.d/tcptop"},
+			expectedError: `"/etc/cron.d/tcptop" is not valid for "output-file": must be relative to /var/lib/inspektor-gadget/top`,
+		},
+		"output file outside of the output directory": {
+			params:        map[string]string{"output-file": "../../../etc/cron.d/tcptop"},
+			expectedError: `"../../../etc/cron.d/tcptop" is not valid for "output-file": must be a file in /var/lib/inspektor-gadget/top`,
+		},
+		"delta with cumulative": {
+			params:        map[string]string{"delta": "true", "cumulative": "true"},
+			expectedError: `"delta" can't be used with "cumulative"`,
+		},
+		"invalid family": {
+			params:        map[string]string{"family": "ip6"},
+			expectedError: `"ip6" is not valid for "family": IP version is either 4 (ipv4, v4) or 6 (ipv6, v6), "ip6" was given (did you mean "ipv6"?)`,
+		},
+		"invalid remote port": {
+			params:        map[string]string{"remote-port": "65536"},
+			expectedError: `"65536" is not valid for "remote-port"`,
+		},
+		"invalid local port": {
+			params:        map[string]string{"local-port": "http"},
+			expectedError: `"http" is not valid for "local-port"`,
+		},
+		"invalid min bytes": {
+			params:        map[string]string{"min-bytes": "-1"},
+			expectedError: `"-1" is not valid for "min-bytes"`,
+		},
+		"negative duration": {
+			params:        map[string]string{"duration": "-5"},
+			expectedError: `"-5" is not valid for "duration"`,
+		},
+		"invalid duration": {
+			params:        map[string]string{"duration": "5m"},
+			expectedError: `"5m" is not valid for "duration"`,
+		},
+		"invalid pid": {
+			params:        map[string]string{"pid": "abc"},
+			expectedError: `"abc" is not valid for "pid"`,
+		},
+		"max connections out of bounds": {
+			params:        map[string]string{"max-connections": "10"},
+			expectedError: `"10" is not valid for "max-connections": must be between 64 and 1048576`,
+		},
+		"no mount ns filter with group by": {
+			params:        map[string]string{"no-mountns-filter": "true", "group-by": "pod"},
+			expectedError: `"group-by" can't be used with "no-mountns-filter"`,
+		},
+		"invalid runtime": {
+			params:        map[string]string{"runtime": "lxc"},
+			expectedError: `"lxc" is not valid for "runtime"`,
+		},
+		"per group rows without group by": {
+			params:        map[string]string{"per-group-rows": "true"},
+			expectedError: `"per-group-rows" requires "group-by"`,
+		},
+		"per cpu with group by": {
+			params:        map[string]string{"per-cpu": "true", "group-by": "container"},
+			expectedError: `"per-cpu" can't be used with "group-by"`,
+		},
+		"invalid per cpu": {
+			params:        map[string]string{"per-cpu": "yes"},
+			expectedError: `"yes" is not valid for "per-cpu"`,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			trace := newTrace(test.params)
+			validate(trace)
+			require.Equal(t, test.expectedError, trace.Status.OperationError)
+			require.Empty(t, trace.Status.State, "validate must not start the trace")
+		})
+	}
+}
+
+func TestParseParamsFilters(t *testing.T) {
+	tests := map[string]struct {
+		params map[string]string
+		check  func(t *testing.T, config *tcptoptracer.Config)
+	}{
+		"defaults": {
+			check: func(t *testing.T, config *tcptoptracer.Config) {
+				require.Zero(t, config.TargetRemotePort)
+				require.Zero(t, config.TargetLocalPort)
+				require.Empty(t, config.TargetComm)
+				require.Zero(t, config.MinBytes)
+				require.Zero(t, config.Duration)
+			},
+		},
+		"ports": {
+			params: map[string]string{"remote-port": "443", "local-port": "8080"},
+			check: func(t *testing.T, config *tcptoptracer.Config) {
+				require.Equal(t, int32(443), config.TargetRemotePort)
+				require.Equal(t, int32(8080), config.TargetLocalPort)
+			},
+		},
+		"comm": {
+			params: map[string]string{"comm": "nginx"},
+			check: func(t *testing.T, config *tcptoptracer.Config) {
+				require.Equal(t, "nginx", config.TargetComm)
+			},
+		},
+		"min bytes": {
+			params: map[string]string{"min-bytes": "4096"},
+			check: func(t *testing.T, config *tcptoptracer.Config) {
+				require.Equal(t, uint64(4096), config.MinBytes)
+			},
+		},
+		"duration": {
+			params: map[string]string{"duration": "30"},
+			check: func(t *testing.T, config *tcptoptracer.Config) {
+				require.Equal(t, 30*time.Second, config.Duration)
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			config, _, err := parseParams(newTrace(test.params))
+			require.NoError(t, err)
+			test.check(t, config)
+		})
+	}
+}
+
+func TestParseParamsSingleShot(t *testing.T) {
+	config, options, err := parseParams(newTrace(map[string]string{
+		"interval":             "0",
+		"output_format":        "jsonl",
+		"drop-on-backpressure": "true",
+	}))
+	require.NoError(t, err)
+	require.True(t, options.singleShot)
+	require.Equal(t, 1, config.Iterations)
+	require.Equal(t, "jsonl", options.outputFormat)
+	require.True(t, options.dropOnBackpressure)
+}
+
+func TestUpdateNotRunning(t *testing.T) {
+	trace := newTrace(map[string]string{"max_rows": "5"})
+	(&Trace{}).Update(trace)
+	require.Equal(t, "Gadget is not running", trace.Status.OperationError)
+}
+
+func TestResetNotRunning(t *testing.T) {
+	trace := newTrace(nil)
+	(&Trace{}).Reset(trace)
+	require.Equal(t, "Gadget is not running", trace.Status.OperationError)
+}
+
+func TestStopNotRunning(t *testing.T) {
+	trace := newTrace(nil)
+	(&Trace{}).Stop(trace)
+	require.Equal(t, "Not started", trace.Status.OperationError)
+
+	// A single shot, or a trace with a duration, stops by itself
+	trace = newTrace(map[string]string{"interval": "0"})
+	trace.Status.State = gadgetv1alpha1.TraceStateCompleted
+	(&Trace{}).Stop(trace)
+	require.Empty(t, trace.Status.OperationError)
+	require.Equal(t, gadgetv1alpha1.TraceStateCompleted, trace.Status.State)
+}
+
+func TestStartAlreadyStarted(t *testing.T) {
+	running := &Trace{started: true, params: map[string]string{"interval": "1", "pid": "42"}}
+
+	trace := newTrace(map[string]string{"interval": "1", "pid": "42"})
+	running.Start(trace)
+	require.Empty(t, trace.Status.OperationError)
+	require.Equal(t, gadgetv1alpha1.TraceStateStarted, trace.Status.State)
+
+	trace = newTrace(map[string]string{"interval": "1", "pid": "43"})
+	running.Start(trace)
+	require.Equal(t, `Gadget is already running: "pid" can't be changed while the gadget is running, restart it instead`,
+		trace.Status.OperationError)
+	require.Equal(t, gadgetv1alpha1.OperationErrorCodeBadParam, trace.Status.OperationErrorCode)
+	require.Empty(t, trace.Status.State)
+}
+
+func TestStartMountNsMapError(t *testing.T) {
+	helpers := gadgetstest.NewHelpers()
+	helpers.FailMountNsMap = true
+
+	trace := newTrace(map[string]string{"interval": "1"})
+	(&Trace{helpers: helpers}).Start(trace)
+	require.Equal(t, "failed to find tracer's mount ns map: "+gadgetstest.ErrNoMountNsMap.Error(), trace.Status.OperationError)
+	require.Equal(t, gadgetv1alpha1.OperationErrorCodeInternal, trace.Status.OperationErrorCode)
+	require.Empty(t, trace.Status.State)
+	require.Empty(t, helpers.Events())
+}
+
+func TestStartPublishes(t *testing.T) {
+	utilstest.RequireRoot(t)
+
+	helpers := gadgetstest.NewHelpers()
+	helpers.Node = "node-1"
+	// The heartbeat ensures an idle host publishes intervals too
+	trace := newTrace(map[string]string{"interval": "200ms", "allow-short-interval": "true", "heartbeat": "true"})
+	trace.Namespace = "gadget"
+	trace.Name = "tcptop"
+
+	tr := &Trace{helpers: helpers}
+	tr.Start(trace)
+	require.Empty(t, trace.Status.OperationError)
+	require.Equal(t, gadgetv1alpha1.TraceStateStarted, trace.Status.State)
+	defer tr.Stop(newTrace(nil))
+
+	traceName := gadgets.TraceName("gadget", "tcptop")
+	require.Equal(t, []string{traceName}, helpers.MountNsMapRequests())
+
+	select {
+	case <-helpers.Published():
+	case <-time.After(5 * time.Second):
+		t.Fatal("No interval was published")
+	}
+
+	lines := helpers.Lines(traceName)
+	require.NotEmpty(t, lines)
+	var ev top.Event[types.Stats]
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &ev))
+	require.Equal(t, "node-1", ev.Node)
+}
+
+func TestPatchStatusOutput(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, gadgetv1alpha1.AddToScheme(scheme))
+
+	trace := newTrace(nil)
+	trace.Name = "tcptop"
+	trace.Namespace = "gadget"
+	trace.Spec.OutputMode = gadgetv1alpha1.TraceOutputModeStatus
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(trace).WithStatusSubresource(trace).Build()
+
+	tr := &Trace{client: c}
+	tr.patchStatusOutput(trace.DeepCopy(), `{"stats":[]}`)
+
+	patched := &gadgetv1alpha1.Trace{}
+	require.NoError(t, c.Get(context.TODO(), k8stypes.NamespacedName{Namespace: "gadget", Name: "tcptop"}, patched))
+	require.Equal(t, `{"stats":[]}`, patched.Status.Output)
+}
+
+func TestCheckUpdatable(t *testing.T) {
+	startParams := map[string]string{"interval": "1", "pid": "42"}
+
+	tests := map[string]struct {
+		params        map[string]string
+		expectedError string
+	}{
+		"unchanged": {
+			params: map[string]string{"interval": "1", "pid": "42"},
+		},
+		"updatable": {
+			params: map[string]string{"interval": "5", "max_rows": "5", "sort_by": "pid", "pid": "42"},
+		},
+		"changed filter": {
+			params:        map[string]string{"interval": "1", "pid": "43"},
+			expectedError: `"pid" can't be changed while the gadget is running, restart it instead`,
+		},
+		"removed filter": {
+			params:        map[string]string{"interval": "1"},
+			expectedError: `"pid" can't be changed while the gadget is running, restart it instead`,
+		},
+		"added filter": {
+			params:        map[string]string{"interval": "1", "pid": "42", "family": "4"},
+			expectedError: `"family" can't be changed while the gadget is running, restart it instead`,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			err := checkUpdatable(test.params, startParams)
+			if test.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestPatchCompletedAfterStarted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, gadgetv1alpha1.AddToScheme(scheme))
+
+	trace := newTrace(nil)
+	trace.Name = "tcptop"
+	trace.Namespace = "gadget"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(trace).WithStatusSubresource(trace).Build()
+	key := k8stypes.NamespacedName{Namespace: "gadget", Name: "tcptop"}
+
+	tr := &Trace{client: c}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- tr.patchCompleted(ctx, trace.DeepCopy()) }()
+
+	// The tracer exited before the controller wrote the state returned by
+	// the start operation
+	time.Sleep(200 * time.Millisecond)
+	started := &gadgetv1alpha1.Trace{}
+	require.NoError(t, c.Get(ctx, key, started))
+	require.Empty(t, started.Status.State, "completed before the controller wrote the started state")
+	patch := client.MergeFrom(started.DeepCopy())
+	started.Status.State = gadgetv1alpha1.TraceStateStarted
+	require.NoError(t, c.Status().Patch(ctx, started, patch))
+
+	require.NoError(t, <-done)
+	patched := &gadgetv1alpha1.Trace{}
+	require.NoError(t, c.Get(ctx, key, patched))
+	require.Equal(t, gadgetv1alpha1.TraceStateCompleted, patched.Status.State)
+}
+
+func TestPatchCompletedDeleted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, gadgetv1alpha1.AddToScheme(scheme))
+
+	trace := newTrace(nil)
+	trace.Name = "tcptop"
+	trace.Namespace = "gadget"
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	tr := &Trace{client: c}
+	require.NoError(t, tr.patchCompleted(context.Background(), trace))
+}
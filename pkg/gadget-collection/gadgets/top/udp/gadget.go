@@ -0,0 +1,194 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package udptop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	gadgetv1alpha1 "github.com/inspektor-gadget/inspektor-gadget/pkg/apis/gadget/v1alpha1"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-collection/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	udptoptracer "github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/udp/tracer"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/udp/types"
+)
+
+type Trace struct {
+	helpers gadgets.GadgetHelpers
+
+	started bool
+	tracer  *udptoptracer.Tracer
+}
+
+type TraceFactory struct {
+	gadgets.BaseFactory
+}
+
+func NewFactory() gadgets.TraceFactory {
+	return &TraceFactory{
+		BaseFactory: gadgets.BaseFactory{DeleteTrace: deleteTrace},
+	}
+}
+
+func (f *TraceFactory) Description() string {
+	cols := types.GetColumns()
+	validCols := top.SortableColumns(cols)
+
+	t := `udptop shows the UDP traffic of the processes, with container details.
+
+The following parameters are supported:
+ - %s: Output interval, in seconds or as a duration, e.g. "1500ms". (default %d)
+ - %s: Accept intervals shorter than %s. (default false)
+ - %s: Maximum rows to print. (default %d)
+ - %s: Comma-separated fields to sort the results by (%s). Prefix a field with "-" to sort it in descending order. (default %s)
+ - %s: Only get events for this PID. (default to all)
+ - %s: Only get events for this IP version. (either 4 or 6, default to all)
+ - %s: End the intervals on multiples of the interval on the wall clock, e.g. on the second, so that the samples are evenly spaced. The first interval is shorter. (default false)
+ - %s: Output format, "batch" for one JSON object per interval or "jsonl" for one JSON object per row. (default %s)`
+	return fmt.Sprintf(t, top.IntervalParam, top.IntervalDefault,
+		top.AllowShortIntervalParam, top.MinInterval,
+		top.MaxRowsParam, top.MaxRowsDefault,
+		top.SortByParam, strings.Join(validCols, ","), strings.Join(types.SortByDefault, ","),
+		types.PidParam, types.FamilyParam, top.AlignToClockParam, top.OutputFormatParam, top.OutputFormatDefault)
+}
+
+func (f *TraceFactory) OutputModesSupported() map[gadgetv1alpha1.TraceOutputMode]struct{} {
+	return map[gadgetv1alpha1.TraceOutputMode]struct{}{
+		gadgetv1alpha1.TraceOutputModeStream: {},
+	}
+}
+
+func deleteTrace(name string, t interface{}) {
+	trace := t.(*Trace)
+	if trace.tracer != nil {
+		trace.tracer.Stop()
+	}
+}
+
+func (f *TraceFactory) Operations() map[gadgetv1alpha1.Operation]gadgets.TraceOperation {
+	n := func() interface{} {
+		return &Trace{
+			helpers: f.Helpers,
+		}
+	}
+
+	return map[gadgetv1alpha1.Operation]gadgets.TraceOperation{
+		gadgetv1alpha1.OperationStart: {
+			Doc: "Start udptop gadget",
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				f.LookupOrCreate(name, n).(*Trace).Start(trace)
+			},
+		},
+		gadgetv1alpha1.OperationStop: {
+			Doc: "Stop udptop gadget",
+			Operation: func(name string, trace *gadgetv1alpha1.Trace) {
+				f.LookupOrCreate(name, n).(*Trace).Stop(trace)
+			},
+		},
+	}
+}
+
+func (t *Trace) Start(trace *gadgetv1alpha1.Trace) {
+	if t.started {
+		trace.Status.State = gadgetv1alpha1.TraceStateStarted
+		return
+	}
+
+	traceName := gadgets.TraceName(trace.ObjectMeta.Namespace, trace.ObjectMeta.Name)
+
+	common, err := top.ParseCommonParams(trace.Spec.Parameters, types.GetColumns(), types.SortByDefault, false)
+	if err != nil {
+		trace.Status.OperationError = err.Error()
+		return
+	}
+	targetPid := int32(0)
+	targetFamily := int32(-1)
+
+	if trace.Spec.Parameters != nil {
+		params := trace.Spec.Parameters
+
+		if val, ok := params[types.PidParam]; ok {
+			pid, err := strconv.ParseInt(val, 10, 32)
+			if err != nil {
+				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q", val, types.PidParam)
+				return
+			}
+			targetPid = int32(pid)
+		}
+
+		if val, ok := params[types.FamilyParam]; ok {
+			targetFamily, err = types.ParseFilterByFamily(val)
+			if err != nil {
+				trace.Status.OperationError = fmt.Sprintf("%q is not valid for %q: %s", val, types.FamilyParam, err)
+				return
+			}
+		}
+	}
+
+	mountNsMap, err := t.helpers.TracerMountNsMap(traceName)
+	if err != nil {
+		trace.Status.OperationError = fmt.Sprintf("failed to find tracer's mount ns map: %s", err)
+		return
+	}
+
+	config := &udptoptracer.Config{
+		TargetPid:    targetPid,
+		TargetFamily: targetFamily,
+		MaxRows:      common.MaxRows,
+		Interval:     common.Interval,
+		SortBy:       common.SortBy,
+		MountnsMap:   mountNsMap,
+		AlignToClock: common.AlignToClock,
+	}
+
+	eventCallback := func(ev *top.Event[types.Stats]) {
+		lines, err := top.MarshalEvent(ev, common.OutputFormat, time.Now())
+		if err != nil {
+			log.Warnf("Gadget %s: Failed to marshall event: %s", trace.Spec.Gadget, err)
+			return
+		}
+		for _, line := range lines {
+			t.helpers.PublishEvent(traceName, line)
+		}
+	}
+
+	tracer, err := udptoptracer.NewTracer(config, t.helpers, eventCallback)
+	if err != nil {
+		trace.Status.OperationError = fmt.Sprintf("failed to create tracer: %s", top.DescribeError(err))
+		return
+	}
+
+	t.tracer = tracer
+	t.started = true
+
+	trace.Status.State = gadgetv1alpha1.TraceStateStarted
+}
+
+func (t *Trace) Stop(trace *gadgetv1alpha1.Trace) {
+	if !t.started {
+		trace.Status.OperationError = "Not started"
+		return
+	}
+
+	t.tracer.Stop()
+	t.tracer = nil
+	t.started = false
+
+	trace.Status.State = gadgetv1alpha1.TraceStateStopped
+}
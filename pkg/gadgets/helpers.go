@@ -26,6 +26,7 @@ import (
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
 	"github.com/cilium/ebpf/features"
 	"github.com/cilium/ebpf/link"
 	"golang.org/x/sys/unix"
@@ -211,6 +212,19 @@ func LoadeBPFSpec(
 	spec *ebpf.CollectionSpec,
 	consts map[string]interface{},
 	objs interface{},
+) error {
+	return LoadeBPFSpecWithKernelTypes(mountnsMap, spec, consts, objs, btfgen.GetBTFSpec())
+}
+
+// LoadeBPFSpecWithKernelTypes is like LoadeBPFSpec but relocates the programs
+// against the given kernel types, e.g. an external BTF file for kernels that
+// don't expose theirs. The kernel ones are used if kernelTypes is nil.
+func LoadeBPFSpecWithKernelTypes(
+	mountnsMap *ebpf.Map,
+	spec *ebpf.CollectionSpec,
+	consts map[string]interface{},
+	objs interface{},
+	kernelTypes *btf.Spec,
 ) error {
 	FixBpfKtimeGetBootNs(spec.Programs)
 
@@ -235,7 +249,7 @@ func LoadeBPFSpec(
 	opts := ebpf.CollectionOptions{
 		MapReplacements: mapReplacements,
 		Programs: ebpf.ProgramOptions{
-			KernelTypes: btfgen.GetBTFSpec(),
+			KernelTypes: kernelTypes,
 		},
 	}
 
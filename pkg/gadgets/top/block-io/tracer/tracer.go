@@ -42,6 +42,9 @@ type Config struct {
 	Iterations int
 	SortBy     []string
 	MountnsMap *ebpf.Map
+	// AlignToClock ends the intervals on multiples of the interval on the
+	// wall clock
+	AlignToClock bool
 }
 
 type Tracer struct {
@@ -236,9 +239,11 @@ func (t *Tracer) run(ctx context.Context) error {
 	// Don't use a context with a timeout but a counter to avoid having to deal
 	// with two timers: one for the timeout and another for the ticker.
 	count := t.config.Iterations
-	ticker := time.NewTicker(t.config.Interval)
+	ticker := top.NewTicker(t.config.Interval, t.config.AlignToClock)
 	defer ticker.Stop()
 
+	intervalStart := time.Now()
+
 	for {
 		select {
 		case <-t.done:
@@ -248,6 +253,8 @@ func (t *Tracer) run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
+			intervalEnd := time.Now()
+			ticker.Next()
 			stats, err := t.nextStats()
 			if err != nil {
 				return fmt.Errorf("getting next stats: %w", err)
@@ -257,7 +264,11 @@ func (t *Tracer) run(ctx context.Context) error {
 			if n > t.config.MaxRows {
 				n = t.config.MaxRows
 			}
-			t.eventCallback(&top.Event[types.Stats]{Stats: stats[:n]})
+			ev := &top.Event[types.Stats]{Stats: stats[:n]}
+			ev.SetInterval(intervalStart, intervalEnd)
+			intervalStart = intervalEnd
+
+			t.eventCallback(ev)
 
 			// Count down only if user requested a finite number of iterations
 			// through a timeout.
@@ -320,6 +331,7 @@ func (t *Tracer) init(gadgetCtx gadgets.GadgetContext) error {
 	t.config.MaxRows = params.Get(gadgets.ParamMaxRows).AsInt()
 	t.config.SortBy = params.Get(gadgets.ParamSortBy).AsStringSlice()
 	t.config.Interval = time.Second * time.Duration(params.Get(gadgets.ParamInterval).AsInt())
+	t.config.AlignToClock = params.Get(top.AlignToClockParam).AsBool()
 
 	var err error
 	if t.config.Iterations, err = top.ComputeIterations(t.config.Interval, gadgetCtx.Timeout()); err != nil {
@@ -0,0 +1,54 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// VerifierLogLines is the number of lines of the verifier log included by
+// DescribeError. The end of the log is kept as it explains why the program was
+// rejected.
+const VerifierLogLines = 20
+
+// DescribeError returns the message of err, the error returned when creating a
+// tracer. If it's caused by the verifier rejecting a program, the last lines
+// of the verifier log are added, so kernel compatibility issues can be
+// diagnosed from the error alone.
+func DescribeError(err error) string {
+	var ve *ebpf.VerifierError
+	if !errors.As(err, &ve) || len(ve.Log) == 0 {
+		return err.Error()
+	}
+
+	var b strings.Builder
+	b.WriteString(err.Error())
+	b.WriteString("\nverifier log:")
+
+	lines := ve.Log
+	if omitted := len(lines) - VerifierLogLines; omitted > 0 {
+		fmt.Fprintf(&b, "\n\t(%d line(s) omitted)", omitted)
+		lines = lines[omitted:]
+	}
+	for _, line := range lines {
+		b.WriteString("\n\t")
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -21,6 +21,7 @@ package tracer
 import (
 	gadgetregistry "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-registry"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/file/types"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/parser"
@@ -55,6 +56,7 @@ func (g *GadgetDesc) ParamDescs() params.ParamDescs {
 			Description:  "include non-regular file types (sockets, FIFOs, etc)",
 			TypeHint:     params.TypeBool,
 		},
+		top.AlignToClockParamDesc(),
 	}
 }
 
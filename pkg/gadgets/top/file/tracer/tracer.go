@@ -43,6 +43,9 @@ type Config struct {
 	Interval   time.Duration
 	Iterations int
 	SortBy     []string
+	// AlignToClock ends the intervals on multiples of the interval on the
+	// wall clock
+	AlignToClock bool
 }
 
 type Tracer struct {
@@ -206,9 +209,11 @@ func (t *Tracer) run(ctx context.Context) error {
 	// Don't use a context with a timeout but a counter to avoid having to deal
 	// with two timers: one for the timeout and another for the ticker.
 	count := t.config.Iterations
-	ticker := time.NewTicker(t.config.Interval)
+	ticker := top.NewTicker(t.config.Interval, t.config.AlignToClock)
 	defer ticker.Stop()
 
+	intervalStart := time.Now()
+
 	for {
 		select {
 		case <-t.done:
@@ -218,6 +223,8 @@ func (t *Tracer) run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
+			intervalEnd := time.Now()
+			ticker.Next()
 			stats, err := t.nextStats()
 			if err != nil {
 				return fmt.Errorf("getting next stats: %w", err)
@@ -227,7 +234,11 @@ func (t *Tracer) run(ctx context.Context) error {
 			if n > t.config.MaxRows {
 				n = t.config.MaxRows
 			}
-			t.eventCallback(&top.Event[types.Stats]{Stats: stats[:n]})
+			ev := &top.Event[types.Stats]{Stats: stats[:n]}
+			ev.SetInterval(intervalStart, intervalEnd)
+			intervalStart = intervalEnd
+
+			t.eventCallback(ev)
 
 			// Count down only if user requested a finite number of iterations
 			// through a timeout.
@@ -286,6 +297,7 @@ func (t *Tracer) init(gadgetCtx gadgets.GadgetContext) error {
 	t.config.MaxRows = params.Get(gadgets.ParamMaxRows).AsInt()
 	t.config.SortBy = params.Get(gadgets.ParamSortBy).AsStringSlice()
 	t.config.Interval = time.Second * time.Duration(params.Get(gadgets.ParamInterval).AsInt())
+	t.config.AlignToClock = params.Get(top.AlignToClockParam).AsBool()
 	t.config.AllFiles = params.Get(types.AllFilesParam).AsBool()
 
 	var err error
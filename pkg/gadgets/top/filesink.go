@@ -0,0 +1,205 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/go-units"
+)
+
+const (
+	// OutputFileParam appends the marshaled batches to a file on the node,
+	// for the setups where nothing consumes the events
+	OutputFileParam = "output-file"
+	// OutputFileMaxSizeParam is the size, e.g. "100MiB", the output file is
+	// rotated at
+	OutputFileMaxSizeParam = "output-file-max-size"
+
+	OutputFileMaxSizeDefault = "100MiB"
+)
+
+// OutputDir is the directory on the node the output files of the traces
+// created through the gadget CRs are kept in. Their names are relative to
+// it, as the gadget pod must not write anywhere else on the node.
+var OutputDir = "/var/lib/inspektor-gadget/top"
+
+// ResolveOutputFile returns the path of the output file named name in dir. It
+// fails if name is absolute or points outside of dir.
+func ResolveOutputFile(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("must be relative to %s", dir)
+	}
+	name = filepath.Clean(name)
+	if name == "." || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("must be a file in %s", dir)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// ParseOutputFileMaxSize parses the value of OutputFileMaxSizeParam, either a
+// number of bytes or a size with binary units, e.g. "100MiB". 0 disables the
+// rotation.
+func ParseOutputFileMaxSize(val string) (int64, error) {
+	size, err := units.RAMInBytes(val)
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	return size, nil
+}
+
+// FileSink appends the batches of marshaled stats to a file, one JSON object
+// per line. The writes are buffered until Flush or Close is called, or the
+// buffer is full. The file is rotated before the batch that would make it
+// exceed its maximum size: the previous one is kept with the ".1" suffix,
+// replacing any older one, so a batch is never split across files.
+type FileSink struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+
+	file *os.File
+	w    *bufio.Writer
+	size int64
+}
+
+// NewFileSink opens the file at path to append to it, creating it if needed.
+// A maxSize of 0 never rotates it. The FileSink must be closed once the
+// tracer is stopped.
+func NewFileSink(path string, maxSize int64) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening output file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("getting size of output file: %w", err)
+	}
+
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	s.size = info.Size()
+	return nil
+}
+
+// Write appends the lines of a batch to the file, rotating it first if
+// needed
+func (s *FileSink) Write(lines []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("output file is closed")
+	}
+
+	n := int64(0)
+	for _, line := range lines {
+		n += int64(len(line)) + 1
+	}
+
+	// A batch larger than the maximum size still goes to a file of its own
+	// The batch is still appended to the current file if it can't be
+	// rotated, the error is only reported once it's written
+	var rotateErr error
+	if s.maxSize > 0 && s.size > 0 && s.size+n > s.maxSize {
+		rotateErr = s.rotate()
+		if s.file == nil {
+			return rotateErr
+		}
+	}
+
+	for _, line := range lines {
+		if _, err := s.w.WriteString(line); err != nil {
+			return fmt.Errorf("writing output file: %w", err)
+		}
+		if err := s.w.WriteByte('\n'); err != nil {
+			return fmt.Errorf("writing output file: %w", err)
+		}
+	}
+	s.size += n
+	return rotateErr
+}
+
+// rotate renames the file with the ".1" suffix and opens a new one. The
+// original file is opened again if it can't be renamed.
+func (s *FileSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		err = fmt.Errorf("rotating output file: %w", err)
+		if openErr := s.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) closeFile() error {
+	err := s.w.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file, s.w = nil, nil
+	if err != nil {
+		return fmt.Errorf("closing output file: %w", err)
+	}
+	return nil
+}
+
+// Flush writes the buffered lines to the file
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("flushing output file: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the buffered lines and closes the file. Write must not be
+// called anymore then. Calling it more than once has no effect.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.closeFile()
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcptop.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{\"old\":true}\n"), 0o644))
+
+	s, err := NewFileSink(path, 40)
+	require.NoError(t, err)
+
+	// Buffered until flushed
+	require.NoError(t, s.Write([]string{`{"a":1}`, `{"b":2}`}))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"old\":true}\n", string(content))
+
+	require.NoError(t, s.Flush())
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"old\":true}\n{\"a\":1}\n{\"b\":2}\n", string(content))
+
+	// 29 bytes are written, the next batch doesn't fit anymore
+	require.NoError(t, s.Write([]string{`{"c":3}`, `{"d":4}`}))
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"c\":3}\n{\"d\":4}\n", string(content))
+	content, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "{\"old\":true}\n{\"a\":1}\n{\"b\":2}\n", string(content))
+
+	require.Error(t, s.Write([]string{`{"e":5}`}))
+}
+
+func TestFileSinkNoRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcptop.jsonl")
+
+	s, err := NewFileSink(path, 0)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Write([]string{`{"a":1}`}))
+	}
+	require.NoError(t, s.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(80), info.Size())
+	require.NoFileExists(t, path+".1")
+
+	_, err = NewFileSink(filepath.Join(t.TempDir(), "missing", "tcptop.jsonl"), 0)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFileSinkRotationError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcptop.jsonl")
+
+	// The file can't be renamed over a directory that isn't empty
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755))
+
+	s, err := NewFileSink(path, 10)
+	require.NoError(t, err)
+	require.NoError(t, s.Write([]string{`{"a":1}`}))
+	require.Error(t, s.Write([]string{`{"b":2}`}))
+
+	// The sink keeps appending to the original file
+	require.Error(t, s.Write([]string{`{"c":3}`}))
+	require.NoError(t, s.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{\"a\":1}\n{\"b\":2}\n{\"c\":3}\n", string(content))
+}
+
+func TestResolveOutputFile(t *testing.T) {
+	for name, expected := range map[string]string{
+		"tcptop.jsonl":         "/data/tcptop.jsonl",
+		"./tcptop.jsonl":       "/data/tcptop.jsonl",
+		"node/tcptop.jsonl":    "/data/node/tcptop.jsonl",
+		"node/../tcptop.jsonl": "/data/tcptop.jsonl",
+		"..tcptop.jsonl":       "/data/..tcptop.jsonl",
+	} {
+		path, err := ResolveOutputFile("/data", name)
+		require.NoError(t, err, name)
+		require.Equal(t, expected, path, name)
+	}
+
+	for _, name := range []string{
+		"",
+		".",
+		"..",
+		"../tcptop.jsonl",
+		"node/../../tcptop.jsonl",
+		"/etc/passwd",
+		"/data/tcptop.jsonl",
+	} {
+		_, err := ResolveOutputFile("/data", name)
+		require.Error(t, err, name)
+	}
+}
+
+func TestParseOutputFileMaxSize(t *testing.T) {
+	for val, expected := range map[string]int64{
+		"0":      0,
+		"1024":   1024,
+		"100MiB": 100 << 20,
+		"1g":     1 << 30,
+	} {
+		size, err := ParseOutputFileMaxSize(val)
+		require.NoError(t, err, val)
+		require.Equal(t, expected, size, val)
+	}
+
+	for _, invalid := range []string{"", "abc", "-1"} {
+		_, err := ParseOutputFileMaxSize(invalid)
+		require.Error(t, err, invalid)
+	}
+}
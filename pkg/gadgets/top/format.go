@@ -0,0 +1,83 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"github.com/docker/go-units"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+)
+
+// HumanReadableParam renders the columns having a formatter in a
+// human-readable way, e.g. "1.5KiB" instead of 1536
+const HumanReadableParam = "human-readable"
+
+// ColumnFormatter renders a numeric column of T in the text output. It's
+// installed as the extractor of the column, which the JSON output doesn't use,
+// so JSON consumers always get the raw numbers.
+type ColumnFormatter[T any] struct {
+	// Value returns the raw value of the column
+	Value func(*T) uint64
+	// Format renders a value in a human-readable way
+	Format func(uint64) string
+}
+
+// BytesFormatter renders a number of bytes with binary units, e.g. "1.5KiB"
+func BytesFormatter[T any](value func(*T) uint64) ColumnFormatter[T] {
+	return ColumnFormatter[T]{
+		Value: value,
+		Format: func(v uint64) string {
+			return units.BytesSize(float64(v))
+		},
+	}
+}
+
+// BytesRateFormatter renders a number of bytes per second with binary units,
+// e.g. "1.5KiB/s"
+func BytesRateFormatter[T any](value func(*T) uint64) ColumnFormatter[T] {
+	return ColumnFormatter[T]{
+		Value: value,
+		Format: func(v uint64) string {
+			return units.BytesSize(float64(v)) + "/s"
+		},
+	}
+}
+
+// Formatters maps the names of the columns of T to their formatter
+type Formatters[T any] map[string]ColumnFormatter[T]
+
+// Register sets the formatter of the given column, replacing the previous one
+// if any
+func (f Formatters[T]) Register(column string, formatter ColumnFormatter[T]) {
+	f[column] = formatter
+}
+
+// Apply installs the formatters as the extractors of their columns. The
+// values are rendered in a human-readable way if humanReadable is set, and as
+// raw numbers otherwise. Sorting always uses the raw values.
+func (f Formatters[T]) Apply(cols *columns.Columns[T], humanReadable bool) {
+	for name, formatter := range f {
+		formatter := formatter
+		if humanReadable {
+			cols.MustSetExtractor(name, func(stats *T) any {
+				return formatter.Format(formatter.Value(stats))
+			})
+		} else {
+			cols.MustSetExtractor(name, func(stats *T) any {
+				return formatter.Value(stats)
+			})
+		}
+	}
+}
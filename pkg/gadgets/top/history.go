@@ -0,0 +1,70 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"sync"
+)
+
+// History keeps the last events reported by a top gadget, so that they can be
+// retrieved even if nobody was consuming them when they were reported
+type History[T any] struct {
+	mu     sync.Mutex
+	events []*Event[T]
+	// next is the index where the next event is stored
+	next int
+	full bool
+}
+
+// NewHistory returns a History keeping the last depth events. It returns nil
+// if depth is zero or negative.
+func NewHistory[T any](depth int) *History[T] {
+	if depth <= 0 {
+		return nil
+	}
+	return &History[T]{events: make([]*Event[T], depth)}
+}
+
+// Add stores ev, dropping the oldest event if the history is full. It's a
+// no-op on a nil History.
+func (h *History[T]) Add(ev *Event[T]) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.events[h.next] = ev
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Events returns the stored events, from the oldest to the newest
+func (h *History[T]) Events() []*Event[T] {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]*Event[T](nil), h.events[:h.next]...)
+	}
+	return append(append([]*Event[T](nil), h.events[h.next:]...), h.events[:h.next]...)
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DropOnBackpressureParam makes the gadget drop the oldest batches that a slow
+// consumer didn't get yet instead of stalling the tracer
+const DropOnBackpressureParam = "drop-on-backpressure"
+
+// PublisherQueueSize is the number of batches a Publisher keeps for a slow
+// consumer before dropping the oldest one
+const PublisherQueueSize = 16
+
+// Publisher hands the batches of marshaled stats reported by a tracer over to
+// a consumer in its own goroutine, so that a slow consumer doesn't delay the
+// collection of the next interval. Once PublisherQueueSize batches are waiting,
+// the oldest one is dropped for each new batch.
+type Publisher struct {
+	queue   chan []string
+	publish func(line string)
+	dropped atomic.Uint64
+
+	done      chan struct{}
+	exited    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPublisher returns a Publisher calling publish for each line of the
+// batches it's given. It must be closed once the tracer is stopped.
+func NewPublisher(publish func(line string)) *Publisher {
+	p := &Publisher{
+		queue:   make(chan []string, PublisherQueueSize),
+		publish: publish,
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+func (p *Publisher) run() {
+	defer close(p.exited)
+
+	for {
+		select {
+		case <-p.done:
+			// Flush the batches queued before Close
+			for {
+				select {
+				case lines := <-p.queue:
+					p.publishBatch(lines)
+				default:
+					return
+				}
+			}
+		case lines := <-p.queue:
+			p.publishBatch(lines)
+		}
+	}
+}
+
+func (p *Publisher) publishBatch(lines []string) {
+	for _, line := range lines {
+		p.publish(line)
+	}
+}
+
+// Publish queues a batch without blocking, dropping the oldest queued batch
+// if the queue is full. It must not be called concurrently.
+func (p *Publisher) Publish(lines []string) {
+	select {
+	case p.queue <- lines:
+		return
+	default:
+	}
+
+	select {
+	case <-p.queue:
+		p.dropped.Add(1)
+	default:
+		// The consumer just took one
+	}
+
+	select {
+	case p.queue <- lines:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of batches dropped so far
+func (p *Publisher) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// Close publishes the batches still queued and stops. Publish must not be
+// called anymore then. Calling it more than once has no effect.
+func (p *Publisher) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		<-p.exited
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// socketInodes is a set of socket inodes
+type socketInodes map[uint64]struct{}
+
+// readTCPInodes returns the inodes of the TCP sockets of the network namespace
+// the process whose proc directory is procDir lives in, as listed in net/tcp
+// and net/tcp6.
+func readTCPInodes(procDir string) (socketInodes, error) {
+	inodes := socketInodes{}
+
+	for _, name := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(procDir, "net", name))
+		if err != nil {
+			// IPv6 could be disabled
+			if name == "tcp6" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		err = parseTCPInodes(f, inodes)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", name, err)
+		}
+	}
+
+	return inodes, nil
+}
+
+// parseTCPInodes adds the inodes of the sockets listed in r, in the format of
+// /proc/net/tcp{,6}, to inodes. The sockets without inode, e.g. in the
+// TIME_WAIT state, don't belong to any process and are skipped.
+func parseTCPInodes(r io.Reader, inodes socketInodes) error {
+	scanner := bufio.NewScanner(r)
+
+	// Skip header
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing inode %q: %w", fields[9], err)
+		}
+		if inode != 0 {
+			inodes[inode] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// countSockets returns the number of file descriptors of the process whose
+// proc directory is procDir that refer to one of the given sockets
+func countSockets(procDir string, inodes socketInodes) (uint64, error) {
+	fdDir := filepath.Join(procDir, "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint64
+	for _, fd := range fds {
+		// The file descriptor could have been closed in the meantime
+		target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil {
+			continue
+		}
+
+		inode, ok := socketInode(target)
+		if !ok {
+			continue
+		}
+		if _, ok := inodes[inode]; ok {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// socketInode returns the inode of the socket a file descriptor links to, e.g.
+// "socket:[12345]", and false if it isn't a socket
+func socketInode(target string) (uint64, bool) {
+	inodeStr, ok := strings.CutPrefix(target, "socket:[")
+	if !ok {
+		return 0, false
+	}
+	inodeStr, ok = strings.CutSuffix(inodeStr, "]")
+	if !ok {
+		return 0, false
+	}
+
+	inode, err := strconv.ParseUint(inodeStr, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
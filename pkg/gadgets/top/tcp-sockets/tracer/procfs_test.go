@@ -0,0 +1,72 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTCPInodes(t *testing.T) {
+	const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000   101        0 20117 1 0000000000000000 100 0 0 10 5
+   1: 0F02000A:D2A6 2E5C6DA2:01BB 01 00000000:00000000 02:0000073E 00000000  1000        0 47384 2 0000000000000000 24 4 28 10 -1
+   2: 0F02000A:D2A8 2E5C6DA2:01BB 06 00000000:00000000 03:000016A3 00000000     0        0 0 3 0000000000000000
+`
+
+	inodes := socketInodes{}
+	require.NoError(t, parseTCPInodes(strings.NewReader(procNetTCP), inodes))
+	require.Equal(t, socketInodes{20117: {}, 47384: {}}, inodes)
+}
+
+func TestCountSockets(t *testing.T) {
+	procDir := t.TempDir()
+	fdDir := filepath.Join(procDir, "fd")
+	require.NoError(t, os.Mkdir(fdDir, 0o755))
+
+	links := map[string]string{
+		"0": "/dev/null",
+		"3": "socket:[20117]",
+		"4": "socket:[47384]",
+		// A UDP or a Unix socket
+		"5": "socket:[99999]",
+		"6": "anon_inode:[eventfd]",
+	}
+	for fd, target := range links {
+		require.NoError(t, os.Symlink(target, filepath.Join(fdDir, fd)))
+	}
+
+	count, err := countSockets(procDir, socketInodes{20117: {}, 47384: {}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), count)
+
+	_, err = countSockets(filepath.Join(procDir, "gone"), socketInodes{})
+	require.Error(t, err)
+}
+
+func TestSocketInode(t *testing.T) {
+	inode, ok := socketInode("socket:[12345]")
+	require.True(t, ok)
+	require.Equal(t, uint64(12345), inode)
+
+	for _, target := range []string{"pipe:[12345]", "socket:[abc]", "socket:12345", "/dev/null"} {
+		_, ok := socketInode(target)
+		require.False(t, ok, target)
+	}
+}
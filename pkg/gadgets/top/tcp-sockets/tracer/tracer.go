@@ -0,0 +1,263 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cilium/ebpf"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+	containerutils "github.com/inspektor-gadget/inspektor-gadget/pkg/container-utils"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp-sockets/types"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
+)
+
+type Config struct {
+	MountnsMap *ebpf.Map
+	// TargetPid only counts the sockets of this process, unless it's 0
+	TargetPid  int32
+	MaxRows    int
+	Interval   time.Duration
+	Iterations int
+	SortBy     []string
+	// AlignToClock ends the intervals on multiples of the interval on the
+	// wall clock
+	AlignToClock bool
+}
+
+// Tracer counts the TCP sockets open by each process at the end of each
+// interval. The counts are read from procfs: the eBPF program of tcptop only
+// sees the sockets that transfer data, not the idle ones a leak leaves behind.
+type Tracer struct {
+	config        *Config
+	enricher      gadgets.DataEnricherByMntNs
+	eventCallback func(*top.Event[types.Stats])
+	done          chan bool
+	colMap        columns.ColumnMap[types.Stats]
+}
+
+func NewTracer(config *Config, enricher gadgets.DataEnricherByMntNs,
+	eventCallback func(*top.Event[types.Stats]),
+) (*Tracer, error) {
+	t := &Tracer{
+		config:        config,
+		enricher:      enricher,
+		eventCallback: eventCallback,
+		done:          make(chan bool),
+	}
+
+	statCols, err := columns.NewColumns[types.Stats]()
+	if err != nil {
+		return nil, err
+	}
+	t.colMap = statCols.GetColumnMap()
+
+	go t.run(context.TODO())
+
+	return t, nil
+}
+
+// Stop stops the tracer
+// TODO: Remove after refactoring
+func (t *Tracer) Stop() {
+	close(t.done)
+}
+
+func (t *Tracer) nextStats() ([]*types.Stats, error) {
+	stats := []*types.Stats{}
+
+	pids := []int{int(t.config.TargetPid)}
+	if t.config.TargetPid == 0 {
+		items, err := os.ReadDir(host.HostProcFs)
+		if err != nil {
+			return nil, err
+		}
+
+		pids = pids[:0]
+		for _, item := range items {
+			if pid, err := strconv.Atoi(item.Name()); err == nil && item.IsDir() {
+				pids = append(pids, pid)
+			}
+		}
+	}
+
+	// Processes sharing a network namespace share its socket table
+	inodesByNetns := make(map[uint64]socketInodes)
+
+	for _, pid := range pids {
+		// Errors mean that the process is gone, it's skipped then
+		mntnsID, err := containerutils.GetMntNs(pid)
+		if err != nil {
+			continue
+		}
+		if t.config.MountnsMap != nil {
+			var val uint32
+			if err := t.config.MountnsMap.Lookup(&mntnsID, &val); err != nil {
+				continue
+			}
+		}
+
+		netnsID, err := containerutils.GetNetNs(pid)
+		if err != nil {
+			continue
+		}
+		procDir := filepath.Join(host.HostProcFs, strconv.Itoa(pid))
+		inodes, ok := inodesByNetns[netnsID]
+		if !ok {
+			inodes, err = readTCPInodes(procDir)
+			if err != nil {
+				continue
+			}
+			inodesByNetns[netnsID] = inodes
+		}
+
+		count, err := countSockets(procDir, inodes)
+		if err != nil || count == 0 {
+			continue
+		}
+
+		stat := types.Stats{
+			WithMountNsID: eventtypes.WithMountNsID{MountNsID: mntnsID},
+			Pid:           int32(pid),
+			Comm:          host.GetProcComm(pid),
+			SocketCount:   count,
+		}
+
+		if t.enricher != nil {
+			t.enricher.EnrichByMntNs(&stat.CommonData, stat.MountNsID)
+		}
+
+		stats = append(stats, &stat)
+	}
+
+	top.SortStats(stats, t.config.SortBy, &t.colMap)
+
+	return stats, nil
+}
+
+func (t *Tracer) run(ctx context.Context) error {
+	// Don't use a context with a timeout but a counter to avoid having to deal
+	// with two timers: one for the timeout and another for the ticker.
+	count := t.config.Iterations
+	ticker := top.NewTicker(t.config.Interval, t.config.AlignToClock)
+	defer ticker.Stop()
+
+	intervalStart := time.Now()
+
+	for {
+		select {
+		case <-t.done:
+			// TODO: Once we completely move to use Run instead of NewTracer,
+			// we can remove this as nobody will directly call Stop (cleanup).
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			intervalEnd := time.Now()
+			ticker.Next()
+			stats, err := t.nextStats()
+			if err != nil {
+				return fmt.Errorf("getting next stats: %w", err)
+			}
+
+			n := len(stats)
+			if n > t.config.MaxRows {
+				n = t.config.MaxRows
+			}
+			ev := &top.Event[types.Stats]{Stats: stats[:n]}
+			ev.SetInterval(intervalStart, intervalEnd)
+			intervalStart = intervalEnd
+
+			t.eventCallback(ev)
+
+			// Count down only if user requested a finite number of iterations
+			// through a timeout.
+			if t.config.Iterations > 0 {
+				count--
+				if count == 0 {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) Run(gadgetCtx gadgets.GadgetContext) error {
+	if err := t.init(gadgetCtx); err != nil {
+		return fmt.Errorf("initializing tracer: %w", err)
+	}
+
+	return t.run(gadgetCtx.Context())
+}
+
+func (t *Tracer) SetEventHandlerArray(handler any) {
+	nh, ok := handler.(func(ev []*types.Stats))
+	if !ok {
+		panic("event handler invalid")
+	}
+
+	// TODO: add errorHandler
+	t.eventCallback = func(ev *top.Event[types.Stats]) {
+		if ev.Error != "" {
+			return
+		}
+		nh(ev.Stats)
+	}
+}
+
+func (t *Tracer) SetMountNsMap(mntnsMap *ebpf.Map) {
+	t.config.MountnsMap = mntnsMap
+}
+
+func (g *GadgetDesc) NewInstance() (gadgets.Gadget, error) {
+	tracer := &Tracer{
+		config: &Config{},
+		done:   make(chan bool),
+	}
+	return tracer, nil
+}
+
+func (t *Tracer) init(gadgetCtx gadgets.GadgetContext) error {
+	params := gadgetCtx.GadgetParams()
+	t.config.MaxRows = params.Get(gadgets.ParamMaxRows).AsInt()
+	t.config.SortBy = params.Get(gadgets.ParamSortBy).AsStringSlice()
+	t.config.Interval = time.Second * time.Duration(params.Get(gadgets.ParamInterval).AsInt())
+	t.config.AlignToClock = params.Get(top.AlignToClockParam).AsBool()
+	t.config.TargetPid = params.Get(types.PidParam).AsInt32()
+
+	var err error
+	if t.config.Iterations, err = top.ComputeIterations(t.config.Interval, gadgetCtx.Timeout()); err != nil {
+		return err
+	}
+
+	statCols, err := columns.NewColumns[types.Stats]()
+	if err != nil {
+		return err
+	}
+	t.colMap = statCols.GetColumnMap()
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+// SortByDefault sorts the processes having the most sockets open first
+var SortByDefault = []string{"-sockets"}
+
+const (
+	PidParam = "pid"
+)
+
+// Stats represents the TCP sockets a process has open
+type Stats struct {
+	eventtypes.CommonData
+	eventtypes.WithMountNsID
+
+	Pid  int32  `json:"pid,omitempty" column:"pid,template:pid"`
+	Comm string `json:"comm,omitempty" column:"comm,template:comm"`
+
+	// SocketCount is the number of file descriptors of the process that
+	// refer to a TCP socket, at the end of the interval
+	SocketCount uint64 `json:"socketCount" column:"sockets,order:1000" columnDesc:"Number of TCP sockets the process has open."`
+}
+
+func GetColumns() *columns.Columns[Stats] {
+	return columns.MustCreateColumns[Stats]()
+}
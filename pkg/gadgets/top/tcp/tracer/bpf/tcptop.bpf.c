@@ -23,11 +23,34 @@ struct {
 	__type(value, struct traffic_t);
 } ip_map SEC(".maps");
 
+/*
+ * Direction of the sockets connected or accepted since the tracer started.
+ * The entries aren't removed once the sockets are closed: a socket reusing
+ * the same memory is connected or accepted again before any traffic.
+ */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 10240);
+	__type(key, struct sock *);
+	__type(value, __u8);
+} sock_direction SEC(".maps");
+
+static __always_inline void set_direction(struct sock *sk, __u8 direction)
+{
+	if (gadget_should_discard_mntns_id(gadget_get_current_mntns_id()))
+		return;
+
+	bpf_map_update_elem(&sock_direction, &sk, &direction, BPF_ANY);
+}
+
 static int probe_ip(bool receiving, struct sock *sk, size_t size)
 {
 	struct ip_key_t ip_key = {};
 	struct traffic_t *trafficp;
+	__u8 direction = DIRECTION_UNKNOWN;
+	__u8 *directionp;
 	u64 mntns_id;
+	u32 srtt_us;
 	u16 family;
 	u32 pid;
 
@@ -77,24 +100,42 @@ static int probe_ip(bool receiving, struct sock *sk, size_t size)
 			&sk->__sk_common.skc_v6_daddr.in6_u.u6_addr32);
 	}
 
+	/* srtt_us is stored multiplied by 8, see tcp_rtt_estimator() */
+	srtt_us = BPF_CORE_READ((struct tcp_sock *)sk, srtt_us) >> 3;
+
+	directionp = bpf_map_lookup_elem(&sock_direction, &sk);
+	if (directionp)
+		direction = *directionp;
+
 	trafficp = bpf_map_lookup_elem(&ip_map, &ip_key);
 	if (!trafficp) {
-		struct traffic_t zero;
+		struct traffic_t zero = {};
 
 		if (receiving) {
 			zero.sent = 0;
 			zero.received = size;
+			zero.sent_packets = 0;
+			zero.received_packets = 1;
 		} else {
 			zero.sent = size;
 			zero.received = 0;
+			zero.sent_packets = 1;
+			zero.received_packets = 0;
 		}
+		zero.srtt_us = srtt_us;
+		zero.direction = direction;
 
 		bpf_map_update_elem(&ip_map, &ip_key, &zero, BPF_NOEXIST);
 	} else {
-		if (receiving)
+		if (receiving) {
 			trafficp->received += size;
-		else
+			trafficp->received_packets++;
+		} else {
 			trafficp->sent += size;
+			trafficp->sent_packets++;
+		}
+		trafficp->srtt_us = srtt_us;
+		trafficp->direction = direction;
 
 		bpf_map_update_elem(&ip_map, &ip_key, trafficp, BPF_EXIST);
 	}
@@ -124,4 +165,22 @@ int BPF_KPROBE(ig_toptcp_clean, struct sock *sk, int copied)
 	return probe_ip(true, sk, copied);
 }
 
+/* Called by tcp_v4_connect() and tcp_v6_connect() */
+SEC("kprobe/tcp_connect")
+int BPF_KPROBE(ig_toptcp_conn, struct sock *sk)
+{
+	set_direction(sk, DIRECTION_ACTIVE);
+	return 0;
+}
+
+SEC("kretprobe/inet_csk_accept")
+int BPF_KRETPROBE(ig_toptcp_accpt, struct sock *sk)
+{
+	if (!sk)
+		return 0;
+
+	set_direction(sk, DIRECTION_PASSIVE);
+	return 0;
+}
+
 char LICENSE[] SEC("license") = "GPL";
@@ -5,6 +5,11 @@
 #define TASK_COMM_LEN 16
 #define IPV6_LEN 16
 
+/* Whether the connection was initiated or accepted by the process */
+#define DIRECTION_UNKNOWN 0
+#define DIRECTION_ACTIVE 1
+#define DIRECTION_PASSIVE 2
+
 struct ip_key_t {
 	__u8 saddr[IPV6_LEN];
 	__u8 daddr[IPV6_LEN];
@@ -19,6 +24,13 @@ struct ip_key_t {
 struct traffic_t {
 	size_t sent;
 	size_t received;
+	/* Number of calls sending or receiving data */
+	__u64 sent_packets;
+	__u64 received_packets;
+	/* Smoothed round trip time, in microseconds */
+	__u32 srtt_us;
+	/* DIRECTION_UNKNOWN if the connection was opened before the tracer */
+	__u8 direction;
 };
 
 #endif /* __TCPTOP_H */
@@ -0,0 +1,61 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/btfgen"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+// ErrMissingBTF is returned when the kernel doesn't expose its BTF, which the
+// eBPF programs need to be relocated, and none is available for it. The
+// errors wrapping it also wrap ebpf.ErrNotSupported.
+var ErrMissingBTF = fmt.Errorf("the kernel doesn't expose its BTF in /sys/kernel/btf/vmlinux and none is embedded for it: "+
+	"download the BTF of this kernel, e.g. from BTFHub (https://github.com/aquasecurity/btfhub-archive), "+
+	"and pass its path with the %q parameter", types.BTFPathParam)
+
+// loadKernelTypes returns the kernel types to relocate the eBPF programs
+// against: the ones of the BTF file at path if it's set, else the embedded
+// ones for kernels that don't expose their BTF. It returns nil to use the
+// BTF of the kernel.
+func loadKernelTypes(path string) (*btf.Spec, error) {
+	if path != "" {
+		spec, err := btf.LoadSpec(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading BTF from %q: %w", path, err)
+		}
+		return spec, nil
+	}
+
+	if spec := btfgen.GetBTFSpec(); spec != nil {
+		return spec, nil
+	}
+
+	if _, err := btf.LoadKernelSpec(); err != nil {
+		if errors.Is(err, ebpf.ErrNotSupported) {
+			return nil, fmt.Errorf("%w: %w", ErrMissingBTF, err)
+		}
+		return nil, fmt.Errorf("loading kernel BTF: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/ebpf/btf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadKernelTypes(t *testing.T) {
+	b, err := btf.NewBuilder([]btf.Type{&btf.Int{Name: "int", Size: 4, Encoding: btf.Signed}})
+	require.NoError(t, err)
+	raw, err := b.Marshal(nil, nil)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "vmlinux.btf")
+	require.NoError(t, os.WriteFile(path, raw, 0o644))
+
+	spec, err := loadKernelTypes(path)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	_, err = spec.AnyTypeByName("int")
+	require.NoError(t, err)
+
+	_, err = loadKernelTypes(filepath.Join(t.TempDir(), "missing.btf"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte("not BTF"), 0o644))
+	_, err = loadKernelTypes(path)
+	require.ErrorContains(t, err, `loading BTF from "`+path+`"`)
+}
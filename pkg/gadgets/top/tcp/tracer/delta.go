@@ -0,0 +1,63 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+// deltaSortBy sorts the stats by the largest change first in delta mode, the
+// comparator of the delta column comparing the absolute values
+const deltaSortBy = "-delta"
+
+// setDeltas sets the change of the bytes of each connection of current
+// compared to previous, the stats of the last interval. The connections of
+// previous that had no traffic during this interval are appended to stats
+// with zero bytes and a negative delta. It returns the stats to compare the
+// next interval with. The first interval, when previous is nil, has nothing
+// to compare with: all its deltas are left to zero.
+func setDeltas(
+	stats []*types.Stats, previous map[statsKey]types.Stats, current map[statsKey]*types.Stats,
+) ([]*types.Stats, map[statsKey]types.Stats) {
+	next := make(map[statsKey]types.Stats, len(current))
+	for key, stat := range current {
+		next[key] = *stat
+	}
+
+	if previous == nil {
+		return stats, next
+	}
+
+	for key, stat := range current {
+		prev := previous[key]
+		stat.Delta = int64(stat.Sent+stat.Received) - int64(prev.Sent+prev.Received)
+	}
+
+	for key, prev := range previous {
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		stat := prev
+		stat.Sent, stat.Received = 0, 0
+		stat.SentPackets, stat.ReceivedPackets = 0, 0
+		stat.Delta = -int64(prev.Sent + prev.Received)
+		stats = append(stats, &stat)
+	}
+
+	return stats, next
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+func TestSetDeltas(t *testing.T) {
+	keyA := statsKey{conn: tcptopIpKeyT{Pid: 1}}
+	keyB := statsKey{conn: tcptopIpKeyT{Pid: 2}}
+	keyC := statsKey{conn: tcptopIpKeyT{Pid: 3}}
+
+	// The first interval has nothing to compare with
+	a := &types.Stats{Pid: 1, Sent: 100, Received: 50}
+	b := &types.Stats{Pid: 2, Sent: 10}
+	stats, previous := setDeltas(
+		[]*types.Stats{a, b}, nil, map[statsKey]*types.Stats{keyA: a, keyB: b},
+	)
+	require.Equal(t, []*types.Stats{a, b}, stats)
+	require.Zero(t, a.Delta)
+	require.Zero(t, b.Delta)
+
+	// a shrinks, c appears and b has no traffic anymore
+	a = &types.Stats{Pid: 1, Sent: 20, Received: 10}
+	c := &types.Stats{Pid: 3, Received: 40}
+	stats, previous = setDeltas(
+		[]*types.Stats{a, c}, previous, map[statsKey]*types.Stats{keyA: a, keyC: c},
+	)
+	require.Len(t, stats, 3)
+	require.Equal(t, int64(-120), a.Delta)
+	require.Equal(t, int64(40), c.Delta)
+	require.Equal(t, &types.Stats{Pid: 2, Delta: -10}, stats[2])
+	// The raw values are kept
+	require.Equal(t, uint64(20), a.Sent)
+
+	// b is forgotten once reported without traffic
+	stats, _ = setDeltas(nil, previous, map[statsKey]*types.Stats{})
+	require.Len(t, stats, 2)
+	for _, stat := range stats {
+		require.NotEqual(t, int32(2), stat.Pid)
+	}
+}
+
+func TestSortByAbsoluteDelta(t *testing.T) {
+	stats := []*types.Stats{
+		{Pid: 1, Delta: 10},
+		{Pid: 2, Delta: -30},
+		{Pid: 3, Delta: 20},
+		{Pid: 4, Delta: 0},
+	}
+
+	cols := types.GetColumns()
+	sortStats(stats, []string{deltaSortBy}, &cols.ColumnMap)
+
+	pids := make([]int32, 0, len(stats))
+	for _, stat := range stats {
+		pids = append(pids, stat.Pid)
+	}
+	require.Equal(t, []int32{2, 3, 1, 4}, pids)
+}
+
+func TestGroupStatsDelta(t *testing.T) {
+	stats := testStats()
+	stats[0].Delta = 10
+	stats[1].Delta = -30
+
+	deltas := make(map[string]int64)
+	for _, group := range groupStats(stats, types.GroupByPod) {
+		deltas[group.Group] = group.Delta
+	}
+	require.Equal(t, map[string]int64{"default/pod1": -20, "default/pod2": 0, "": 0}, deltas)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/tcpbits"
+)
+
+// match returns true if the given stat passes the filters that are applied in
+// userspace. The mount namespace filter is already applied by the eBPF
+// program, as well as the PID one when there is a single PID and the family
+// one for IPv6. The Kubernetes filters rely
+// on the stat being enriched.
+func (c *Config) match(stat *types.Stats) bool {
+	if version := gadgets.IPVerFromAF(uint16(c.TargetFamily)); version != 0 && stat.IPVersion != version {
+		return false
+	}
+
+	if c.TargetRemotePort != 0 && int32(stat.DstEndpoint.Port) != c.TargetRemotePort {
+		return false
+	}
+
+	if c.TargetLocalPort != 0 && int32(stat.SrcEndpoint.Port) != c.TargetLocalPort {
+		return false
+	}
+
+	if c.TargetLocalAddr.IsValid() {
+		addr, err := netip.ParseAddr(stat.SrcEndpoint.Addr)
+		if err != nil || !c.TargetLocalAddr.Contains(addr.Unmap()) {
+			return false
+		}
+	}
+
+	if c.TargetComm != "" && !c.matchComm(stat.Comm) {
+		return false
+	}
+
+	if c.TargetNetNs != 0 && stat.NetNsID != c.TargetNetNs {
+		return false
+	}
+
+	_, included := c.TargetPids[stat.Pid]
+	if len(c.TargetPids) > 0 && !included {
+		return false
+	}
+
+	// The included PIDs win over the excluded ones
+	if !included && slices.Contains(c.ExcludePids, stat.Pid) {
+		return false
+	}
+
+	if c.TargetDirection != "" && c.TargetDirection != types.DirectionAll && stat.Direction != c.TargetDirection {
+		return false
+	}
+
+	if c.EstablishedOnly && stat.State != tcpbits.TCPState(tcpStateEstablished) {
+		return false
+	}
+
+	if c.ExcludeLoopback && isLoopback(stat.SrcEndpoint.Addr) && isLoopback(stat.DstEndpoint.Addr) {
+		return false
+	}
+
+	if c.MinBytes != 0 && stat.Sent+stat.Received < c.MinBytes {
+		return false
+	}
+
+	// The RTT is zero when it's unknown, the filter is a no-op then
+	if c.MinRtt != 0 && stat.RTT != 0 && time.Duration(stat.RTT)*time.Microsecond < c.MinRtt {
+		return false
+	}
+
+	// Host processes don't have any runtime
+	if c.TargetRuntime != "" && stat.Runtime.RuntimeName != c.TargetRuntime {
+		return false
+	}
+
+	if c.TargetK8sNamespace != "" || len(c.TargetK8sLabels) > 0 {
+		// Host processes don't have any Kubernetes metadata
+		if stat.K8s.PodName == "" {
+			return false
+		}
+
+		if c.TargetK8sNamespace != "" && stat.K8s.Namespace != c.TargetK8sNamespace {
+			return false
+		}
+
+		for key, value := range c.TargetK8sLabels {
+			if v, ok := stat.K8s.PodLabels[key]; !ok || v != value {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// unmapAddrs returns the IP version and the addresses of a connection of the
+// given family. The connections between IPv4-mapped IPv6 addresses, e.g.
+// ::ffff:10.0.0.1, are IPv4 traffic on an IPv6 socket: they're reported as
+// IPv4 ones, with dotted-quad addresses.
+func unmapAddrs(family uint16, saddr, daddr [16]byte) (int, string, string) {
+	ipversion := gadgets.IPVerFromAF(family)
+	if ipversion == 6 {
+		src, dst := netip.AddrFrom16(saddr), netip.AddrFrom16(daddr)
+		if src.Is4In6() && dst.Is4In6() {
+			return 4, src.Unmap().String(), dst.Unmap().String()
+		}
+	}
+
+	return ipversion, gadgets.IPStringFromBytes(saddr, ipversion), gadgets.IPStringFromBytes(daddr, ipversion)
+}
+
+// isLoopback returns whether addr is a loopback address, IPv4-mapped ones
+// included
+func isLoopback(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	return err == nil && ip.Unmap().IsLoopback()
+}
+
+// matchComm returns whether comm, as reported by the kernel, is TargetComm,
+// ignoring the case if CommIgnoreCase is set. As the kernel only keeps the
+// first types.TaskCommLen bytes of the process names, TargetComm is truncated
+// the same way: a longer name matches all the processes whose name starts
+// with the same types.TaskCommLen bytes.
+func (c *Config) matchComm(comm string) bool {
+	target := truncateComm(c.TargetComm)
+	if c.CommIgnoreCase {
+		return strings.EqualFold(comm, target)
+	}
+	return comm == target
+}
+
+// truncateComm truncates comm the same way the kernel does, so that a process
+// name longer than types.TaskCommLen still matches.
+func truncateComm(comm string) string {
+	if len(comm) > types.TaskCommLen {
+		return comm[:types.TaskCommLen]
+	}
+	return comm
+}
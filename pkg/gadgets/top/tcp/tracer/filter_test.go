@@ -0,0 +1,306 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+func TestMatchPorts(t *testing.T) {
+	withPorts := func(local, remote uint16) *types.Stats {
+		stat := &types.Stats{}
+		stat.SrcEndpoint.Port = local
+		stat.DstEndpoint.Port = remote
+		return stat
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		stat     *types.Stats
+		expected bool
+	}{
+		{name: "no filter", stat: withPorts(40000, 443), expected: true},
+		{name: "remote port", config: Config{TargetRemotePort: 443}, stat: withPorts(40000, 443), expected: true},
+		{name: "other remote port", config: Config{TargetRemotePort: 443}, stat: withPorts(443, 80), expected: false},
+		{name: "local port", config: Config{TargetLocalPort: 8080}, stat: withPorts(8080, 50000), expected: true},
+		{name: "other local port", config: Config{TargetLocalPort: 8080}, stat: withPorts(50000, 8080), expected: false},
+		{name: "both ports", config: Config{TargetLocalPort: 8080, TargetRemotePort: 50000}, stat: withPorts(8080, 50000), expected: true},
+		{name: "both ports, one differs", config: Config{TargetLocalPort: 8080, TargetRemotePort: 50001}, stat: withPorts(8080, 50000), expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, test.config.match(test.stat))
+		})
+	}
+}
+
+func TestMatchMinBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		minBytes uint64
+		stat     *types.Stats
+		expected bool
+	}{
+		{name: "no filter", stat: &types.Stats{}, expected: true},
+		{name: "above", minBytes: 1000, stat: &types.Stats{Sent: 800, Received: 300}, expected: true},
+		{name: "equal", minBytes: 1000, stat: &types.Stats{Sent: 1000}, expected: true},
+		{name: "below", minBytes: 1000, stat: &types.Stats{Sent: 500, Received: 499}, expected: false},
+		{name: "idle", minBytes: 1, stat: &types.Stats{}, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Config{MinBytes: test.minBytes}
+			require.Equal(t, test.expected, c.match(test.stat))
+		})
+	}
+}
+
+func TestMatchMinRtt(t *testing.T) {
+	c := &Config{MinRtt: 10 * time.Millisecond}
+
+	require.True(t, c.match(&types.Stats{RTT: 20000}))
+	require.True(t, c.match(&types.Stats{RTT: 10000}))
+	require.False(t, c.match(&types.Stats{RTT: 9999}))
+	require.True(t, c.match(&types.Stats{}), "unknown RTT must not be filtered out")
+
+	require.True(t, (&Config{}).match(&types.Stats{RTT: 1}))
+}
+
+func TestMatchEstablishedOnly(t *testing.T) {
+	c := &Config{EstablishedOnly: true}
+
+	require.True(t, c.match(&types.Stats{State: "ESTABLISHED"}))
+	require.False(t, c.match(&types.Stats{State: "TIME_WAIT"}))
+	require.False(t, c.match(&types.Stats{State: "CLOSE"}))
+
+	require.True(t, (&Config{}).match(&types.Stats{State: "CLOSE"}))
+}
+
+func TestMatchRuntime(t *testing.T) {
+	c := &Config{TargetRuntime: eventtypes.RuntimeNameContainerd}
+
+	withRuntime := func(name eventtypes.RuntimeName) *types.Stats {
+		stat := &types.Stats{}
+		stat.Runtime.RuntimeName = name
+		return stat
+	}
+
+	require.True(t, c.match(withRuntime(eventtypes.RuntimeNameContainerd)))
+	require.False(t, c.match(withRuntime(eventtypes.RuntimeNameDocker)))
+	require.False(t, c.match(withRuntime("")), "host processes are dropped")
+
+	require.True(t, (&Config{}).match(withRuntime(eventtypes.RuntimeNameDocker)))
+}
+
+func TestMatchRuntimeEnriched(t *testing.T) {
+	tr := newEnrichingTracer(&Config{TargetRuntime: eventtypes.RuntimeNameContainerd})
+
+	require.True(t, tr.config.match(newEnrichedStats(tr, 1)))
+	require.False(t, tr.config.match(newEnrichedStats(tr, 2)), "host processes are dropped")
+}
+
+func TestTruncateComm(t *testing.T) {
+	tests := []struct {
+		comm     string
+		expected string
+	}{
+		{comm: "", expected: ""},
+		{comm: "curl", expected: "curl"},
+		{comm: "exactly15chars_", expected: "exactly15chars_"},
+		{comm: "exactly16chars__", expected: "exactly16chars_"},
+		{comm: "Isolated Web Content", expected: "Isolated Web Co"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, truncateComm(test.comm), "comm %q", test.comm)
+	}
+}
+
+func TestMatchComm(t *testing.T) {
+	c := &Config{TargetComm: "Chrome"}
+	require.True(t, c.match(&types.Stats{Comm: "Chrome"}))
+	require.False(t, c.match(&types.Stats{Comm: "chrome"}), "matching is case-sensitive by default")
+
+	c.CommIgnoreCase = true
+	require.True(t, c.match(&types.Stats{Comm: "chrome"}))
+	require.True(t, c.match(&types.Stats{Comm: "CHROME"}))
+	require.False(t, c.match(&types.Stats{Comm: "chromium"}))
+
+	// The kernel only keeps the first 15 characters
+	c.TargetComm = "Isolated Web Content"
+	require.True(t, c.match(&types.Stats{Comm: "isolated web co"}))
+	require.False(t, c.match(&types.Stats{Comm: "isolated web"}))
+
+	require.True(t, (&Config{CommIgnoreCase: true}).match(&types.Stats{Comm: "curl"}))
+	require.True(t, (&Config{}).match(&types.Stats{Comm: "curl"}))
+}
+
+func TestMatchPids(t *testing.T) {
+	c := &Config{
+		TargetPids:  map[int32]struct{}{1: {}, 2: {}},
+		ExcludePids: []int32{2, 3},
+	}
+
+	require.True(t, c.match(&types.Stats{Pid: 1}))
+	require.True(t, c.match(&types.Stats{Pid: 2}), "included PIDs win over excluded ones")
+	require.False(t, c.match(&types.Stats{Pid: 3}))
+	require.False(t, c.match(&types.Stats{Pid: 4}))
+
+	c.TargetPids = nil
+	require.False(t, c.match(&types.Stats{Pid: 2}))
+	require.True(t, c.match(&types.Stats{Pid: 4}))
+}
+
+func TestMatchNetNs(t *testing.T) {
+	withNetNs := func(netns uint64) *types.Stats {
+		stat := &types.Stats{}
+		stat.NetNsID = netns
+		return stat
+	}
+
+	c := &Config{TargetNetNs: 4026531840}
+	require.True(t, c.match(withNetNs(4026531840)))
+	require.False(t, c.match(withNetNs(4026532000)))
+	// The namespace of the processes that exited is unknown
+	require.False(t, c.match(withNetNs(0)))
+
+	require.True(t, (&Config{}).match(withNetNs(4026532000)))
+}
+
+func TestMatchExcludeLoopback(t *testing.T) {
+	c := &Config{ExcludeLoopback: true}
+
+	withAddrs := func(src, dst string) *types.Stats {
+		stat := &types.Stats{}
+		stat.SrcEndpoint.Addr = src
+		stat.DstEndpoint.Addr = dst
+		return stat
+	}
+
+	require.False(t, c.match(withAddrs("127.0.0.1", "127.0.0.1")))
+	require.False(t, c.match(withAddrs("127.0.0.1", "127.0.0.53")))
+	require.False(t, c.match(withAddrs("::1", "::1")))
+	require.False(t, c.match(withAddrs("::ffff:127.0.0.1", "::1")))
+	require.True(t, c.match(withAddrs("127.0.0.1", "10.0.0.1")), "one loopback endpoint isn't enough")
+	require.True(t, c.match(withAddrs("10.0.0.1", "10.0.0.2")))
+	require.True(t, c.match(withAddrs("", "")))
+
+	require.True(t, (&Config{}).match(withAddrs("127.0.0.1", "127.0.0.1")))
+}
+
+func TestUnmapAddrs(t *testing.T) {
+	addr := func(s string) [16]byte {
+		return netip.MustParseAddr(s).As16()
+	}
+
+	type testDefinition struct {
+		saddr, daddr      string
+		expectedVersion   int
+		expectedSrc       string
+		expectedDst       string
+		matchesIPv4Filter bool
+	}
+
+	tests := map[string]testDefinition{
+		"mapped": {
+			saddr:             "::ffff:10.0.0.1",
+			daddr:             "::ffff:10.0.0.2",
+			expectedVersion:   4,
+			expectedSrc:       "10.0.0.1",
+			expectedDst:       "10.0.0.2",
+			matchesIPv4Filter: true,
+		},
+		"ipv6": {
+			saddr:           "fd00::1",
+			daddr:           "fd00::2",
+			expectedVersion: 6,
+			expectedSrc:     "fd00::1",
+			expectedDst:     "fd00::2",
+		},
+		"only one mapped": {
+			saddr:           "::ffff:10.0.0.1",
+			daddr:           "fd00::2",
+			expectedVersion: 6,
+			expectedSrc:     "::ffff:10.0.0.1",
+			expectedDst:     "fd00::2",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, src, dst := unmapAddrs(syscall.AF_INET6, addr(test.saddr), addr(test.daddr))
+			require.Equal(t, test.expectedVersion, version)
+			require.Equal(t, test.expectedSrc, src)
+			require.Equal(t, test.expectedDst, dst)
+
+			stat := &types.Stats{IPVersion: version}
+			require.Equal(t, test.matchesIPv4Filter, (&Config{TargetFamily: syscall.AF_INET}).match(stat))
+			require.Equal(t, !test.matchesIPv4Filter, (&Config{TargetFamily: syscall.AF_INET6}).match(stat))
+			require.True(t, (&Config{TargetFamily: -1}).match(stat))
+		})
+	}
+
+	var ipv4 [16]byte
+	copy(ipv4[:], netip.MustParseAddr("10.0.0.1").AsSlice())
+	version, src, _ := unmapAddrs(syscall.AF_INET, ipv4, ipv4)
+	require.Equal(t, 4, version)
+	require.Equal(t, "10.0.0.1", src)
+}
+
+// newEnrichingTracer returns a tracer whose enricher, like the local manager
+// operator, adds the container and pod of mount namespace 1
+func newEnrichingTracer(config *Config) *Tracer {
+	t := &Tracer{config: config}
+	t.SetEventEnricher(func(ev any) error {
+		stat := ev.(*types.Stats)
+		if stat.MountNsID != 1 {
+			return nil
+		}
+		stat.K8s.Namespace = "default"
+		stat.K8s.PodName = "pod1"
+		stat.K8s.ContainerName = "c1"
+		stat.K8s.PodLabels = map[string]string{"app": "web"}
+		stat.Runtime.RuntimeName = eventtypes.RuntimeNameContainerd
+		stat.Runtime.ContainerName = "c1"
+		return nil
+	})
+	return t
+}
+
+func newEnrichedStats(t *Tracer, mntnsID uint64) *types.Stats {
+	stat := &types.Stats{WithMountNsID: eventtypes.WithMountNsID{MountNsID: mntnsID}}
+	t.enrich(stat)
+	return stat
+}
+
+func TestMatchK8sEnriched(t *testing.T) {
+	tr := newEnrichingTracer(&Config{
+		TargetK8sNamespace: "default",
+		TargetK8sLabels:    map[string]string{"app": "web"},
+	})
+
+	require.True(t, tr.config.match(newEnrichedStats(tr, 1)))
+	require.False(t, tr.config.match(newEnrichedStats(tr, 2)), "host processes are dropped")
+}
@@ -19,8 +19,11 @@
 package tracer
 
 import (
+	"strconv"
+
 	gadgetregistry "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-registry"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/parser"
@@ -51,16 +54,236 @@ func (g *GadgetDesc) ParamDescs() params.ParamDescs {
 		{
 			Key:          types.PidParam,
 			Title:        "PID",
-			Description:  "Show only TCP events generated by this particular PID (-1 for all)",
+			Description:  "Show only TCP events generated by this particular PID, or by any of these comma-separated PIDs (0 for all)",
+			DefaultValue: "0",
+			Validator: func(value string) error {
+				_, err := types.ParseTargetPids(value)
+				return err
+			},
+		},
+		{
+			Key:         types.ExcludePidsParam,
+			Title:       "Exclude PIDs",
+			Description: "Don't show TCP events generated by these comma-separated PIDs. The PIDs given to --pid are always shown.",
+			Validator: func(value string) error {
+				_, err := types.ParseExcludePids(value)
+				return err
+			},
+		},
+		{
+			Key:          types.FamilyParam,
+			Alias:        "f",
+			DefaultValue: "all",
+			Description:  "Show only TCP events for this IP version: either 4 (ipv4, v4) or 6 (ipv6, v6) (by default all will be printed)",
+			Validator: func(value string) error {
+				if value == "all" {
+					return nil
+				}
+				_, err := types.ParseFilterByFamily(value)
+				return err
+			},
+		},
+		{
+			Key:          types.RemotePortParam,
+			Title:        "Remote port",
+			Description:  "Show only TCP events to or from this remote port (0 for all)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeUint16,
+		},
+		{
+			Key:          types.LocalPortParam,
+			Title:        "Local port",
+			Description:  "Show only TCP events on this local port (0 for all)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeUint16,
+		},
+		{
+			Key:         types.LocalAddrParam,
+			Title:       "Local address",
+			Description: "Show only TCP events on this local IP address or CIDR, e.g. 10.0.0.0/8",
+			Validator: func(value string) error {
+				_, err := types.ParseLocalAddr(value)
+				return err
+			},
+		},
+		{
+			Key:         types.CommParam,
+			Title:       "Comm",
+			Description: "Show only TCP events generated by processes with this name",
+		},
+		{
+			Key:          types.CommIgnoreCaseParam,
+			Title:        "Comm ignore case",
+			Description:  "Match the process name given with comm regardless of the case. The kernel truncates the names to 15 characters, so are the ones given",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.NetNsParam,
+			Title:        "Network namespace",
+			Description:  "Show only TCP events of the processes in the network namespace with this inode, as shown in the netns column (0 for all)",
 			DefaultValue: "0",
-			TypeHint:     params.TypeInt32,
+			TypeHint:     params.TypeUint64,
+		},
+		{
+			Key:            types.DirectionParam,
+			Title:          "Direction",
+			Description:    "Show only connections initiated by the process (active) or accepted by it (passive). The direction of the connections opened before the gadget started is unknown, they're only shown with all.",
+			DefaultValue:   types.DirectionAll,
+			PossibleValues: []string{types.DirectionAll, types.DirectionActive, types.DirectionPassive},
+		},
+		{
+			Key:            types.RuntimeParam,
+			Title:          "Container runtime",
+			Description:    "Show only connections of the containers managed by this runtime, hiding the host processes",
+			DefaultValue:   types.RuntimeAll,
+			PossibleValues: types.Runtimes,
+		},
+		{
+			Key:          types.EstablishedOnlyParam,
+			Title:        "Established only",
+			Description:  "Show only connections in the ESTABLISHED state, hiding the ones being opened or closed, as reported in the state column",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.ExcludeLoopbackParam,
+			Title:        "Exclude loopback",
+			Description:  "Hide the connections whose both endpoints are loopback addresses (127.0.0.0/8 or ::1)",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.ExcludeKthreadsParam,
+			Title:        "Exclude kernel threads",
+			Description:  "Hide the connections of kernel threads, like the traffic handled on behalf of the idle task",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.CumulativeParam,
+			Title:        "Cumulative",
+			Description:  "Report bytes sent and received since the gadget started instead of during the last interval",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.DeltaParam,
+			Title:        "Delta",
+			Description:  "Show first the connections whose bytes changed the most compared to the previous interval, reported in the delta column. The first interval has no delta",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.HeartbeatParam,
+			Title:        "Heartbeat",
+			Description:  "Report the intervals without any connection as an empty heartbeat event",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		top.AlignToClockParamDesc(),
+		{
+			Key:            types.GroupByParam,
+			Title:          "Group by",
+			Description:    "Sum the bytes of all the connections of each container, pod or container image, shown in the group column",
+			DefaultValue:   types.GroupByNone,
+			PossibleValues: []string{types.GroupByNone, types.GroupByContainer, types.GroupByPod, types.GroupByImage},
+		},
+		{
+			Key:          types.PerGroupRowsParam,
+			Title:        "Per group rows",
+			Description:  "Show the top connections of each group instead of summing them, applying max-rows to each group",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.PerCPUParam,
+			Title:        "Per CPU",
+			Description:  "Report the traffic of each connection on each CPU separately, in the cpu column, instead of summing it",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          types.MinBytesParam,
+			Title:        "Minimum bytes",
+			Description:  "Don't show connections that sent and received less than this number of bytes combined (0 to show all)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeUint64,
+		},
+		{
+			Key:          types.MinRttParam,
+			Title:        "Minimum RTT",
+			Description:  "Show only connections whose smoothed round trip time is at least this number of milliseconds. Connections with an unknown RTT are always shown. (0 to show all)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeUint32,
+		},
+		{
+			Key:         types.K8sNamespaceParam,
+			Title:       "Kubernetes namespace",
+			Description: "Show only TCP events generated by pods in this namespace",
+			ValueHint:   gadgets.K8SNamespace,
+		},
+		{
+			Key:         types.K8sLabelsParam,
+			Title:       "Kubernetes labels",
+			Description: "Show only TCP events generated by pods with these labels. Only '=' is supported (e.g. key1=value1,key2=value2).",
+			ValueHint:   gadgets.K8SLabels,
+			Validator: func(value string) error {
+				_, err := types.ParseK8sLabels(value)
+				return err
+			},
+		},
+		{
+			Key:          types.DurationParam,
+			Title:        "Duration",
+			Description:  "Stop automatically after this number of seconds (0 to run until stopped)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeUint,
+		},
+		{
+			Key:          types.MaxConnectionsParam,
+			Title:        "Max connections",
+			Description:  "Number of connections tracked per interval. Lower it to save kernel memory (around 150 bytes per connection), at the cost of missing the traffic of the connections beyond it on busy hosts.",
+			DefaultValue: strconv.Itoa(types.MaxConnectionsDefault),
+			TypeHint:     params.TypeUint32,
+			Validator: func(value string) error {
+				_, err := types.ParseMaxConnections(value)
+				return err
+			},
+		},
+		{
+			Key:         types.BTFPathParam,
+			Title:       "BTF path",
+			Description: "Path of a BTF file describing the running kernel, e.g. from BTFHub, for kernels that don't expose their BTF in /sys/kernel/btf/vmlinux",
+		},
+		{
+			Key:         top.OutputFileParam,
+			Title:       "Output file",
+			Description: "Also append the events to this file, relative to " + top.OutputDir + ", one JSON object per interval",
+			Validator: func(value string) error {
+				if value == "" {
+					return nil
+				}
+				_, err := top.ResolveOutputFile(top.OutputDir, value)
+				return err
+			},
+		},
+		{
+			Key:          top.OutputFileMaxSizeParam,
+			Title:        "Output file max size",
+			Description:  "Size the output file is rotated at, e.g. 100MiB, the previous one being kept with the \".1\" suffix. 0 disables the rotation.",
+			DefaultValue: top.OutputFileMaxSizeDefault,
+			Validator: func(value string) error {
+				_, err := top.ParseOutputFileMaxSize(value)
+				return err
+			},
 		},
 		{
-			Key:            types.FamilyParam,
-			Alias:          "f",
-			DefaultValue:   "all",
-			Description:    "Show only TCP events for this IP version: either 4 or 6 (by default all will be printed)",
-			PossibleValues: []string{"all", "4", "6"},
+			Key:          top.HumanReadableParam,
+			Title:        "Human-readable",
+			Description:  "Show the bytes with units, e.g. 1.5KiB, in the columns output. The JSON output always has the raw numbers.",
+			DefaultValue: "true",
+			TypeHint:     params.TypeBool,
 		},
 	}
 }
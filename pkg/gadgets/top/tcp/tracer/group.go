@@ -0,0 +1,173 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+// groupKey returns the name of the group stat belongs to. Processes that don't
+// run in a container (or pod) all belong to the empty group. Images are
+// identified by their name and digest, if known, to tell builds apart.
+func groupKey(stat *types.Stats, groupBy string) string {
+	switch groupBy {
+	case types.GroupByContainer:
+		if stat.K8s.PodName != "" {
+			return stat.K8s.Namespace + "/" + stat.K8s.PodName + "/" + stat.K8s.ContainerName
+		}
+		return stat.Runtime.ContainerName
+	case types.GroupByPod:
+		if stat.K8s.PodName != "" {
+			return stat.K8s.Namespace + "/" + stat.K8s.PodName
+		}
+	case types.GroupByImage:
+		if stat.Runtime.ContainerImageDigest != "" {
+			return stat.Runtime.ContainerImageName + "@" + stat.Runtime.ContainerImageDigest
+		}
+		return stat.Runtime.ContainerImageName
+	}
+	return ""
+}
+
+// groupStats sums the bytes and packets sent and received by all the
+// connections of each group. The returned stats only keep the metadata shared
+// by the whole group.
+func groupStats(stats []*types.Stats, groupBy string) []*types.Stats {
+	if groupBy == types.GroupByNone {
+		return stats
+	}
+
+	groups := make(map[string]*types.Stats)
+	grouped := make([]*types.Stats, 0)
+
+	for _, stat := range stats {
+		key := groupKey(stat, groupBy)
+
+		group, ok := groups[key]
+		if !ok {
+			group = &types.Stats{Group: key, IsHost: true}
+			switch groupBy {
+			case types.GroupByContainer:
+				group.CommonData = stat.CommonData
+				group.WithMountNsID = stat.WithMountNsID
+				group.WithNetNsID = stat.WithNetNsID
+			case types.GroupByPod:
+				group.K8s = eventtypes.K8sMetadata{
+					Node: stat.K8s.Node,
+					BasicK8sMetadata: eventtypes.BasicK8sMetadata{
+						Namespace: stat.K8s.Namespace,
+						PodName:   stat.K8s.PodName,
+						PodLabels: stat.K8s.PodLabels,
+					},
+					HostNetwork: stat.K8s.HostNetwork,
+					Owner:       stat.K8s.Owner,
+				}
+			case types.GroupByImage:
+				group.K8s.Node = stat.K8s.Node
+				group.Runtime.ContainerImageName = stat.Runtime.ContainerImageName
+				group.Runtime.ContainerImageDigest = stat.Runtime.ContainerImageDigest
+			}
+			groups[key] = group
+			grouped = append(grouped, group)
+		}
+
+		// A group is only a host one if all its connections are, so it
+		// doesn't depend on the order of the stats
+		group.IsHost = group.IsHost && stat.IsHost
+		group.Sent += stat.Sent
+		group.Received += stat.Received
+		group.Total += stat.Total
+		group.SentPackets += stat.SentPackets
+		group.ReceivedPackets += stat.ReceivedPackets
+		group.Delta += stat.Delta
+		group.RTT = max(group.RTT, stat.RTT)
+	}
+
+	return grouped
+}
+
+// topPerGroup keeps the first maxRows connections of each group according to
+// sortBy, instead of summing them, so that groups with little traffic still
+// show up. The connections kept are then sorted together.
+func topPerGroup(stats []*types.Stats, groupBy string, maxRows int, sortBy []string, colMap *columns.ColumnMap[types.Stats]) []*types.Stats {
+	groups := make(map[string][]*types.Stats)
+	keys := make([]string, 0)
+
+	for _, stat := range stats {
+		key := groupKey(stat, groupBy)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		stat.Group = key
+		groups[key] = append(groups[key], stat)
+	}
+
+	merged := make([]*types.Stats, 0, len(stats))
+	for _, key := range keys {
+		group := groups[key]
+		sortStats(group, sortBy, colMap)
+		if len(group) > maxRows {
+			group = group[:maxRows]
+		}
+		merged = append(merged, group...)
+	}
+
+	sortStats(merged, sortBy, colMap)
+	return merged
+}
+
+// setPercentages sets the share of the bytes sent and received by all the
+// stats that each one represents
+func setPercentages(stats []*types.Stats) {
+	var sent, received uint64
+	for _, stat := range stats {
+		sent += stat.Sent
+		received += stat.Received
+	}
+
+	for _, stat := range stats {
+		stat.SentPct, stat.ReceivedPct = 0, 0
+		if sent > 0 {
+			stat.SentPct = 100 * float64(stat.Sent) / float64(sent)
+		}
+		if received > 0 {
+			stat.ReceivedPct = 100 * float64(stat.Received) / float64(received)
+		}
+	}
+}
+
+// setRates sets the bytes sent and received per second by each of the stats
+// over an interval that lasted d
+func setRates(stats []*types.Stats, d time.Duration) {
+	for _, stat := range stats {
+		stat.SentBps, stat.ReceivedBps = 0, 0
+		if d > 0 {
+			stat.SentBps = uint64(float64(stat.Sent) * float64(time.Second) / float64(d))
+			stat.ReceivedBps = uint64(float64(stat.Received) * float64(time.Second) / float64(d))
+		}
+	}
+}
+
+// sortStats sorts stats by sortBy and then by the columns identifying each
+// connection, so that connections with the same values don't swap places
+// between intervals as the eBPF map is iterated in no particular order.
+func sortStats(stats []*types.Stats, sortBy []string, colMap *columns.ColumnMap[types.Stats]) {
+	top.SortStats(stats, top.WithTiebreakers(sortBy, types.SortByTiebreakers), colMap)
+}
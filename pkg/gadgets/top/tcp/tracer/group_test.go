@@ -0,0 +1,288 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+func newTestStats(pod, container string, pid int32, sent uint64) *types.Stats {
+	stat := &types.Stats{Pid: pid, Sent: sent}
+	if pod != "" {
+		stat.K8s.Namespace = "default"
+		stat.K8s.PodName = pod
+		stat.K8s.ContainerName = container
+	}
+	stat.IsHost = types.IsHost(&stat.CommonData)
+	return stat
+}
+
+func testStats() []*types.Stats {
+	return []*types.Stats{
+		newTestStats("pod1", "c1", 1, 10),
+		newTestStats("pod1", "c2", 2, 20),
+		newTestStats("pod2", "c1", 3, 30),
+		newTestStats("pod1", "c1", 4, 40),
+		newTestStats("", "", 5, 50),
+	}
+}
+
+func TestGroupStats(t *testing.T) {
+	type group struct {
+		name string
+		sent uint64
+	}
+
+	tests := map[string]struct {
+		groupBy  string
+		expected []group
+	}{
+		"container": {
+			groupBy: types.GroupByContainer,
+			expected: []group{
+				{"default/pod1/c1", 50},
+				{"default/pod1/c2", 20},
+				{"default/pod2/c1", 30},
+				{"", 50},
+			},
+		},
+		"pod": {
+			groupBy: types.GroupByPod,
+			expected: []group{
+				{"default/pod1", 70},
+				{"default/pod2", 30},
+				{"", 50},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			grouped := groupStats(testStats(), test.groupBy)
+
+			groups := make([]group, 0, len(grouped))
+			for _, stat := range grouped {
+				require.Zero(t, stat.Pid)
+				groups = append(groups, group{stat.Group, stat.Sent})
+			}
+			require.Equal(t, test.expected, groups)
+		})
+	}
+
+	require.Len(t, groupStats(testStats(), types.GroupByNone), 5)
+}
+
+func TestGroupStatsPackets(t *testing.T) {
+	stats := testStats()
+	for i, stat := range stats {
+		stat.SentPackets = uint64(i + 1)
+		stat.ReceivedPackets = uint64(10 * (i + 1))
+	}
+
+	grouped := groupStats(stats, types.GroupByPod)
+	require.Len(t, grouped, 3)
+	require.Equal(t, uint64(1+2+4), grouped[0].SentPackets)
+	require.Equal(t, uint64(10+20+40), grouped[0].ReceivedPackets)
+	require.Equal(t, uint64(3), grouped[1].SentPackets)
+	require.Equal(t, uint64(30), grouped[1].ReceivedPackets)
+}
+
+func TestGroupStatsByImage(t *testing.T) {
+	stats := testStats()
+	for _, stat := range stats[:3] {
+		stat.Runtime.ContainerImageName = "docker.io/library/nginx:latest"
+		stat.Runtime.ContainerImageDigest = "sha256:aaa"
+	}
+	// Another build of the same image
+	stats[3].Runtime.ContainerImageName = "docker.io/library/nginx:latest"
+	stats[3].Runtime.ContainerImageDigest = "sha256:bbb"
+
+	grouped := groupStats(stats, types.GroupByImage)
+	require.Len(t, grouped, 3)
+
+	require.Equal(t, "docker.io/library/nginx:latest@sha256:aaa", grouped[0].Group)
+	require.Equal(t, uint64(60), grouped[0].Sent)
+	require.Equal(t, "sha256:aaa", grouped[0].Runtime.ContainerImageDigest)
+	require.Empty(t, grouped[0].K8s.PodName)
+
+	require.Equal(t, "docker.io/library/nginx:latest@sha256:bbb", grouped[1].Group)
+	require.Equal(t, uint64(40), grouped[1].Sent)
+
+	// Host processes
+	require.Equal(t, "", grouped[2].Group)
+	require.Equal(t, uint64(50), grouped[2].Sent)
+}
+
+func TestGroupStatsIsHost(t *testing.T) {
+	// A container that isn't part of a pod is in the same pod group as the
+	// host processes
+	runtimeOnly := &types.Stats{Pid: 6, Sent: 60}
+	runtimeOnly.Runtime.ContainerName = "c3"
+
+	for _, groupBy := range []string{types.GroupByContainer, types.GroupByPod} {
+		for _, reversed := range []bool{false, true} {
+			stats := append(testStats(), runtimeOnly)
+			if reversed {
+				slices.Reverse(stats)
+			}
+
+			isHost := make(map[string]bool)
+			for _, group := range groupStats(stats, groupBy) {
+				isHost[group.Group] = group.IsHost
+			}
+
+			switch groupBy {
+			case types.GroupByContainer:
+				require.Equal(t, map[string]bool{
+					"default/pod1/c1": false,
+					"default/pod1/c2": false,
+					"default/pod2/c1": false,
+					"c3":              false,
+					"":                true,
+				}, isHost)
+			case types.GroupByPod:
+				require.Equal(t, map[string]bool{
+					"default/pod1": false,
+					"default/pod2": false,
+					"":             false,
+				}, isHost)
+			}
+		}
+	}
+}
+
+func TestGroupStatsEnriched(t *testing.T) {
+	tr := newEnrichingTracer(&Config{})
+	stats := []*types.Stats{newEnrichedStats(tr, 1), newEnrichedStats(tr, 1), newEnrichedStats(tr, 2)}
+
+	groups := make([]string, 0)
+	for _, group := range groupStats(stats, types.GroupByPod) {
+		groups = append(groups, group.Group)
+	}
+	require.ElementsMatch(t, []string{"default/pod1", ""}, groups)
+}
+
+func TestIsHostEnriched(t *testing.T) {
+	tr := newEnrichingTracer(&Config{})
+	require.False(t, newEnrichedStats(tr, 1).IsHost)
+	require.True(t, newEnrichedStats(tr, 2).IsHost)
+
+	// Without an enricher nothing is known of the containers
+	require.True(t, newEnrichedStats(&Tracer{config: &Config{}}, 1).IsHost)
+}
+
+func TestTopPerGroup(t *testing.T) {
+	cols := types.GetColumns()
+	colMap := cols.GetColumnMap()
+
+	stats := topPerGroup(testStats(), types.GroupByPod, 1, []string{"-sent"}, &colMap)
+
+	pids := make([]int32, 0, len(stats))
+	for _, stat := range stats {
+		pids = append(pids, stat.Pid)
+	}
+	require.Equal(t, []int32{5, 4, 3}, pids)
+	require.Equal(t, "default/pod1", stats[1].Group)
+}
+
+func TestTopPerGroupEnriched(t *testing.T) {
+	cols := types.GetColumns()
+	colMap := cols.GetColumnMap()
+
+	tr := newEnrichingTracer(&Config{})
+	stats := []*types.Stats{newEnrichedStats(tr, 1), newEnrichedStats(tr, 1), newEnrichedStats(tr, 2)}
+	stats[0].Sent = 10
+	stats[1].Sent = 20
+
+	stats = topPerGroup(stats, types.GroupByPod, 1, []string{"-sent"}, &colMap)
+	require.Len(t, stats, 2, "one row for the pod and one for the host")
+	require.Equal(t, uint64(20), stats[0].Sent)
+	require.Equal(t, "default/pod1", stats[0].Group)
+}
+
+func TestSortStatsIsDeterministic(t *testing.T) {
+	cols := types.GetColumns()
+	colMap := cols.GetColumnMap()
+
+	newStat := func(pid int32, port uint16) *types.Stats {
+		stat := newTestStats("", "", pid, 100)
+		stat.SrcEndpoint.Addr = "10.0.0.1"
+		stat.SrcEndpoint.Port = port
+		return stat
+	}
+
+	var expected []string
+	for i := 0; i < 20; i++ {
+		stats := []*types.Stats{
+			newStat(2, 80), newStat(1, 443), newStat(1, 80), newStat(3, 22),
+		}
+		// Simulate the random order of the eBPF map iteration
+		rand.Shuffle(len(stats), func(i, j int) { stats[i], stats[j] = stats[j], stats[i] })
+
+		sortStats(stats, []string{"-sent"}, &colMap)
+
+		order := make([]string, 0, len(stats))
+		for _, stat := range stats {
+			order = append(order, fmt.Sprintf("%d/%d", stat.Pid, stat.SrcEndpoint.Port))
+		}
+		if expected == nil {
+			expected = order
+		}
+		require.Equal(t, expected, order)
+	}
+	require.Equal(t, []string{"1/80", "1/443", "2/80", "3/22"}, expected)
+}
+
+func TestSetPercentages(t *testing.T) {
+	stats := testStats()
+	stats[0].Received = 3
+	stats[1].Received = 1
+
+	setPercentages(stats)
+
+	// 150 bytes were sent and 4 received in total
+	sentPcts := make([]float64, 0, len(stats))
+	for _, stat := range stats {
+		sentPcts = append(sentPcts, stat.SentPct)
+	}
+	require.InDeltaSlice(t, []float64{100.0 / 15, 200.0 / 15, 20, 400.0 / 15, 100.0 / 3}, sentPcts, 1e-9)
+	require.Equal(t, 75.0, stats[0].ReceivedPct)
+	require.Equal(t, 25.0, stats[1].ReceivedPct)
+	require.Zero(t, stats[2].ReceivedPct)
+}
+
+func TestSetRates(t *testing.T) {
+	stats := testStats()
+	stats[0].Received = 3000
+
+	// The interval lasted longer than the requested one
+	setRates(stats, 1500*time.Millisecond)
+	require.Equal(t, uint64(6), stats[0].SentBps)
+	require.Equal(t, uint64(2000), stats[0].ReceivedBps)
+	require.Zero(t, stats[1].ReceivedBps)
+
+	setRates(stats, 0)
+	require.Zero(t, stats[0].SentBps)
+	require.Zero(t, stats[0].ReceivedBps)
+}
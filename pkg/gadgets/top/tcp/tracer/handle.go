@@ -0,0 +1,130 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+// Handle runs tcptop without the Trace CRD machinery, e.g. when embedding it
+// in another program.
+//
+// All the fields of Config are optional:
+//   - MountnsMap restricts the tracer to the mount namespaces in the map. All
+//     of them are traced if it's nil.
+//   - Interval defaults to one second, MaxRows to top.MaxRowsDefault and
+//     SortBy to types.SortByDefault.
+//   - TargetFamily traces both IPv4 and IPv6 when it's 0 or -1.
+//   - Iterations and Duration run the tracer until Stop is called when 0.
+//
+// The other fields keep their zero value meaning of "no filtering".
+type Handle struct {
+	config        *Config
+	enricher      gadgets.DataEnricherByMntNs
+	eventCallback func(*top.Event[types.Stats])
+
+	mu      sync.Mutex
+	tracer  *Tracer
+	exited  <-chan struct{}
+	stopped bool
+}
+
+// NewHandle returns a handle to run tcptop with the given configuration. The
+// tracer isn't loaded until Start is called. eventCallback is called with the
+// stats of each interval. enricher is optional and adds the container
+// metadata to the stats.
+func NewHandle(config *Config, enricher gadgets.DataEnricherByMntNs,
+	eventCallback func(*top.Event[types.Stats]),
+) (*Handle, error) {
+	if config == nil {
+		return nil, errors.New("config is required")
+	}
+	if eventCallback == nil {
+		return nil, errors.New("event callback is required")
+	}
+
+	c := *config
+	if c.Interval == 0 {
+		c.Interval = time.Second * top.IntervalDefault
+	}
+	if c.MaxRows == 0 {
+		c.MaxRows = top.MaxRowsDefault
+	}
+	if len(c.SortBy) == 0 {
+		c.SortBy = types.SortByDefault
+	}
+	if c.TargetFamily == 0 {
+		c.TargetFamily = -1
+	}
+
+	return &Handle{
+		config:        &c,
+		enricher:      enricher,
+		eventCallback: eventCallback,
+	}, nil
+}
+
+// Start loads the tracer and starts reporting stats. It fails if the handle
+// was already started or stopped.
+func (h *Handle) Start() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stopped {
+		return errors.New("tracer was stopped")
+	}
+	if h.tracer != nil {
+		return errors.New("tracer already started")
+	}
+
+	tracer, err := NewTracer(h.config, h.enricher, h.eventCallback)
+	if err != nil {
+		return err
+	}
+	h.tracer = tracer
+	h.exited = tracer.Exited()
+	return nil
+}
+
+// Stop stops the tracer and releases its resources. It's safe to call it
+// before Start, or more than once.
+func (h *Handle) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stopped = true
+	if h.tracer != nil {
+		h.tracer.Stop()
+		h.tracer = nil
+	}
+}
+
+// Done returns a channel that is closed once the tracer stopped reporting
+// stats, because Stop was called or because the configured duration or number
+// of iterations was reached. It returns nil if the handle wasn't started.
+func (h *Handle) Done() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.exited
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
+)
+
+// TCP_ESTABLISHED and TCP_CLOSE from include/net/tcp_states.h
+const (
+	tcpStateEstablished = 1
+	tcpStateClose       = 7
+)
+
+// socketKey identifies a TCP socket by its local and remote endpoints.
+// IPv4-mapped IPv6 addresses are stored unmapped.
+type socketKey struct {
+	local  netip.AddrPort
+	remote netip.AddrPort
+}
+
+// socketTable maps the TCP sockets of a network namespace to their state, as
+// reported by /proc/net/tcp and /proc/net/tcp6.
+type socketTable map[socketKey]uint8
+
+// socketTables caches the socket tables of several processes, so that each of
+// them is read at most once per interval.
+type socketTables map[int32]socketTable
+
+// lookup returns the state of the socket stat was collected for and whether
+// it's still open.
+func (s socketTables) lookup(stat *types.Stats) (uint8, bool) {
+	key, err := socketKeyFromStats(stat)
+	if err != nil {
+		return 0, false
+	}
+	state, ok := s.get(stat.Pid)[key]
+	return state, ok
+}
+
+// get returns the socket table of the given process, reading it if needed. It
+// returns nil if the process is gone.
+func (s socketTables) get(pid int32) socketTable {
+	table, ok := s[pid]
+	if !ok {
+		// An error means the process is gone, so are its connections
+		table, _ = readSocketTable(pid)
+		s[pid] = table
+	}
+	return table
+}
+
+func socketKeyFromStats(stat *types.Stats) (socketKey, error) {
+	local, err := netip.ParseAddr(stat.SrcEndpoint.Addr)
+	if err != nil {
+		return socketKey{}, fmt.Errorf("parsing local address: %w", err)
+	}
+	remote, err := netip.ParseAddr(stat.DstEndpoint.Addr)
+	if err != nil {
+		return socketKey{}, fmt.Errorf("parsing remote address: %w", err)
+	}
+
+	return socketKey{
+		local:  netip.AddrPortFrom(local.Unmap(), stat.SrcEndpoint.Port),
+		remote: netip.AddrPortFrom(remote.Unmap(), stat.DstEndpoint.Port),
+	}, nil
+}
+
+// readSocketTable reads the TCP sockets of the network namespace the given
+// process lives in.
+func readSocketTable(pid int32) (socketTable, error) {
+	table := socketTable{}
+
+	for _, name := range []string{"tcp", "tcp6"} {
+		f, err := os.Open(filepath.Join(host.HostProcFs, strconv.Itoa(int(pid)), "net", name))
+		if err != nil {
+			// IPv6 could be disabled
+			if name == "tcp6" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		err = parseSocketTable(f, table)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", name, err)
+		}
+	}
+
+	return table, nil
+}
+
+func parseSocketTable(r io.Reader, table socketTable) error {
+	scanner := bufio.NewScanner(r)
+
+	// Skip header
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		local, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			return err
+		}
+		remote, err := parseProcNetAddr(fields[2])
+		if err != nil {
+			return err
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			return fmt.Errorf("parsing state %q: %w", fields[3], err)
+		}
+
+		table[socketKey{local: local, remote: remote}] = uint8(state)
+	}
+
+	return scanner.Err()
+}
+
+// parseProcNetAddr parses an address as printed in /proc/net/tcp{,6}, e.g.
+// "0100007F:0050" for 127.0.0.1:80.
+func parseProcNetAddr(s string) (netip.AddrPort, error) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid address %q", s)
+	}
+
+	raw, err := hex.DecodeString(addrHex)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("invalid address %q", s)
+	}
+
+	// The kernel prints each 32-bit word of the address in host byte order
+	buf := make([]byte, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(buf[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	addr, _ := netip.AddrFromSlice(buf)
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid port in %q: %w", s, err)
+	}
+
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
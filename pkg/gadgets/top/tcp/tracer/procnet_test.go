@@ -0,0 +1,76 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSocketTable(t *testing.T) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("test data is written for little-endian hosts")
+	}
+
+	const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000   101        0 20117 1 0000000000000000 100 0 0 10 5
+   1: 0F02000A:D2A6 2E5C6DA2:01BB 01 00000000:00000000 02:0000073E 00000000  1000        0 47384 2 0000000000000000 24 4 28 10 -1
+`
+	const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21346 1 0000000000000000 100 0 0 10 0
+   1: 0000000000000000FFFF00000100007F:1F90 0000000000000000FFFF00000100007F:A3C2 06 00000000:00000000 03:000016A3 00000000     0        0 0 3 0000000000000000
+`
+
+	table := socketTable{}
+	require.NoError(t, parseSocketTable(strings.NewReader(procNetTCP), table))
+	require.NoError(t, parseSocketTable(strings.NewReader(procNetTCP6), table))
+	require.Len(t, table, 4)
+
+	expected := map[socketKey]uint8{
+		{
+			local:  netip.MustParseAddrPort("127.0.0.1:53"),
+			remote: netip.MustParseAddrPort("0.0.0.0:0"),
+		}: 0x0A,
+		{
+			local:  netip.MustParseAddrPort("10.0.2.15:53926"),
+			remote: netip.MustParseAddrPort("162.109.92.46:443"),
+		}: 0x01,
+		{
+			local:  netip.MustParseAddrPort("[::1]:631"),
+			remote: netip.MustParseAddrPort("[::]:0"),
+		}: 0x0A,
+		// IPv4-mapped addresses are unmapped
+		{
+			local:  netip.MustParseAddrPort("127.0.0.1:8080"),
+			remote: netip.MustParseAddrPort("127.0.0.1:41922"),
+		}: 0x06,
+	}
+	for key, state := range expected {
+		got, ok := table[key]
+		require.True(t, ok, "socket %v not found", key)
+		require.Equal(t, state, got, "wrong state for socket %v", key)
+	}
+}
+
+func TestParseProcNetAddrInvalid(t *testing.T) {
+	for _, s := range []string{"", "0100007F", "0100007:0035", "0100007F:XYZ", "01000:0035"} {
+		_, err := parseProcNetAddr(s)
+		require.Error(t, err, "expected error for %q", s)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	containerutils "github.com/inspektor-gadget/inspektor-gadget/pkg/container-utils"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
+)
+
+// userHZ is the unit of the times reported in /proc/<pid>/stat. The kernel
+// always reports them in USER_HZ, which is 100 on all the architectures.
+const userHZ = 100
+
+// pfKthread is the flag set on kernel threads, see PF_KTHREAD in
+// include/linux/sched.h
+const pfKthread = 0x00200000
+
+// procInfo is what the gadget needs to know about a process from
+// /proc/<pid>/stat
+type procInfo struct {
+	// startTime is the time the process started at, in nanoseconds since boot
+	startTime    uint64
+	ppid         int32
+	kernelThread bool
+	// netns is the inode of the network namespace of the process
+	netns uint64
+}
+
+// procInfos caches the information of several processes, so that each of
+// them is read at most once per interval.
+type procInfos map[int32]procInfo
+
+// get returns the information of the given process. It's zero if the
+// process is gone, except for the PID 0 which is the idle kernel thread
+// interrupted by the softirqs handling the traffic.
+func (p procInfos) get(pid int32) procInfo {
+	info, ok := p[pid]
+	if !ok {
+		// An error means the process is gone, the information is best-effort
+		info, _ = readProcInfo(pid)
+		if pid == 0 {
+			info.kernelThread = true
+		}
+		info.netns, _ = containerutils.GetNetNs(int(pid))
+		p[pid] = info
+	}
+	return info
+}
+
+func readProcInfo(pid int32) (procInfo, error) {
+	stat, err := os.ReadFile(filepath.Join(host.HostProcFs, strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return procInfo{}, err
+	}
+	return parseProcInfo(string(stat))
+}
+
+// parseProcInfo parses the content of /proc/<pid>/stat. The fields are
+// counted from the closing parenthesis of the comm as the comm may contain
+// spaces: the parent PID is the 4th one, the flags the 9th one and the start
+// time the 22nd one.
+func parseProcInfo(stat string) (procInfo, error) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return procInfo{}, fmt.Errorf("no comm found")
+	}
+
+	// The fields after the comm start from the 3rd one
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22-2 {
+		return procInfo{}, fmt.Errorf("too few fields: %d", len(fields)+2)
+	}
+	ppid, err := strconv.ParseInt(fields[4-3], 10, 32)
+	if err != nil {
+		return procInfo{}, fmt.Errorf("parsing parent PID %q: %w", fields[4-3], err)
+	}
+	flags, err := strconv.ParseUint(fields[9-3], 10, 32)
+	if err != nil {
+		return procInfo{}, fmt.Errorf("parsing flags %q: %w", fields[9-3], err)
+	}
+	ticks, err := strconv.ParseUint(fields[22-3], 10, 64)
+	if err != nil {
+		return procInfo{}, fmt.Errorf("parsing start time %q: %w", fields[22-3], err)
+	}
+	return procInfo{
+		startTime:    ticks * uint64(time.Second/userHZ),
+		ppid:         int32(ppid),
+		kernelThread: flags&pfKthread != 0,
+	}, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	containerutils "github.com/inspektor-gadget/inspektor-gadget/pkg/container-utils"
+)
+
+func TestParseProcInfo(t *testing.T) {
+	// The comm contains spaces and parentheses
+	stat := "1234 (my (weird) comm) S 1 1234 1234 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 4242 12345678 100 " +
+		"18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0\n"
+	info, err := parseProcInfo(stat)
+	require.NoError(t, err)
+	require.Equal(t, procInfo{startTime: 42420000000, ppid: 1}, info)
+
+	// The flags of a kworker
+	stat = "42 (kworker/0:1-events) I 2 0 0 0 -1 69238880 0 0 0 0 0 5 0 0 20 0 1 0 17 0 0 " +
+		"18446744073709551615 0 0 0 0 0 0 0 2147483647 0 0 0 0 17 0 0 0 0 0 0\n"
+	info, err = parseProcInfo(stat)
+	require.NoError(t, err)
+	require.Equal(t, procInfo{startTime: 170000000, ppid: 2, kernelThread: true}, info)
+
+	for _, invalid := range []string{
+		"", "1234 (comm", "1234 (comm) S 1 2 3",
+		"1234 (comm) S 1 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 x 1",
+		"1234 (comm) S 1 1 1 0 -1 x 0 0 0 0 0 0 0 0 20 0 1 0 1 1",
+		"1234 (comm) S x 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 1",
+	} {
+		_, err := parseProcInfo(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestProcInfos(t *testing.T) {
+	procs := make(procInfos)
+	info := procs.get(int32(os.Getpid()))
+	require.NotZero(t, info.startTime)
+	require.Equal(t, int32(os.Getppid()), info.ppid)
+	netns, err := containerutils.GetNetNs(os.Getpid())
+	require.NoError(t, err)
+	require.Equal(t, netns, info.netns)
+	require.False(t, info.kernelThread)
+
+	// Gone processes don't have any information
+	require.Zero(t, procs.get(-1))
+
+	// The idle task doesn't show up in /proc
+	require.True(t, procs.get(0).kernelThread)
+}
@@ -25,8 +25,13 @@ type tcptopIpKeyT struct {
 }
 
 type tcptopTrafficT struct {
-	Sent     uint64
-	Received uint64
+	Sent            uint64
+	Received        uint64
+	SentPackets     uint64
+	ReceivedPackets uint64
+	SrttUs          uint32
+	Direction       uint8
+	_               [3]byte
 }
 
 // loadTcptop returns the embedded CollectionSpec for tcptop.
@@ -71,7 +76,9 @@ type tcptopSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type tcptopProgramSpecs struct {
+	IgToptcpAccpt *ebpf.ProgramSpec `ebpf:"ig_toptcp_accpt"`
 	IgToptcpClean *ebpf.ProgramSpec `ebpf:"ig_toptcp_clean"`
+	IgToptcpConn  *ebpf.ProgramSpec `ebpf:"ig_toptcp_conn"`
 	IgToptcpSdmsg *ebpf.ProgramSpec `ebpf:"ig_toptcp_sdmsg"`
 }
 
@@ -81,6 +88,7 @@ type tcptopProgramSpecs struct {
 type tcptopMapSpecs struct {
 	GadgetMntnsFilterMap *ebpf.MapSpec `ebpf:"gadget_mntns_filter_map"`
 	IpMap                *ebpf.MapSpec `ebpf:"ip_map"`
+	SockDirection        *ebpf.MapSpec `ebpf:"sock_direction"`
 }
 
 // tcptopVariableSpecs contains global variables before they are loaded into the kernel.
@@ -114,12 +122,14 @@ func (o *tcptopObjects) Close() error {
 type tcptopMaps struct {
 	GadgetMntnsFilterMap *ebpf.Map `ebpf:"gadget_mntns_filter_map"`
 	IpMap                *ebpf.Map `ebpf:"ip_map"`
+	SockDirection        *ebpf.Map `ebpf:"sock_direction"`
 }
 
 func (m *tcptopMaps) Close() error {
 	return _TcptopClose(
 		m.GadgetMntnsFilterMap,
 		m.IpMap,
+		m.SockDirection,
 	)
 }
 
@@ -136,13 +146,17 @@ type tcptopVariables struct {
 //
 // It can be passed to loadTcptopObjects or ebpf.CollectionSpec.LoadAndAssign.
 type tcptopPrograms struct {
+	IgToptcpAccpt *ebpf.Program `ebpf:"ig_toptcp_accpt"`
 	IgToptcpClean *ebpf.Program `ebpf:"ig_toptcp_clean"`
+	IgToptcpConn  *ebpf.Program `ebpf:"ig_toptcp_conn"`
 	IgToptcpSdmsg *ebpf.Program `ebpf:"ig_toptcp_sdmsg"`
 }
 
 func (p *tcptopPrograms) Close() error {
 	return _TcptopClose(
+		p.IgToptcpAccpt,
 		p.IgToptcpClean,
+		p.IgToptcpConn,
 		p.IgToptcpSdmsg,
 	)
 }
@@ -20,6 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"unsafe"
 
@@ -30,19 +34,94 @@ import (
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/logger"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/parser"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/tcpbits"
 	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
 )
 
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -no-global-types -target $TARGET -type ip_key_t -type traffic_t -cc clang -cflags ${CFLAGS} tcptop ./bpf/tcptop.bpf.c -- -I./bpf/
 
 type Config struct {
-	MountnsMap   *ebpf.Map
-	TargetPid    int32
-	TargetFamily int32
-	MaxRows      int
-	Interval     time.Duration
-	Iterations   int
-	SortBy       []string
+	MountnsMap *ebpf.Map
+	// TargetPids only matches the connections of these processes, unless
+	// it's empty
+	TargetPids       map[int32]struct{}
+	TargetFamily     int32
+	TargetRemotePort int32
+	TargetLocalPort  int32
+	// TargetLocalAddr only matches the connections whose local address is in
+	// this prefix, unless it's the zero prefix
+	TargetLocalAddr netip.Prefix
+	TargetComm      string
+	// CommIgnoreCase matches TargetComm regardless of the case
+	CommIgnoreCase bool
+	// TargetNetNs only matches the connections of the processes in the
+	// network namespace with this inode, unless it's 0
+	TargetNetNs uint64
+	ExcludePids []int32
+	Cumulative  bool
+	// Delta reports the change of the bytes of each connection compared to
+	// the previous interval, sorting the stats by the largest change first.
+	// It can't be used with Cumulative.
+	Delta    bool
+	GroupBy  string
+	MinBytes uint64
+	// MinRtt only matches the connections whose RTT is known and at least
+	// this one
+	MinRtt             time.Duration
+	TargetK8sNamespace string
+	TargetK8sLabels    map[string]string
+	Duration           time.Duration
+	PerGroupRows       bool
+	// PerCPU reports the traffic of each connection on each CPU separately
+	// instead of summing it. It can't be used with GroupBy.
+	PerCPU          bool
+	TargetDirection string
+	// EstablishedOnly only matches the connections in the ESTABLISHED state
+	// when the stats are collected
+	EstablishedOnly bool
+	// ExcludeLoopback drops the connections whose both endpoints are
+	// loopback addresses
+	ExcludeLoopback bool
+	// ExcludeKernelThreads drops the connections of the kernel threads, the
+	// traffic handled in softirq context on behalf of the idle task included
+	ExcludeKernelThreads bool
+	// TargetRuntime only matches the connections of the containers of this
+	// runtime, unless it's empty
+	TargetRuntime eventtypes.RuntimeName
+	MaxRows       int
+	Interval      time.Duration
+	Iterations    int
+	SortBy        []string
+	// BufferIntervals is the number of intervals kept in the history of the
+	// tracer. 0 disables the history.
+	BufferIntervals int
+	// Heartbeat reports the intervals without any stats as heartbeat events
+	Heartbeat bool
+	// AlignToClock ends the intervals on multiples of the interval on the
+	// wall clock, see top.Ticker
+	AlignToClock bool
+	// MaxConnections is the number of connections tracked per interval, i.e.
+	// the size of the eBPF map. 0 keeps the size the map was compiled with.
+	MaxConnections uint32
+	// OutputFile is the file the events are also appended to, as batches of
+	// JSON objects, when the gadget is run. It's rotated at OutputFileMaxSize
+	// bytes, unless it's 0.
+	OutputFile        string
+	OutputFileMaxSize int64
+	// BTFPath is the path of a BTF file describing the running kernel, for
+	// kernels that don't expose their BTF. The BTF of the kernel, or the
+	// embedded one for it, is used when it's empty.
+	BTFPath string
+}
+
+// ConfigUpdate holds the parameters that can be changed while the tracer is
+// running. Zero values keep the current setting.
+type ConfigUpdate struct {
+	MaxRows  int
+	Interval time.Duration
+	SortBy   []string
 }
 
 type Tracer struct {
@@ -50,20 +129,96 @@ type Tracer struct {
 	objs               tcptopObjects
 	tcpSendmsgLink     link.Link
 	tcpCleanupRbufLink link.Link
+	tcpConnectLink     link.Link
+	inetCskAcceptLink  link.Link
 	enricher           gadgets.DataEnricherByMntNs
+	enricherFunc       func(ev any) error
 	eventCallback      func(*top.Event[types.Stats])
 	done               chan bool
+	exited             chan struct{}
+	cancel             context.CancelFunc
+	closeOnce          sync.Once
 	colMap             columns.ColumnMap[types.Stats]
+
+	// configMu protects the fields of config that can be changed by
+	// UpdateConfig while the tracer is running
+	configMu sync.Mutex
+	// intervalUpdated notifies run of a new interval
+	intervalUpdated chan time.Duration
+
+	// cumulative holds the totals of each connection since the tracer
+	// started. It's only used when Config.Cumulative is set.
+	cumulative map[statsKey]types.Stats
+	// resetCumulative asks run to clear cumulative before the next interval
+	resetCumulative atomic.Bool
+
+	// previous holds the stats of the last interval to compute the deltas
+	// of the next one. It's only used when Config.Delta is set and it's nil
+	// until the first interval is collected.
+	previous map[statsKey]types.Stats
+
+	// counts are the number of connections of the last interval before and
+	// after the filters applied in userspace
+	counts filterCounts
+
+	// history is nil unless Config.BufferIntervals is set
+	history *top.History[types.Stats]
+}
+
+// DIRECTION_ACTIVE and DIRECTION_PASSIVE from bpf/tcptop.h
+const (
+	directionActive  = 1
+	directionPassive = 2
+)
+
+// directions maps the directions recorded by the eBPF program to the ones of
+// the stats. The direction of the connections opened before the tracer
+// started is unknown and left empty.
+var directions = map[uint8]string{
+	directionActive:  types.DirectionActive,
+	directionPassive: types.DirectionPassive,
+}
+
+// statsKey identifies the stats of a connection, on a given CPU in per-cpu
+// mode
+type statsKey struct {
+	conn tcptopIpKeyT
+	cpu  uint16
+}
+
+// filterCounts is the number of connections before and after the filters
+type filterCounts struct {
+	before uint64
+	after  uint64
 }
 
+// NewTracer loads the tracer and starts reporting stats. eventCallback is
+// called with the stats of each interval as Go values, along with the
+// interval boundaries and the other metadata of top.Event: in-process
+// consumers don't need to go through JSON, which is only produced by the
+// callers publishing the events, e.g. with top.MarshalEvent. The stats are
+// only kept by the tracer once eventCallback returns when
+// Config.BufferIntervals is set, to be returned by History.
 func NewTracer(config *Config, enricher gadgets.DataEnricherByMntNs,
 	eventCallback func(*top.Event[types.Stats]),
+) (*Tracer, error) {
+	return NewTracerWithContext(context.Background(), config, enricher, eventCallback)
+}
+
+// NewTracerWithContext creates a tracer that stops once ctx is done, as if Stop
+// was called. The cancellation interrupts the interval being collected, if
+// any, instead of waiting for it to be over.
+func NewTracerWithContext(ctx context.Context, config *Config, enricher gadgets.DataEnricherByMntNs,
+	eventCallback func(*top.Event[types.Stats]),
 ) (*Tracer, error) {
 	t := &Tracer{
-		config:        config,
-		enricher:      enricher,
-		eventCallback: eventCallback,
-		done:          make(chan bool),
+		config:          config,
+		enricher:        enricher,
+		eventCallback:   eventCallback,
+		done:            make(chan bool),
+		intervalUpdated: make(chan time.Duration, 1),
+		cumulative:      make(map[statsKey]types.Stats),
+		history:         top.NewHistory[types.Stats](config.BufferIntervals),
 	}
 
 	if err := t.install(); err != nil {
@@ -71,29 +226,66 @@ func NewTracer(config *Config, enricher gadgets.DataEnricherByMntNs,
 		return nil, err
 	}
 
-	statCols, err := columns.NewColumns[types.Stats]()
-	if err != nil {
-		t.close()
-		return nil, err
+	// The columns of types.NewColumns have the comparators and the virtual
+	// columns the stats can be sorted by
+	t.colMap = types.NewColumns(false).GetColumnMap()
+
+	if config.Duration > 0 {
+		ctx, t.cancel = context.WithTimeout(ctx, config.Duration)
+	} else {
+		ctx, t.cancel = context.WithCancel(ctx)
 	}
-	t.colMap = statCols.GetColumnMap()
 
-	go t.run(context.TODO())
+	t.exited = make(chan struct{})
+	go func() {
+		defer close(t.exited)
+		t.run(ctx)
+	}()
 
 	return t, nil
 }
 
-// Stop stops the tracer
+// Exited returns a channel that is closed once the tracer stopped reporting
+// stats, either because it was stopped or because it completed the requested
+// number of iterations.
+func (t *Tracer) Exited() <-chan struct{} {
+	return t.exited
+}
+
+// History returns the last intervals reported by the tracer. It's nil unless
+// Config.BufferIntervals is set.
+func (t *Tracer) History() *top.History[types.Stats] {
+	return t.history
+}
+
+// Stop stops the tracer. It interrupts the interval being collected, if any,
+// and waits for it, so the event callback is never called after Stop returns.
+// Calling it more than once has no effect.
 // TODO: Remove after refactoring
 func (t *Tracer) Stop() {
 	t.close()
 }
 
 func (t *Tracer) close() {
+	t.closeOnce.Do(t.doClose)
+}
+
+func (t *Tracer) doClose() {
 	close(t.done)
+	if t.cancel != nil {
+		t.cancel()
+	}
+
+	// Wait for the reporting goroutine, if it was started, before closing
+	// the maps it reads from
+	if t.exited != nil {
+		<-t.exited
+	}
 
 	t.tcpSendmsgLink = gadgets.CloseLink(t.tcpSendmsgLink)
 	t.tcpCleanupRbufLink = gadgets.CloseLink(t.tcpCleanupRbufLink)
+	t.tcpConnectLink = gadgets.CloseLink(t.tcpConnectLink)
+	t.inetCskAcceptLink = gadgets.CloseLink(t.inetCskAcceptLink)
 
 	t.objs.Close()
 }
@@ -104,12 +296,46 @@ func (t *Tracer) install() error {
 		return fmt.Errorf("loading ebpf program: %w", err)
 	}
 
+	// IPv4 traffic on IPv6 sockets has the AF_INET6 family in the kernel, so
+	// filtering by IPv4 is done in userspace, once the addresses are unmapped
+	targetFamily := t.config.TargetFamily
+	if targetFamily == syscall.AF_INET {
+		targetFamily = -1
+	}
+
+	// The eBPF program can only filter by a single PID, several ones are
+	// filtered in userspace
+	targetPid := int32(0)
+	if len(t.config.TargetPids) == 1 {
+		for pid := range t.config.TargetPids {
+			targetPid = pid
+		}
+	}
+
 	consts := map[string]interface{}{
-		"target_pid":    t.config.TargetPid,
-		"target_family": t.config.TargetFamily,
+		"target_pid":    targetPid,
+		"target_family": targetFamily,
+	}
+
+	if t.config.MaxConnections > 0 {
+		spec.Maps["ip_map"].MaxEntries = t.config.MaxConnections
+	}
+
+	// The eBPF program works the same with a per-CPU map: it only sees the
+	// value of the CPU it runs on
+	if t.config.PerCPU {
+		spec.Maps["ip_map"].Type = ebpf.PerCPUHash
+	}
+
+	kernelTypes, err := loadKernelTypes(t.config.BTFPath)
+	if err != nil {
+		return err
 	}
 
-	if err := gadgets.LoadeBPFSpec(t.config.MountnsMap, spec, consts, &t.objs); err != nil {
+	if err := gadgets.LoadeBPFSpecWithKernelTypes(t.config.MountnsMap, spec, consts, &t.objs, kernelTypes); err != nil {
+		if t.config.MaxConnections > 0 {
+			return fmt.Errorf("loading ebpf spec with a map of %d connections: %w", t.config.MaxConnections, err)
+		}
 		return fmt.Errorf("loading ebpf spec: %w", err)
 	}
 
@@ -123,15 +349,34 @@ func (t *Tracer) install() error {
 		return fmt.Errorf("attaching kprobe: %w", err)
 	}
 
+	t.tcpConnectLink, err = link.Kprobe("tcp_connect", t.objs.IgToptcpConn, nil)
+	if err != nil {
+		return fmt.Errorf("attaching kprobe: %w", err)
+	}
+
+	t.inetCskAcceptLink, err = link.Kretprobe("inet_csk_accept", t.objs.IgToptcpAccpt, nil)
+	if err != nil {
+		return fmt.Errorf("attaching kretprobe: %w", err)
+	}
+
 	return nil
 }
 
-func (t *Tracer) nextStats() ([]*types.Stats, error) {
+func (t *Tracer) nextStats(ctx context.Context) ([]*types.Stats, error) {
 	stats := []*types.Stats{}
+	t.counts = filterCounts{}
+
+	if t.resetCumulative.Swap(false) {
+		clear(t.cumulative)
+	}
 
 	var prev *tcptopIpKeyT = nil
 	key := tcptopIpKeyT{}
 	ips := t.objs.IpMap
+	seen := make(map[statsKey]struct{})
+	tables := make(socketTables)
+	procs := make(procInfos)
+	current := make(map[statsKey]*types.Stats)
 
 	defer func() {
 		// delete elements
@@ -141,6 +386,10 @@ func (t *Tracer) nextStats() ([]*types.Stats, error) {
 		}
 
 		for {
+			// The map isn't read anymore once the tracer is stopped
+			if ctx.Err() != nil {
+				return
+			}
 			if err := ips.Delete(key); err != nil {
 				return
 			}
@@ -156,47 +405,95 @@ func (t *Tracer) nextStats() ([]*types.Stats, error) {
 	err := ips.NextKey(nil, unsafe.Pointer(&key))
 	if err != nil {
 		if errors.Is(err, ebpf.ErrKeyNotExist) {
-			return stats, nil
+			return t.finishStats(stats, seen, tables, current), nil
 		}
 		return nil, fmt.Errorf("getting next key: %w", err)
 	}
 
 	for {
-		val := tcptopTrafficT{}
-		if err := ips.Lookup(key, unsafe.Pointer(&val)); err != nil {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
 
-		ipversion := gadgets.IPVerFromAF(key.Family)
+		vals, err := t.lookupTraffic(key)
+		if err != nil {
+			return nil, err
+		}
 
-		stat := types.Stats{
-			WithMountNsID: eventtypes.WithMountNsID{MountNsID: key.Mntnsid},
-			Pid:           int32(key.Pid),
-			Comm:          gadgets.FromCString(key.Name[:]),
-			SrcEndpoint: eventtypes.L4Endpoint{
-				L3Endpoint: eventtypes.L3Endpoint{
-					Addr:    gadgets.IPStringFromBytes(key.Saddr, ipversion),
-					Version: uint8(ipversion),
+		for cpu, val := range vals {
+			// Only some of the CPUs handled the traffic of the connection
+			if t.config.PerCPU && val.SentPackets == 0 && val.ReceivedPackets == 0 {
+				continue
+			}
+			skey := statsKey{conn: key, cpu: uint16(cpu)}
+
+			ipversion, saddr, daddr := unmapAddrs(key.Family, key.Saddr, key.Daddr)
+
+			stat := types.Stats{
+				WithMountNsID: eventtypes.WithMountNsID{MountNsID: key.Mntnsid},
+				Pid:           int32(key.Pid),
+				Comm:          gadgets.FromCString(key.Name[:]),
+				SrcEndpoint: eventtypes.L4Endpoint{
+					L3Endpoint: eventtypes.L3Endpoint{
+						Addr:    saddr,
+						Version: uint8(ipversion),
+					},
+					Port: key.Lport,
 				},
-				Port: key.Lport,
-			},
-			DstEndpoint: eventtypes.L4Endpoint{
-				L3Endpoint: eventtypes.L3Endpoint{
-					Addr:    gadgets.IPStringFromBytes(key.Daddr, ipversion),
-					Version: uint8(ipversion),
+				DstEndpoint: eventtypes.L4Endpoint{
+					L3Endpoint: eventtypes.L3Endpoint{
+						Addr:    daddr,
+						Version: uint8(ipversion),
+					},
+					Port: key.Dport,
 				},
-				Port: key.Dport,
-			},
-			IPVersion: ipversion,
-			Sent:      val.Sent,
-			Received:  val.Received,
-		}
+				IPVersion:       ipversion,
+				Sent:            val.Sent,
+				Received:        val.Received,
+				SentPackets:     val.SentPackets,
+				ReceivedPackets: val.ReceivedPackets,
+				RTT:             val.SrttUs,
+				CPU:             uint16(cpu),
+			}
 
-		if t.enricher != nil {
-			t.enricher.EnrichByMntNs(&stat.CommonData, stat.MountNsID)
-		}
+			t.enrich(&stat)
+
+			// The socket may be gone already if it was closed during the interval
+			stat.State = tcpbits.TCPState(tcpStateClose)
+			if state, open := tables.lookup(&stat); open {
+				stat.State = tcpbits.TCPState(state)
+			}
+			stat.Direction = directions[val.Direction]
+			proc := procs.get(stat.Pid)
+			stat.StartTime = proc.startTime
+			stat.PPid = proc.ppid
+			stat.NetNsID = proc.netns
+
+			// Kernel threads are dropped like the connections the filters
+			// reject: they're counted before the filters, but they're neither
+			// reported nor kept in the cumulative totals
+			excluded := t.config.ExcludeKernelThreads && proc.kernelThread
+
+			if t.config.Cumulative && !excluded {
+				if prevStat, ok := t.cumulative[skey]; ok {
+					stat.Sent += prevStat.Sent
+					stat.Received += prevStat.Received
+					stat.SentPackets += prevStat.SentPackets
+					stat.ReceivedPackets += prevStat.ReceivedPackets
+				}
+				t.cumulative[skey] = stat
+				seen[skey] = struct{}{}
+			}
 
-		stats = append(stats, &stat)
+			t.counts.before++
+			if !excluded && t.config.match(&stat) {
+				t.counts.after++
+				stats = append(stats, &stat)
+				if t.config.Delta {
+					current[skey] = &stat
+				}
+			}
+		}
 
 		prev = &key
 		if err := ips.NextKey(unsafe.Pointer(prev), unsafe.Pointer(&key)); err != nil {
@@ -207,18 +504,144 @@ func (t *Tracer) nextStats() ([]*types.Stats, error) {
 		}
 	}
 
-	top.SortStats(stats, t.config.SortBy, &t.colMap)
+	return t.finishStats(stats, seen, tables, current), nil
+}
+
+// enrich adds the container and pod of stat, if any. The filters, the
+// grouping and IsHost rely on them, so it must run before them.
+func (t *Tracer) enrich(stat *types.Stats) {
+	if t.enricher != nil {
+		t.enricher.EnrichByMntNs(&stat.CommonData, stat.MountNsID)
+	}
+	stat.IsHost = types.IsHost(&stat.CommonData)
+}
+
+// lookupTraffic returns the traffic of the connection on each CPU in per-cpu
+// mode, or a single value holding the traffic of all the CPUs otherwise
+func (t *Tracer) lookupTraffic(key tcptopIpKeyT) ([]tcptopTrafficT, error) {
+	if t.config.PerCPU {
+		var vals []tcptopTrafficT
+		err := t.objs.IpMap.Lookup(key, &vals)
+		return vals, err
+	}
 
-	return stats, nil
+	val := tcptopTrafficT{}
+	err := t.objs.IpMap.Lookup(key, unsafe.Pointer(&val))
+	return []tcptopTrafficT{val}, err
+}
+
+// UpdateConfig applies update to the running tracer. The new max rows and
+// sorting apply to the next reported interval, the new interval starts
+// immediately. The counters of the connections are kept.
+func (t *Tracer) UpdateConfig(update ConfigUpdate) {
+	t.configMu.Lock()
+	defer t.configMu.Unlock()
+
+	if update.MaxRows > 0 {
+		t.config.MaxRows = update.MaxRows
+	}
+	if update.SortBy != nil {
+		t.config.SortBy = update.SortBy
+	}
+	if update.Interval > 0 && update.Interval != t.config.Interval {
+		t.config.Interval = update.Interval
+
+		// Only the last interval matters if run didn't get the previous one
+		select {
+		case <-t.intervalUpdated:
+		default:
+		}
+		t.intervalUpdated <- update.Interval
+	}
+}
+
+// ResetCumulative zeroes the totals of the connections in cumulative mode, so
+// the next interval reports the bytes since the reset. It has no effect if
+// Config.Cumulative isn't set.
+func (t *Tracer) ResetCumulative() {
+	t.resetCumulative.Store(true)
+}
+
+// finishStats completes the stats read from the map: it adds the idle
+// connections in cumulative mode, sets the deltas in delta mode, groups the
+// stats, sorts them and keeps the first MaxRows (of each group if
+// PerGroupRows is set). current holds the stats of each connection in delta
+// mode.
+func (t *Tracer) finishStats(
+	stats []*types.Stats, seen map[statsKey]struct{}, tables socketTables, current map[statsKey]*types.Stats,
+) []*types.Stats {
+	stats = t.addCumulativeStats(stats, seen, tables)
+	if t.config.Delta {
+		stats, t.previous = setDeltas(stats, t.previous, current)
+	}
+
+	for _, stat := range stats {
+		stat.Total = stat.Sent + stat.Received
+	}
+
+	t.configMu.Lock()
+	maxRows, sortBy := t.config.MaxRows, t.config.SortBy
+	t.configMu.Unlock()
+
+	if t.config.Delta {
+		sortBy = append([]string{deltaSortBy}, sortBy...)
+	}
+
+	if t.config.PerGroupRows {
+		setPercentages(stats)
+		return topPerGroup(stats, t.config.GroupBy, maxRows, sortBy, &t.colMap)
+	}
+
+	stats = groupStats(stats, t.config.GroupBy)
+	setPercentages(stats)
+	sortStats(stats, sortBy, &t.colMap)
+
+	if len(stats) > maxRows {
+		stats = stats[:maxRows]
+	}
+	return stats
+}
+
+// addCumulativeStats appends the totals of the connections that didn't have
+// any activity during the last interval but are still open. Connections that
+// were closed are forgotten, so their totals start from zero if they are
+// reopened.
+func (t *Tracer) addCumulativeStats(stats []*types.Stats, seen map[statsKey]struct{}, tables socketTables) []*types.Stats {
+	if !t.config.Cumulative {
+		return stats
+	}
+
+	for key, stat := range t.cumulative {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		state, open := tables.lookup(&stat)
+		if !open {
+			delete(t.cumulative, key)
+			continue
+		}
+		stat.State = tcpbits.TCPState(state)
+
+		t.counts.before++
+		if t.config.match(&stat) {
+			t.counts.after++
+			stats = append(stats, &stat)
+		}
+	}
+
+	return stats
 }
 
 func (t *Tracer) run(ctx context.Context) error {
 	// Don't use a context with a timeout but a counter to avoid having to deal
 	// with two timers: one for the timeout and another for the ticker.
 	count := t.config.Iterations
-	ticker := time.NewTicker(t.config.Interval)
+	ticker := top.NewTicker(t.config.Interval, t.config.AlignToClock)
 	defer ticker.Stop()
 
+	intervalStart := time.Now()
+
 	for {
 		select {
 		case <-t.done:
@@ -227,17 +650,35 @@ func (t *Tracer) run(ctx context.Context) error {
 			return nil
 		case <-ctx.Done():
 			return nil
+		case interval := <-t.intervalUpdated:
+			ticker.Reset(interval)
 		case <-ticker.C:
-			stats, err := t.nextStats()
+			intervalEnd := time.Now()
+			ticker.Next()
+			stats, err := t.nextStats(ctx)
 			if err != nil {
+				if ctx.Err() != nil {
+					// Stopped while collecting the stats
+					return nil
+				}
 				return fmt.Errorf("getting next stats: %w", err)
 			}
 
-			n := len(stats)
-			if n > t.config.MaxRows {
-				n = t.config.MaxRows
+			if !t.config.Cumulative {
+				setRates(stats, intervalEnd.Sub(intervalStart))
 			}
-			t.eventCallback(&top.Event[types.Stats]{Stats: stats[:n]})
+
+			ev := &top.Event[types.Stats]{
+				Stats:             stats,
+				TotalBeforeFilter: t.counts.before,
+				TotalAfterFilter:  t.counts.after,
+			}
+			ev.Heartbeat = t.config.Heartbeat && len(stats) == 0
+			ev.SetInterval(intervalStart, intervalEnd)
+			intervalStart = intervalEnd
+
+			t.history.Add(ev)
+			t.eventCallback(ev)
 
 			// Count down only if user requested a finite number of iterations
 			// through a timeout.
@@ -256,12 +697,47 @@ func (t *Tracer) Run(gadgetCtx gadgets.GadgetContext) error {
 		return fmt.Errorf("initializing tracer: %w", err)
 	}
 
+	// The sink is closed after the tracer, so after the last event is written
+	if t.config.OutputFile != "" {
+		sink, err := top.NewFileSink(t.config.OutputFile, t.config.OutputFileMaxSize)
+		if err != nil {
+			return err
+		}
+		defer sink.Close()
+		t.eventCallback = writeToSink(sink, gadgetCtx.Logger(), t.eventCallback)
+	}
+
 	defer t.close()
 	if err := t.install(); err != nil {
 		return fmt.Errorf("installing tracer: %w", err)
 	}
 
-	return t.run(gadgetCtx.Context())
+	ctx := gadgetCtx.Context()
+	if t.config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.config.Duration)
+		defer cancel()
+	}
+
+	return t.run(ctx)
+}
+
+// writeToSink returns an event callback appending the events to sink before
+// passing them to eventCallback
+func writeToSink(sink *top.FileSink, logger logger.Logger, eventCallback func(*top.Event[types.Stats])) func(*top.Event[types.Stats]) {
+	return func(ev *top.Event[types.Stats]) {
+		lines, err := top.MarshalEvent(ev, top.OutputFormatDefault, time.Now())
+		if err == nil {
+			err = sink.Write(lines)
+		}
+		if err == nil {
+			err = sink.Flush()
+		}
+		if err != nil {
+			logger.Warnf("writing to output file: %s", err)
+		}
+		eventCallback(ev)
+	}
 }
 
 func (t *Tracer) SetEventHandlerArray(handler any) {
@@ -279,6 +755,19 @@ func (t *Tracer) SetEventHandlerArray(handler any) {
 	}
 }
 
+// SetEventEnricher makes the local gadget enrich the stats as they are read,
+// before they are filtered and grouped, like the gadget-collection one does
+func (t *Tracer) SetEventEnricher(enricher func(ev any) error) {
+	t.enricherFunc = enricher
+	t.enricher = t
+}
+
+func (t *Tracer) EnrichByMntNs(event *eventtypes.CommonData, mountnsid uint64) {
+	wrap := &types.Stats{CommonData: *event, WithMountNsID: eventtypes.WithMountNsID{MountNsID: mountnsid}}
+	t.enricherFunc(wrap)
+	*event = wrap.CommonData
+}
+
 func (t *Tracer) SetMountNsMap(mntnsMap *ebpf.Map) {
 	t.config.MountnsMap = mntnsMap
 }
@@ -287,31 +776,106 @@ func (g *GadgetDesc) NewInstance() (gadgets.Gadget, error) {
 	tracer := &Tracer{
 		config: &Config{
 			TargetFamily: -1,
-			TargetPid:    -1,
 		},
-		done: make(chan bool),
+		done:            make(chan bool),
+		intervalUpdated: make(chan time.Duration, 1),
+		cumulative:      make(map[statsKey]types.Stats),
 	}
 	return tracer, nil
 }
 
 func (t *Tracer) init(gadgetCtx gadgets.GadgetContext) error {
 	params := gadgetCtx.GadgetParams()
+	var err error
 	t.config.MaxRows = params.Get(gadgets.ParamMaxRows).AsInt()
 	t.config.SortBy = params.Get(gadgets.ParamSortBy).AsStringSlice()
 	t.config.Interval = time.Second * time.Duration(params.Get(gadgets.ParamInterval).AsInt())
 	t.config.TargetFamily, _ = types.ParseFilterByFamily(params.Get(types.FamilyParam).AsString())
-	t.config.TargetPid = params.Get(types.PidParam).AsInt32()
-
-	var err error
-	if t.config.Iterations, err = top.ComputeIterations(t.config.Interval, gadgetCtx.Timeout()); err != nil {
-		return err
+	t.config.TargetPids, err = types.ParseTargetPids(params.Get(types.PidParam).AsString())
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", types.PidParam, err)
 	}
-
-	statCols, err := columns.NewColumns[types.Stats]()
+	t.config.TargetRemotePort = int32(params.Get(types.RemotePortParam).AsUint16())
+	t.config.TargetLocalPort = int32(params.Get(types.LocalPortParam).AsUint16())
+	t.config.TargetLocalAddr, err = types.ParseLocalAddr(params.Get(types.LocalAddrParam).AsString())
 	if err != nil {
-		return err
+		return fmt.Errorf("parsing %s: %w", types.LocalAddrParam, err)
+	}
+	t.config.TargetComm = params.Get(types.CommParam).AsString()
+	t.config.CommIgnoreCase = params.Get(types.CommIgnoreCaseParam).AsBool()
+	t.config.TargetNetNs = params.Get(types.NetNsParam).AsUint64()
+	excludePids, err := types.ParseExcludePids(params.Get(types.ExcludePidsParam).AsString())
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", types.ExcludePidsParam, err)
+	}
+	t.config.ExcludePids = excludePids
+	t.config.Cumulative = params.Get(types.CumulativeParam).AsBool()
+	t.config.Delta = params.Get(types.DeltaParam).AsBool()
+	if t.config.Delta && t.config.Cumulative {
+		return fmt.Errorf("%s can't be used with %s", types.DeltaParam, types.CumulativeParam)
+	}
+	t.config.Heartbeat = params.Get(types.HeartbeatParam).AsBool()
+	t.config.AlignToClock = params.Get(top.AlignToClockParam).AsBool()
+	t.config.GroupBy = params.Get(types.GroupByParam).AsString()
+	t.config.MinBytes = params.Get(types.MinBytesParam).AsUint64()
+	t.config.MinRtt = time.Millisecond * time.Duration(params.Get(types.MinRttParam).AsUint32())
+	t.config.TargetK8sNamespace = params.Get(types.K8sNamespaceParam).AsString()
+	t.config.PerGroupRows = params.Get(types.PerGroupRowsParam).AsBool()
+	if t.config.PerGroupRows && t.config.GroupBy == types.GroupByNone {
+		return fmt.Errorf("%s requires %s", types.PerGroupRowsParam, types.GroupByParam)
+	}
+	t.config.PerCPU = params.Get(types.PerCPUParam).AsBool()
+	if t.config.PerCPU && t.config.GroupBy != types.GroupByNone {
+		return fmt.Errorf("%s can't be used with %s", types.PerCPUParam, types.GroupByParam)
+	}
+	t.config.TargetDirection = params.Get(types.DirectionParam).AsString()
+	t.config.EstablishedOnly = params.Get(types.EstablishedOnlyParam).AsBool()
+	t.config.ExcludeLoopback = params.Get(types.ExcludeLoopbackParam).AsBool()
+	t.config.ExcludeKernelThreads = params.Get(types.ExcludeKthreadsParam).AsBool()
+	t.config.TargetRuntime, err = types.ParseRuntime(params.Get(types.RuntimeParam).AsString())
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", types.RuntimeParam, err)
+	}
+	t.config.MaxConnections = params.Get(types.MaxConnectionsParam).AsUint32()
+	t.config.BTFPath = params.Get(types.BTFPathParam).AsString()
+	if outputFile := params.Get(top.OutputFileParam).AsString(); outputFile != "" {
+		t.config.OutputFile, err = top.ResolveOutputFile(top.OutputDir, outputFile)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", top.OutputFileParam, err)
+		}
+	}
+	t.config.OutputFileMaxSize, err = top.ParseOutputFileMaxSize(params.Get(top.OutputFileMaxSizeParam).AsString())
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", top.OutputFileMaxSizeParam, err)
+	}
+	t.config.Duration = time.Second * time.Duration(params.Get(types.DurationParam).AsUint())
+	labels, err := types.ParseK8sLabels(params.Get(types.K8sLabelsParam).AsString())
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", types.K8sLabelsParam, err)
+	}
+	t.config.TargetK8sLabels = labels
+
+	if t.config.Interval == 0 {
+		// Single-shot mode: collect one interval and stop
+		t.config.Interval = time.Second * top.IntervalDefault
+		t.config.Iterations = 1
+	} else {
+		var err error
+		if t.config.Iterations, err = top.ComputeIterations(t.config.Interval, gadgetCtx.Timeout()); err != nil {
+			return err
+		}
+	}
+
+	t.colMap = types.NewColumns(false).GetColumnMap()
+
+	// The columns output is rendered by the parser of the gadget context,
+	// when it's run locally
+	if p, ok := gadgetCtx.(interface{ Parser() parser.Parser }); ok && p.Parser() != nil {
+		if colMap, ok := p.Parser().GetColumns().(columns.ColumnMap[types.Stats]); ok {
+			cols := &columns.Columns[types.Stats]{ColumnMap: colMap}
+			types.Formatters.Apply(cols, params.Get(top.HumanReadableParam).AsBool())
+		}
 	}
-	t.colMap = statCols.GetColumnMap()
 
 	return nil
 }
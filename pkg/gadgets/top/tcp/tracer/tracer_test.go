@@ -0,0 +1,134 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package tracer_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	utilstest "github.com/inspektor-gadget/inspektor-gadget/internal/test"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/tracer"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/tcp/types"
+)
+
+func TestTcptopTracerCreate(t *testing.T) {
+	t.Parallel()
+
+	utilstest.RequireRoot(t)
+
+	tracer := createTracer(t, newConfig(time.Second), func(*top.Event[types.Stats]) {})
+	if tracer == nil {
+		t.Fatal("Returned tracer was nil")
+	}
+}
+
+func TestTcptopTracerStopIdempotent(t *testing.T) {
+	t.Parallel()
+
+	utilstest.RequireRoot(t)
+
+	tracer := createTracer(t, newConfig(time.Second), func(*top.Event[types.Stats]) {})
+
+	// Check that a double stop doesn't cause issues
+	tracer.Stop()
+	tracer.Stop()
+}
+
+func TestTcptopTracerNoEventsAfterStop(t *testing.T) {
+	t.Parallel()
+
+	utilstest.RequireRoot(t)
+
+	const (
+		iterations = 50
+		interval   = time.Millisecond
+	)
+
+	for i := 0; i < iterations; i++ {
+		var stopped, lateEvents atomic.Int32
+
+		tracer, err := tracer.NewTracer(newConfig(interval), nil, func(*top.Event[types.Stats]) {
+			if stopped.Load() != 0 {
+				lateEvents.Add(1)
+			}
+		})
+		if err != nil {
+			t.Fatalf("Error creating tracer: %s", err)
+		}
+
+		// Give the tracer the chance to be in the middle of an interval
+		time.Sleep(time.Duration(i%5) * interval)
+
+		tracer.Stop()
+		stopped.Store(1)
+
+		// Leave time to any leftover goroutine to report stats
+		time.Sleep(5 * interval)
+
+		if n := lateEvents.Load(); n != 0 {
+			t.Fatalf("Iteration %d: %d events were reported after Stop returned", i, n)
+		}
+	}
+}
+
+func TestTcptopTracerContextCancel(t *testing.T) {
+	t.Parallel()
+
+	utilstest.RequireRoot(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracer, err := tracer.NewTracerWithContext(ctx, newConfig(time.Millisecond), nil, func(*top.Event[types.Stats]) {})
+	if err != nil {
+		t.Fatalf("Error creating tracer: %s", err)
+	}
+	t.Cleanup(tracer.Stop)
+
+	cancel()
+
+	select {
+	case <-tracer.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Tracer didn't exit after its context was cancelled")
+	}
+}
+
+func newConfig(interval time.Duration) *tracer.Config {
+	return &tracer.Config{
+		MaxRows:      top.MaxRowsDefault,
+		Interval:     interval,
+		SortBy:       types.SortByDefault,
+		TargetFamily: -1,
+	}
+}
+
+func createTracer(
+	t *testing.T, config *tracer.Config, callback func(*top.Event[types.Stats]),
+) *tracer.Tracer {
+	t.Helper()
+
+	tracer, err := tracer.NewTracer(config, nil, callback)
+	if err != nil {
+		t.Fatalf("Error creating tracer: %s", err)
+	}
+	t.Cleanup(tracer.Stop)
+
+	return tracer
+}
@@ -15,62 +15,461 @@
 package types
 
 import (
+	"cmp"
 	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
 	"syscall"
 
-	"github.com/docker/go-units"
-
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
 	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
 )
 
-var SortByDefault = []string{"-sent", "-recv"}
+// SortByDefault sorts the connections that transferred the most data first.
+// Ties are broken by the source and destination endpoints, so the order of the
+// rows doesn't change between intervals.
+var SortByDefault = []string{"-sent", "-recv", "src", "dst"}
+
+// SortByTiebreakers identifies each connection. They're appended to the
+// columns given by the user to always sort the rows in the same order.
+var SortByTiebreakers = []string{"pid", "src", "dst"}
 
 const (
-	PidParam    = "pid"
-	FamilyParam = "family"
+	PidParam             = "pid"
+	ExcludePidsParam     = "exclude-pids"
+	FamilyParam          = "family"
+	RemotePortParam      = "remote-port"
+	LocalPortParam       = "local-port"
+	LocalAddrParam       = "local-addr"
+	CommParam            = "comm"
+	CommIgnoreCaseParam  = "comm-ignore-case"
+	NetNsParam           = "netns"
+	CumulativeParam      = "cumulative"
+	DeltaParam           = "delta"
+	GroupByParam         = "group-by"
+	MinBytesParam        = "min-bytes"
+	MinRttParam          = "min-rtt"
+	K8sNamespaceParam    = "k8s-namespace"
+	K8sLabelsParam       = "k8s-labels"
+	DurationParam        = "duration"
+	PerGroupRowsParam    = "per-group-rows"
+	PerCPUParam          = "per-cpu"
+	DirectionParam       = "direction"
+	EstablishedOnlyParam = "established-only"
+	ExcludeLoopbackParam = "exclude-loopback"
+	ExcludeKthreadsParam = "exclude-kthreads"
+	BufferIntervalsParam = "buffer-intervals"
+	HeartbeatParam       = "heartbeat"
+	MaxConnectionsParam  = "max-connections"
+	BTFPathParam         = "btf-path"
+	NoMountNsFilterParam = "no-mountns-filter"
+	RuntimeParam         = "runtime"
 )
 
+// RuntimeAll doesn't filter the connections by container runtime
+const RuntimeAll = "all"
+
+// Runtimes are the values accepted by RuntimeParam
+var Runtimes = []string{
+	RuntimeAll,
+	string(eventtypes.RuntimeNameDocker),
+	string(eventtypes.RuntimeNameContainerd),
+	string(eventtypes.RuntimeNameCrio),
+	string(eventtypes.RuntimeNamePodman),
+}
+
+// The connections are counted in an eBPF hash map of MaxConnectionsDefault
+// entries, each one taking around 150 bytes of kernel memory. Once the map is
+// full, the traffic of the new connections is lost until the next interval.
+const (
+	MaxConnectionsDefault = 10240
+	MaxConnectionsMin     = 64
+	MaxConnectionsMax     = 1 << 20
+)
+
+const (
+	DirectionAll     = "all"
+	DirectionActive  = "active"
+	DirectionPassive = "passive"
+)
+
+const (
+	GroupByNone      = ""
+	GroupByContainer = "container"
+	GroupByPod       = "pod"
+	GroupByImage     = "image"
+)
+
+// TaskCommLen is the maximum length of a process name as reported by the
+// kernel, excluding the trailing NUL byte.
+const TaskCommLen = 15
+
+// familyAliases are the accepted spellings of each IP version, the first one
+// being the canonical one
+var familyAliases = map[int32][]string{
+	syscall.AF_INET:  {"4", "ipv4", "v4"},
+	syscall.AF_INET6: {"6", "ipv6", "v6"},
+}
+
+// ParseFilterByFamily returns the address family of the given IP version.
+// Besides "4" and "6", it accepts "ipv4", "ipv6", "v4" and "v6" in any case
+// and surrounded by spaces. The error lists the accepted values and, when
+// family looks like a mistyped one, the closest of them.
 func ParseFilterByFamily(family string) (int32, error) {
-	switch family {
-	case "4":
-		return syscall.AF_INET, nil
-	case "6":
-		return syscall.AF_INET6, nil
+	value := strings.ToLower(strings.TrimSpace(family))
+	var accepted []string
+	for _, af := range []int32{syscall.AF_INET, syscall.AF_INET6} {
+		for _, alias := range familyAliases[af] {
+			if value == alias {
+				return af, nil
+			}
+		}
+		accepted = append(accepted, familyAliases[af]...)
+	}
+
+	hint := ""
+	// A single character is too short to guess anything from
+	if match := top.ClosestMatch(value, accepted); len(value) > 1 && match != "" {
+		hint = fmt.Sprintf(" (did you mean %q?)", match)
+	}
+	return -1, fmt.Errorf("IP version is either 4 (ipv4, v4) or 6 (ipv6, v6), %q was given%s", family, hint)
+}
+
+// FamilyToString returns the canonical spelling of the IP version of the
+// given address family, as accepted by ParseFilterByFamily and shown in the
+// ip column. It returns "all" for any other family, which is how FamilyParam
+// spells no filtering.
+func FamilyToString(family int32) string {
+	if aliases, ok := familyAliases[family]; ok {
+		return aliases[0]
+	}
+	return "all"
+}
+
+// ParseTargetPids parses the value of PidParam: a PID or a comma-separated
+// list of PIDs. A single PID lower or equal to 0 matches all the processes
+// and returns a nil set.
+func ParseTargetPids(pids string) (map[int32]struct{}, error) {
+	pids = strings.TrimSpace(pids)
+	if pids == "" {
+		return nil, nil
+	}
+	if !strings.Contains(pids, ",") {
+		p, err := strconv.ParseInt(pids, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid PID", pids)
+		}
+		if p <= 0 {
+			return nil, nil
+		}
+		return map[int32]struct{}{int32(p): {}}, nil
+	}
+
+	list, err := ParseExcludePids(pids)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[int32]struct{}, len(list))
+	for _, p := range list {
+		set[p] = struct{}{}
+	}
+	return set, nil
+}
+
+// ParseExcludePids parses a comma-separated list of PIDs
+func ParseExcludePids(pids string) ([]int32, error) {
+	if pids == "" {
+		return nil, nil
+	}
+
+	parsed := make([]int32, 0)
+	for _, pid := range strings.Split(pids, ",") {
+		p, err := strconv.ParseInt(strings.TrimSpace(pid), 10, 32)
+		if err != nil || p <= 0 {
+			return nil, fmt.Errorf("%q is not a valid PID", pid)
+		}
+		parsed = append(parsed, int32(p))
+	}
+	return parsed, nil
+}
+
+// ParseLocalAddr parses an IP address or a CIDR into the prefix of the local
+// addresses to match. An empty string matches all the addresses and returns
+// the zero (invalid) prefix.
+func ParseLocalAddr(addr string) (netip.Prefix, error) {
+	if addr == "" {
+		return netip.Prefix{}, nil
+	}
+
+	if strings.Contains(addr, "/") {
+		prefix, err := netip.ParsePrefix(addr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%q is neither an IP address nor a CIDR", addr)
+		}
+		return prefix.Masked(), nil
+	}
+
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is neither an IP address nor a CIDR", addr)
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// ParseMaxConnections parses the maximum number of connections tracked per
+// interval, which has to be between MaxConnectionsMin and MaxConnectionsMax
+func ParseMaxConnections(maxConnections string) (uint32, error) {
+	n, err := strconv.ParseUint(maxConnections, 10, 32)
+	if err != nil || n < MaxConnectionsMin || n > MaxConnectionsMax {
+		return 0, fmt.Errorf("must be between %d and %d", MaxConnectionsMin, MaxConnectionsMax)
+	}
+	return uint32(n), nil
+}
+
+// ParseRuntime returns the container runtime to filter the connections by. It
+// returns an empty name for RuntimeAll or an empty string.
+func ParseRuntime(runtime string) (eventtypes.RuntimeName, error) {
+	switch runtime {
+	case "", RuntimeAll:
+		return "", nil
+	}
+	if name := eventtypes.String2RuntimeName(runtime); name != eventtypes.RuntimeNameUnknown {
+		return name, nil
+	}
+	return "", fmt.Errorf("runtime is one of %s, %q was given", strings.Join(Runtimes, ", "), runtime)
+}
+
+func ParseGroupBy(groupBy string) (string, error) {
+	switch groupBy {
+	case GroupByNone, GroupByContainer, GroupByPod, GroupByImage:
+		return groupBy, nil
+	default:
+		return "", fmt.Errorf("group-by is either %q, %q or %q, %q was given", GroupByContainer, GroupByPod, GroupByImage, groupBy)
+	}
+}
+
+func ParseDirection(direction string) (string, error) {
+	switch direction {
+	case DirectionAll, DirectionActive, DirectionPassive:
+		return direction, nil
 	default:
-		return -1, fmt.Errorf("IP version is either 4 or 6, %s was given", family)
+		return "", fmt.Errorf("direction is either %q, %q or %q, %q was given", DirectionAll, DirectionActive, DirectionPassive, direction)
+	}
+}
+
+// ParseK8sLabels parses a comma-separated list of key=value pairs. Only
+// equality is supported.
+func ParseK8sLabels(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if selector == "" {
+		return labels, nil
+	}
+
+	for _, pair := range strings.Split(selector, ",") {
+		kv := strings.Split(pair, "=")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("should be a comma-separated list of key-value pairs (key=value[,key=value,...])")
+		}
+		labels[kv[0]] = kv[1]
 	}
+	return labels, nil
 }
 
 // Stats represents the operations performed on a single file
 type Stats struct {
 	eventtypes.CommonData
 	eventtypes.WithMountNsID
+	// NetNsID is the inode of the network namespace of the process, which
+	// tells apart the connections with the same endpoints in different
+	// namespaces. It's best-effort and left to zero if the process exited
+	// before the stats were collected.
+	eventtypes.WithNetNsID
 
 	Pid       int32  `json:"pid,omitempty" column:"pid,template:pid"`
 	Comm      string `json:"comm,omitempty" column:"comm,template:comm"`
-	IPVersion int    `json:"ipversion,omitempty" column:"ip,template:ipversion"`
+	IPVersion int    `json:"ipversion,omitempty" column:"ip,template:ipversion" columnDesc:"IP version of the connection, either 4 or 6."`
+
+	// StartTime is the time the process started at, in nanoseconds since
+	// boot. Together with Pid, it identifies a process instance even if its
+	// PID is recycled. It's best-effort and left to zero if the process
+	// exited before the stats were collected.
+	StartTime uint64 `json:"startTime,omitempty" column:"starttime,hide" columnDesc:"Time the process started at, in nanoseconds since boot."`
+
+	// PPid is the PID of the parent of the process, to attribute the traffic
+	// of short-lived children. It's best-effort and left to zero if the
+	// process exited before the stats were collected.
+	PPid int32 `json:"ppid,omitempty" column:"ppid,template:pid,hide" columnDesc:"PID of the parent of the process."`
+
+	// ExePath is the path of the executable of the process, only set by the
+	// ExePathResolver operator. It's empty if the process exited before the
+	// stats were enriched.
+	ExePath string `json:"exePath,omitempty" column:"exepath,width:32,hide" columnDesc:"Path of the executable of the process."`
+
+	// CgroupPath is the cgroup of the process, only set by the CgroupResolver
+	// operator. It tells apart the services of the host, which IsHost
+	// doesn't.
+	CgroupPath string `json:"cgroupPath,omitempty" column:"cgroup,width:32,hide" columnDesc:"Cgroup of the process."`
+
+	// CPU is the CPU that handled the traffic, in per-cpu mode. It's always
+	// 0 otherwise, the traffic of all the CPUs being summed.
+	CPU uint16 `json:"cpu,omitempty" column:"cpu,width:3,fixed,hide"`
 
 	SrcEndpoint eventtypes.L4Endpoint `json:"src,omitempty" column:"src"`
 	DstEndpoint eventtypes.L4Endpoint `json:"dst,omitempty" column:"dst"`
 
+	// State is the state of the socket when the stats were collected, e.g.
+	// ESTABLISHED or TIME_WAIT
+	State string `json:"state,omitempty" column:"state,width:12"`
+
+	// Direction is "active" for the connections initiated by the process and
+	// "passive" for the ones it accepted. It's empty for the connections
+	// opened before the tracer started.
+	Direction string `json:"direction,omitempty" column:"direction,width:9"`
+
+	// RemoteName is the hostname of the remote address, only set when reverse
+	// DNS resolution is enabled and succeeded
+	RemoteName string `json:"remotename,omitempty" column:"remotename,width:32,hide"`
+
+	// Hostname is the last hostname seen for the remote endpoint, e.g. the
+	// SNI of a TLS handshake. It's only set when a hostname provider is
+	// registered with the HostnameAnnotator operator.
+	Hostname string `json:"hostname,omitempty" column:"hostname,width:32,hide"`
+
+	// RemoteASN, RemoteASOrg and RemoteCountry describe the network the
+	// remote address belongs to. They're only set when GeoIP databases are
+	// given to the GeoIPResolver operator.
+	RemoteASN     uint32 `json:"remoteAsn,omitempty" column:"asn,hide"`
+	RemoteASOrg   string `json:"remoteAsOrg,omitempty" column:"asorg,width:24,hide"`
+	RemoteCountry string `json:"remoteCountry,omitempty" column:"country,width:7,hide"`
+
+	// IsHost is set for the processes that couldn't be associated with any
+	// container or pod, i.e. the ones running on the host
+	IsHost bool `json:"isHost" column:"host,width:5,hide"`
+
+	// Group identifies the container or pod the stats were aggregated for,
+	// only set when grouping is enabled
+	Group string `json:"group,omitempty" column:"group,width:32,hide"`
+
 	Sent     uint64 `json:"sent,omitempty" column:"sent,order:1002"`
 	Received uint64 `json:"received,omitempty" column:"recv,order:1003"`
+	// Total is Sent + Received, to sort by the overall throughput
+	Total uint64 `json:"total,omitempty" column:"total,order:1004"`
+
+	// SentPackets and ReceivedPackets count the calls sending data and
+	// reading the received data, as counted by the sent_packets and
+	// received_packets fields of the eBPF map values
+	SentPackets     uint64 `json:"sentPackets,omitempty" column:"sentpkts,order:1005,hide"`
+	ReceivedPackets uint64 `json:"receivedPackets,omitempty" column:"recvpkts,order:1006,hide"`
+
+	// SentPct and ReceivedPct are the percentages of the bytes sent and
+	// received during the interval by all the rows, including the ones
+	// beyond max-rows, that this row represents. They're computed once the
+	// rows are filtered and grouped, so they're only meant to be displayed.
+	SentPct     float64 `json:"sentPct,omitempty" column:"sent%,order:1007,precision:1,width:6"`
+	ReceivedPct float64 `json:"receivedPct,omitempty" column:"recv%,order:1008,precision:1,width:6"`
+
+	// SentBps and ReceivedBps are the bytes sent and received per second
+	// during the interval, computed from its actual duration rather than the
+	// requested one. They're left to zero when the bytes are cumulative.
+	SentBps     uint64 `json:"sentBps,omitempty" column:"sent/s,order:1011,hide"`
+	ReceivedBps uint64 `json:"receivedBps,omitempty" column:"recv/s,order:1012,hide"`
+
+	// Delta is the change of the bytes sent and received compared to the
+	// previous interval, in delta mode. It's zero during the first interval,
+	// which has nothing to compare with.
+	Delta int64 `json:"delta,omitempty" column:"delta,order:1013,hide" columnDesc:"Change of the bytes sent and received compared to the previous interval, in delta mode. Sorting by it compares the absolute values."`
+
+	// RTT is the smoothed round trip time of the connection, in
+	// microseconds, read from the socket by the eBPF program the last time
+	// it sent or received data. It's zero until the kernel measured it.
+	// Groups report the RTT of their slowest connection.
+	RTT uint32 `json:"rtt,omitempty" column:"rtt,order:1009,hide" columnDesc:"Smoothed round trip time of the connection, in microseconds."`
+}
+
+// IsHost returns whether data doesn't identify any container or pod. Any of
+// their fields is enough to consider the process containerized, so the result
+// doesn't depend on which enrichers were able to fill data.
+func IsHost(data *eventtypes.CommonData) bool {
+	return data.Runtime.ContainerID == "" && data.Runtime.ContainerName == "" &&
+		data.K8s.PodName == "" && data.K8s.ContainerName == ""
+}
+
+// ContainerName returns the name of the container of data, preferring the one
+// known by Kubernetes, or an empty string for host processes
+func ContainerName(data *eventtypes.CommonData) string {
+	if data.K8s.ContainerName != "" {
+		return data.K8s.ContainerName
+	}
+	return data.Runtime.ContainerName
 }
 
 func (e *Stats) GetEndpoints() []*eventtypes.L3Endpoint {
 	return []*eventtypes.L3Endpoint{&e.SrcEndpoint.L3Endpoint, &e.DstEndpoint.L3Endpoint}
 }
 
+func (e *Stats) GetRemoteAddr() string {
+	return e.DstEndpoint.Addr
+}
+
+func (e *Stats) SetRemoteName(name string) {
+	e.RemoteName = name
+}
+
+func (e *Stats) SetRemoteGeo(asn uint32, asOrg string, country string) {
+	e.RemoteASN = asn
+	e.RemoteASOrg = asOrg
+	e.RemoteCountry = country
+}
+
+func (e *Stats) GetRemoteEndpoint() (string, uint16) {
+	return e.DstEndpoint.Addr, e.DstEndpoint.Port
+}
+
+func (e *Stats) SetHostname(name string) {
+	e.Hostname = name
+}
+
+func (e *Stats) GetPid() uint32 {
+	return uint32(e.Pid)
+}
+
+func (e *Stats) GetStartTime() uint64 {
+	return e.StartTime
+}
+
+func (e *Stats) SetExePath(path string) {
+	e.ExePath = path
+}
+
+func (e *Stats) SetCgroupPath(path string) {
+	e.CgroupPath = path
+}
+
+// Formatters render the byte columns of Stats in the text output
+var Formatters = top.Formatters[Stats]{
+	"sent":  top.BytesFormatter(func(stats *Stats) uint64 { return stats.Sent }),
+	"recv":  top.BytesFormatter(func(stats *Stats) uint64 { return stats.Received }),
+	"total": top.BytesFormatter(func(stats *Stats) uint64 { return stats.Total }),
+
+	"sent/s": top.BytesRateFormatter(func(stats *Stats) uint64 { return stats.SentBps }),
+	"recv/s": top.BytesRateFormatter(func(stats *Stats) uint64 { return stats.ReceivedBps }),
+}
+
+// GetColumns returns the columns of Stats, rendering the bytes in a
+// human-readable way
 func GetColumns() *columns.Columns[Stats] {
+	return NewColumns(true)
+}
+
+// NewColumns returns the columns of Stats, rendering the columns having a
+// formatter in a human-readable way if humanReadable is set
+func NewColumns(humanReadable bool) *columns.Columns[Stats] {
 	cols := columns.MustCreateColumns[Stats]()
 
-	cols.MustSetExtractor("sent", func(stats *Stats) any {
-		return fmt.Sprint(units.BytesSize(float64(stats.Sent)))
-	})
-	cols.MustSetExtractor("recv", func(stats *Stats) any {
-		return fmt.Sprint(units.BytesSize(float64(stats.Received)))
-	})
+	Formatters.Apply(cols, humanReadable)
 
 	eventtypes.MustAddVirtualL4EndpointColumn(
 		cols,
@@ -93,5 +492,77 @@ func GetColumns() *columns.Columns[Stats] {
 		func(s *Stats) eventtypes.L4Endpoint { return s.DstEndpoint },
 	)
 
+	// Compare the addresses as numbers rather than strings, so that e.g.
+	// 10.0.0.2 sorts before 10.0.0.10. IPv4 sorts before IPv6.
+	cols.MustSetComparator("src", func(a, b *Stats) int {
+		return compareL4Endpoints(a.SrcEndpoint, b.SrcEndpoint)
+	})
+	cols.MustSetComparator("dst", func(a, b *Stats) int {
+		return compareL4Endpoints(a.DstEndpoint, b.DstEndpoint)
+	})
+	// Containerized processes sort before the host ones
+	cols.MustSetComparator("host", func(a, b *Stats) int {
+		return compareBools(a.IsHost, b.IsHost)
+	})
+
+	cols.MustAddColumn(
+		columns.Attributes{
+			Name:        "container",
+			Width:       30,
+			Visible:     false,
+			Order:       1010,
+			Description: "Name of the container, as known by Kubernetes or else by the container runtime. Empty for host processes.",
+		},
+		func(s *Stats) any { return ContainerName(&s.CommonData) },
+	)
+	// Sort the processes without a container after the other ones, instead
+	// of first as the empty string would
+	cols.MustSetComparator("container", func(a, b *Stats) int {
+		nameA, nameB := ContainerName(&a.CommonData), ContainerName(&b.CommonData)
+		if c := compareBools(nameA == "", nameB == ""); c != 0 {
+			return c
+		}
+		return strings.Compare(nameA, nameB)
+	})
+
+	// The connections that changed the most sort last, whether they grew or
+	// shrank, so that "-delta" puts them first
+	cols.MustSetComparator("delta", func(a, b *Stats) int {
+		return cmp.Compare(absInt64(a.Delta), absInt64(b.Delta))
+	})
+
 	return cols
 }
+
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
+
+// ColumnsInfo describes the columns of Stats
+func ColumnsInfo() []top.ColumnInfo {
+	return top.ColumnsInfo(GetColumns())
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func compareL4Endpoints(a, b eventtypes.L4Endpoint) int {
+	// Invalid addresses are the zero netip.Addr, which sorts first
+	addrA, _ := netip.ParseAddr(a.Addr)
+	addrB, _ := netip.ParseAddr(b.Addr)
+	if c := addrA.Unmap().Compare(addrB.Unmap()); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Port, b.Port)
+}
@@ -0,0 +1,254 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns/sort"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+func newStats(addr string, port uint16) *Stats {
+	return &Stats{
+		DstEndpoint: eventtypes.L4Endpoint{
+			L3Endpoint: eventtypes.L3Endpoint{Addr: addr},
+			Port:       port,
+		},
+	}
+}
+
+func TestSortByAddress(t *testing.T) {
+	colMap := GetColumns().GetColumnMap()
+
+	require.True(t, sort.CanSortBy(colMap, SortByDefault))
+
+	stats := []*Stats{
+		newStats("::1", 80),
+		newStats("10.0.0.10", 80),
+		newStats("10.0.0.2", 443),
+		newStats("::ffff:10.0.0.3", 80),
+		newStats("10.0.0.2", 80),
+	}
+
+	sort.SortEntries(colMap, stats, []string{"dst"})
+
+	endpoints := make([]string, 0, len(stats))
+	for _, s := range stats {
+		endpoints = append(endpoints, s.DstEndpoint.String())
+	}
+	require.Equal(t, []string{
+		"10.0.0.2:80",
+		"10.0.0.2:443",
+		"::ffff:10.0.0.3:80",
+		"10.0.0.10:80",
+		"::1:80",
+	}, endpoints)
+}
+
+func TestParseTargetPids(t *testing.T) {
+	for _, all := range []string{"", "0", "-1", " 0 "} {
+		pids, err := ParseTargetPids(all)
+		require.NoError(t, err, all)
+		require.Nil(t, pids, all)
+	}
+
+	pids, err := ParseTargetPids("42")
+	require.NoError(t, err)
+	require.Equal(t, map[int32]struct{}{42: {}}, pids)
+
+	pids, err = ParseTargetPids("1, 42,1000,42")
+	require.NoError(t, err)
+	require.Equal(t, map[int32]struct{}{1: {}, 42: {}, 1000: {}}, pids)
+
+	for _, invalid := range []string{"abc", "1,", "1,0", "1,-2", "1,abc", "99999999999"} {
+		_, err = ParseTargetPids(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParseExcludePids(t *testing.T) {
+	pids, err := ParseExcludePids("")
+	require.NoError(t, err)
+	require.Empty(t, pids)
+
+	pids, err = ParseExcludePids("1, 42,1000")
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 42, 1000}, pids)
+
+	for _, invalid := range []string{"abc", "1,", "1,-2", "0"} {
+		_, err = ParseExcludePids(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParseFilterByFamily(t *testing.T) {
+	tests := map[string]int32{
+		"4":    syscall.AF_INET,
+		"v4":   syscall.AF_INET,
+		"V4":   syscall.AF_INET,
+		"ipv4": syscall.AF_INET,
+		"IPv4": syscall.AF_INET,
+		"6":    syscall.AF_INET6,
+		"v6":   syscall.AF_INET6,
+		"ipv6": syscall.AF_INET6,
+		"IPV6": syscall.AF_INET6,
+		" 4":   syscall.AF_INET,
+		"v6\n": syscall.AF_INET6,
+	}
+
+	for family, expected := range tests {
+		family, expected := family, expected
+		t.Run(family, func(t *testing.T) {
+			parsed, err := ParseFilterByFamily(family)
+			require.NoError(t, err)
+			require.Equal(t, expected, parsed)
+		})
+	}
+
+	for _, invalid := range []string{"", " ", "\t\n", "all", "5", "ip4", "ipv", "inet"} {
+		_, err := ParseFilterByFamily(invalid)
+		require.ErrorContains(t, err, fmt.Sprintf("IP version is either 4 (ipv4, v4) or 6 (ipv6, v6), %q was given", invalid))
+	}
+
+	_, err := ParseFilterByFamily("ipv5")
+	require.EqualError(t, err, `IP version is either 4 (ipv4, v4) or 6 (ipv6, v6), "ipv5" was given (did you mean "ipv4"?)`)
+
+	_, err = ParseFilterByFamily("5")
+	require.EqualError(t, err, `IP version is either 4 (ipv4, v4) or 6 (ipv6, v6), "5" was given`)
+}
+
+func TestFamilyToString(t *testing.T) {
+	for _, af := range []int32{syscall.AF_INET, syscall.AF_INET6} {
+		parsed, err := ParseFilterByFamily(FamilyToString(af))
+		require.NoError(t, err)
+		require.Equal(t, af, parsed)
+	}
+
+	require.Equal(t, "4", FamilyToString(syscall.AF_INET))
+	require.Equal(t, "6", FamilyToString(syscall.AF_INET6))
+	require.Equal(t, "all", FamilyToString(-1))
+	require.Equal(t, "all", FamilyToString(0))
+}
+
+func TestIsHost(t *testing.T) {
+	tests := map[string]struct {
+		data     eventtypes.CommonData
+		expected bool
+	}{
+		"not enriched": {expected: true},
+		"runtime only": {
+			data: eventtypes.CommonData{
+				Runtime: eventtypes.BasicRuntimeMetadata{ContainerID: "abc"},
+			},
+		},
+		"k8s only": {
+			data: eventtypes.CommonData{
+				K8s: eventtypes.K8sMetadata{BasicK8sMetadata: eventtypes.BasicK8sMetadata{PodName: "pod"}},
+			},
+		},
+		"node only": {
+			data: eventtypes.CommonData{
+				K8s: eventtypes.K8sMetadata{Node: "node"},
+			},
+			expected: true,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, IsHost(&test.data))
+		})
+	}
+}
+
+func TestSortByHost(t *testing.T) {
+	colMap := GetColumns().GetColumnMap()
+
+	stats := []*Stats{{Pid: 1, IsHost: true}, {Pid: 2}, {Pid: 3, IsHost: true}, {Pid: 4}}
+	sort.SortEntries(colMap, stats, []string{"host", "pid"})
+
+	pids := make([]int32, 0, len(stats))
+	for _, s := range stats {
+		pids = append(pids, s.Pid)
+	}
+	require.Equal(t, []int32{2, 4, 1, 3}, pids)
+}
+
+func TestSortByContainer(t *testing.T) {
+	colMap := GetColumns().GetColumnMap()
+
+	newStats := func(pid int32, k8sName, runtimeName string, sent uint64) *Stats {
+		s := &Stats{Pid: pid, Sent: sent}
+		s.K8s.ContainerName = k8sName
+		s.Runtime.ContainerName = runtimeName
+		return s
+	}
+
+	stats := []*Stats{
+		newStats(1, "", "", 10),
+		newStats(2, "web", "k8s_web_abc", 10),
+		newStats(3, "", "db", 20),
+		newStats(4, "", "", 30),
+		newStats(5, "web", "k8s_web_def", 30),
+		newStats(6, "api", "", 10),
+	}
+	sort.SortEntries(colMap, stats, []string{"container", "-sent"})
+
+	pids := make([]int32, 0, len(stats))
+	for _, s := range stats {
+		pids = append(pids, s.Pid)
+	}
+	// Host processes come last
+	require.Equal(t, []int32{6, 3, 5, 2, 4, 1}, pids)
+
+	require.Equal(t, "web", colMap["container"].Get(stats[2]).Interface())
+}
+
+func TestParseLocalAddr(t *testing.T) {
+	tests := map[string]struct {
+		addr          string
+		expected      string
+		expectedError bool
+	}{
+		"empty":         {addr: "", expected: "invalid Prefix"},
+		"ipv4":          {addr: "10.0.0.1", expected: "10.0.0.1/32"},
+		"ipv6":          {addr: "fd00::1", expected: "fd00::1/128"},
+		"ipv4 mapped":   {addr: "::ffff:10.0.0.1", expected: "10.0.0.1/32"},
+		"cidr":          {addr: "10.0.0.0/8", expected: "10.0.0.0/8"},
+		"cidr not base": {addr: "10.1.2.3/16", expected: "10.1.0.0/16"},
+		"invalid ip":    {addr: "10.0.0", expectedError: true},
+		"invalid cidr":  {addr: "10.0.0.0/33", expectedError: true},
+		"hostname":      {addr: "localhost", expectedError: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			prefix, err := ParseLocalAddr(test.addr)
+			if test.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, prefix.String())
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+)
+
+// AlignToClockParam makes the intervals of the gadget end on multiples of the
+// interval on the wall clock, e.g. on the second with an interval of 1s
+const AlignToClockParam = "align-to-clock"
+
+// AlignToClockParamDesc describes AlignToClockParam for the gadgets whose
+// tracer uses a Ticker
+func AlignToClockParamDesc() *params.ParamDesc {
+	return &params.ParamDesc{
+		Key:          AlignToClockParam,
+		Title:        "Align to clock",
+		Description:  "End the intervals on multiples of the interval on the wall clock, e.g. on the second, instead of relative to the start of the gadget",
+		DefaultValue: "false",
+		TypeHint:     params.TypeBool,
+	}
+}
+
+// Ticker delivers a tick on C at the end of each interval. By default, it
+// behaves as a time.Ticker. An aligned ticker instead computes the end of each
+// interval from the wall clock, as the next multiple of the interval since the
+// Unix epoch: the delays of the ticks don't accumulate and the ticks of
+// different tracers with the same interval happen at the same time. The first
+// interval of an aligned ticker is shorter, up to the first boundary, and the
+// boundaries missed because a tick was handled too late are skipped.
+//
+// Next must be called after each tick received from C.
+type Ticker struct {
+	C <-chan time.Time
+
+	ticker   *time.Ticker
+	timer    *time.Timer
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewTicker(interval time.Duration, aligned bool) *Ticker {
+	if !aligned {
+		ticker := time.NewTicker(interval)
+		return &Ticker{C: ticker.C, ticker: ticker, interval: interval}
+	}
+
+	t := &Ticker{interval: interval, now: time.Now}
+	t.timer = time.NewTimer(t.untilBoundary())
+	t.C = t.timer.C
+	return t
+}
+
+// untilBoundary returns the duration until the next multiple of the interval
+func (t *Ticker) untilBoundary() time.Duration {
+	return untilBoundary(t.now(), t.interval)
+}
+
+func untilBoundary(now time.Time, interval time.Duration) time.Duration {
+	return interval - time.Duration(now.UnixNano()%int64(interval))
+}
+
+// Next schedules the tick following the one just received
+func (t *Ticker) Next() {
+	if t.timer != nil {
+		t.timer.Reset(t.untilBoundary())
+	}
+}
+
+// Reset changes the interval of the ticker. An aligned ticker ticks on the
+// next boundary of the new interval.
+func (t *Ticker) Reset(interval time.Duration) {
+	t.interval = interval
+	if t.ticker != nil {
+		t.ticker.Reset(interval)
+		return
+	}
+	t.timer.Reset(t.untilBoundary())
+}
+
+func (t *Ticker) Stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+		return
+	}
+	t.timer.Stop()
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUntilBoundary(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		require.NoError(t, err)
+		return ts
+	}
+
+	tests := []struct {
+		name     string
+		now      string
+		interval time.Duration
+		expected time.Duration
+	}{
+		{name: "within the second", now: "2024-01-01T10:00:00.3Z", interval: time.Second, expected: 700 * time.Millisecond},
+		{name: "on the boundary", now: "2024-01-01T10:00:00Z", interval: time.Second, expected: time.Second},
+		{name: "multiple seconds", now: "2024-01-01T10:00:12Z", interval: 5 * time.Second, expected: 3 * time.Second},
+		{name: "minute", now: "2024-01-01T10:00:01Z", interval: time.Minute, expected: 59 * time.Second},
+		{name: "sub-second interval", now: "2024-01-01T10:00:00.45Z", interval: 100 * time.Millisecond, expected: 50 * time.Millisecond},
+		{name: "just before the boundary", now: "2024-01-01T10:00:00.999999999Z", interval: time.Second, expected: time.Nanosecond},
+		// Boundaries don't depend on the time zone of the clock
+		{name: "time zone", now: "2024-01-01T12:30:01+02:30", interval: time.Minute, expected: 59 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, untilBoundary(at(test.now), test.interval))
+		})
+	}
+}
+
+func TestAlignedTicker(t *testing.T) {
+	const interval = 50 * time.Millisecond
+
+	ticker := NewTicker(interval, true)
+	defer ticker.Stop()
+
+	for i := 0; i < 5; i++ {
+		tick := <-ticker.C
+		// The tick happens right after the boundary, late by at most
+		// the scheduling delay
+		require.Less(t, time.Duration(tick.UnixNano()%int64(interval)), interval/2)
+
+		// A slow consumer doesn't get late ticks
+		if i == 2 {
+			time.Sleep(interval + interval/2)
+		}
+		ticker.Next()
+	}
+
+	ticker.Reset(time.Hour)
+	select {
+	case <-ticker.C:
+		t.Fatal("Unexpected tick after reset")
+	case <-time.After(2 * interval):
+	}
+}
+
+func TestTicker(t *testing.T) {
+	ticker := NewTicker(10*time.Millisecond, false)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		<-ticker.C
+		ticker.Next()
+	}
+	require.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+}
@@ -15,11 +15,15 @@
 package top
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
 	columnssort "github.com/inspektor-gadget/inspektor-gadget/pkg/columns/sort"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
 )
 
 const (
@@ -29,17 +33,413 @@ const (
 	IntervalParam = "interval"
 	MaxRowsParam  = "max_rows"
 	SortByParam   = "sort_by"
+
+	OutputFormatParam = "output_format"
+
+	// AllowShortIntervalParam accepts intervals below MinInterval
+	AllowShortIntervalParam = "allow-short-interval"
+)
+
+// MinInterval is the shortest interval accepted unless AllowShortIntervalParam
+// is set. Shorter intervals report stats so often that they can overwhelm the
+// consumers of the events.
+const MinInterval = 1 * time.Second
+
+const (
+	// OutputFormatBatch marshals each batch of stats as a single JSON object
+	OutputFormatBatch = "batch"
+	// OutputFormatJSONLines marshals each row of a batch as a separate
+	// compact JSON object
+	OutputFormatJSONLines = "jsonl"
+
+	OutputFormatDefault = OutputFormatBatch
 )
 
 type Event[T any] struct {
 	Error string `json:"error,omitempty"`
 	Stats []*T   `json:"stats,omitempty"`
+
+	// IntervalStart and IntervalEnd delimit the interval the stats were
+	// collected over, in nanoseconds since January 1, 1970 UTC. They are left
+	// to zero, and omitted from the JSON output, when unknown.
+	IntervalStart eventtypes.Time `json:"intervalStart,omitempty"`
+	IntervalEnd   eventtypes.Time `json:"intervalEnd,omitempty"`
+
+	// Heartbeat is set on the events of intervals without any stats that
+	// are reported anyway, to let the consumers know the gadget is alive
+	Heartbeat bool `json:"heartbeat,omitempty"`
+
+	// DroppedBatches is the number of batches dropped since the gadget
+	// started because the consumers were too slow. It's only set when
+	// DropOnBackpressureParam is.
+	DroppedBatches uint64 `json:"droppedBatches,omitempty"`
+
+	// TotalBeforeFilter and TotalAfterFilter are the number of rows collected
+	// during the interval before and after the filters applied in userspace,
+	// so that users can tell whether the filters hide everything. The
+	// filters applied in the kernel, if any, drop rows before they're
+	// counted. Grouping and MaxRows apply after TotalAfterFilter.
+	TotalBeforeFilter uint64 `json:"totalBeforeFilter,omitempty"`
+	TotalAfterFilter  uint64 `json:"totalAfterFilter,omitempty"`
+
+	// Node is the name of the node the stats were collected on, so that the
+	// events of several nodes can be told apart once aggregated. It's empty
+	// when the node isn't known.
+	Node string `json:"node,omitempty"`
 }
 
+// SetInterval sets the boundaries of the interval the stats were collected
+// over.
+func (ev *Event[T]) SetInterval(start, end time.Time) {
+	ev.IntervalStart = eventtypes.Time(start.UnixNano())
+	ev.IntervalEnd = eventtypes.Time(end.UnixNano())
+}
+
+// ColumnInfo describes a column of the stats reported by a top gadget, so that
+// tools can render them without hardcoding the columns of each gadget
+type ColumnInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Sortable    bool   `json:"sortable"`
+	Visible     bool   `json:"visible"`
+	Description string `json:"description,omitempty"`
+}
+
+// ColumnsInfo returns the description of the columns in their default order
+func ColumnsInfo[T any](cols *columns.Columns[T]) []ColumnInfo {
+	ordered := cols.GetOrderedColumns()
+	infos := make([]ColumnInfo, 0, len(ordered))
+	for _, col := range ordered {
+		typ := col.Kind().String()
+		if rawType := col.RawType(); rawType != nil {
+			typ = rawType.String()
+		}
+		sortable, _ := columnssort.FilterSortableColumns(cols.ColumnMap, []string{col.Name})
+
+		infos = append(infos, ColumnInfo{
+			Name:        col.Name,
+			Type:        typ,
+			Sortable:    len(sortable) == 1,
+			Visible:     col.Visible,
+			Description: col.Description,
+		})
+	}
+	return infos
+}
+
+// SortStats sorts stats by the given columns, the first one having the highest
+// priority. Each column is sorted in ascending order unless it's prefixed with
+// "-", so directions can be mixed, e.g. []string{"-sent", "pid"}.
 func SortStats[T any](stats []*T, sortBy []string, colMap *columns.ColumnMap[T]) {
 	columnssort.SortEntries(*colMap, stats, sortBy)
 }
 
+// WithTiebreakers returns sortBy followed by the tiebreakers that it doesn't
+// sort by yet. Sorting by a set of columns that identifies each row makes the
+// order deterministic, so rows with equal values don't move between intervals.
+func WithTiebreakers(sortBy, tiebreakers []string) []string {
+	sorted := make(map[string]struct{}, len(sortBy))
+	for _, col := range sortBy {
+		sorted[strings.TrimPrefix(col, "-")] = struct{}{}
+	}
+
+	ret := make([]string, len(sortBy), len(sortBy)+len(tiebreakers))
+	copy(ret, sortBy)
+	for _, col := range tiebreakers {
+		if _, ok := sorted[strings.TrimPrefix(col, "-")]; !ok {
+			ret = append(ret, col)
+		}
+	}
+	return ret
+}
+
+// ParamError reports a parameter set to an invalid value
+type ParamError struct {
+	Param string
+	Value string
+	// Reason explains why the value is refused, it can be empty
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%q is not valid for %q", e.Value, e.Param)
+	}
+	return fmt.Sprintf("%q is not valid for %q: %s", e.Value, e.Param, e.Reason)
+}
+
+// CommonConfig holds the parameters shared by all the top gadgets
+type CommonConfig struct {
+	MaxRows      int
+	Interval     time.Duration
+	SortBy       []string
+	OutputFormat string
+	AlignToClock bool
+}
+
+// ParseCommonParams parses the parameters shared by all the top gadgets,
+// using their default value when not set. sortByDefault is used when
+// SortByParam isn't set, otherwise the columns given are checked against
+// cols. allowZeroInterval is passed to ParseInterval. The errors are either
+// a *ParamError or the one of ParseSortBy.
+func ParseCommonParams[T any](params map[string]string, cols *columns.Columns[T], sortByDefault []string, allowZeroInterval bool) (CommonConfig, error) {
+	config := CommonConfig{
+		MaxRows:      MaxRowsDefault,
+		SortBy:       sortByDefault,
+		OutputFormat: OutputFormatDefault,
+	}
+
+	if val, ok := params[MaxRowsParam]; ok {
+		maxRows, err := strconv.Atoi(val)
+		if err != nil {
+			return CommonConfig{}, &ParamError{Param: MaxRowsParam, Value: val}
+		}
+		if maxRows <= 0 {
+			return CommonConfig{}, &ParamError{Param: MaxRowsParam, Value: val, Reason: "must be positive"}
+		}
+		config.MaxRows = maxRows
+	}
+
+	var err error
+	config.Interval, err = ParseInterval(params, allowZeroInterval)
+	if err != nil {
+		return CommonConfig{}, err
+	}
+
+	if val, ok := params[SortByParam]; ok {
+		config.SortBy, err = ParseSortBy(cols, val)
+		if err != nil {
+			return CommonConfig{}, err
+		}
+	}
+
+	if val, ok := params[OutputFormatParam]; ok {
+		config.OutputFormat, err = ParseOutputFormat(val)
+		if err != nil {
+			return CommonConfig{}, &ParamError{Param: OutputFormatParam, Value: val}
+		}
+	}
+
+	if val, ok := params[AlignToClockParam]; ok {
+		config.AlignToClock, err = strconv.ParseBool(val)
+		if err != nil {
+			return CommonConfig{}, &ParamError{Param: AlignToClockParam, Value: val}
+		}
+	}
+
+	return config, nil
+}
+
+func ParseOutputFormat(format string) (string, error) {
+	switch format {
+	case OutputFormatBatch, OutputFormatJSONLines:
+		return format, nil
+	default:
+		return "", fmt.Errorf("output format is either %q or %q, %q was given", OutputFormatBatch, OutputFormatJSONLines, format)
+	}
+}
+
+// ParseInterval returns the interval set in params, IntervalDefault seconds if
+// it's not set. The interval is given either in seconds or as a duration, e.g.
+// "500ms". Intervals below MinInterval are refused unless
+// AllowShortIntervalParam is true. An interval of 0 is only accepted if
+// allowZero is set, for gadgets giving it a special meaning.
+func ParseInterval(params map[string]string, allowZero bool) (time.Duration, error) {
+	val, ok := params[IntervalParam]
+	if !ok {
+		return time.Duration(IntervalDefault) * time.Second, nil
+	}
+
+	var interval time.Duration
+	if seconds, err := strconv.Atoi(val); err == nil {
+		interval = time.Duration(seconds) * time.Second
+	} else if interval, err = time.ParseDuration(val); err != nil {
+		return 0, &ParamError{Param: IntervalParam, Value: val}
+	}
+
+	if interval < 0 {
+		return 0, &ParamError{Param: IntervalParam, Value: val, Reason: "must not be negative"}
+	}
+	if interval == 0 {
+		if allowZero {
+			return 0, nil
+		}
+		return 0, &ParamError{Param: IntervalParam, Value: val, Reason: "must be positive"}
+	}
+
+	allowShort := false
+	if val, ok := params[AllowShortIntervalParam]; ok {
+		var err error
+		allowShort, err = strconv.ParseBool(val)
+		if err != nil {
+			return 0, &ParamError{Param: AllowShortIntervalParam, Value: val}
+		}
+	}
+	if interval < MinInterval && !allowShort {
+		return 0, &ParamError{
+			Param:  IntervalParam,
+			Value:  val,
+			Reason: fmt.Sprintf("must be at least %s unless %q is set", MinInterval, AllowShortIntervalParam),
+		}
+	}
+
+	return interval, nil
+}
+
+// SortableColumns returns the names of the columns of cols that can be sorted
+// by, in their default order
+func SortableColumns[T any](cols *columns.Columns[T]) []string {
+	validCols, _ := columnssort.FilterSortableColumns(cols.ColumnMap, cols.GetColumnNames())
+	return validCols
+}
+
+// ParseSortBy returns the comma-separated columns of val, checking that cols
+// can be sorted by them. The columns are normalized: the spaces around them
+// are trimmed and their names lowercased, e.g. " -Sent" becomes "-sent". A
+// column prefixed with "-" sorts in descending order. The error lists the
+// sortable columns and, for the invalid columns that look like a mistyped one,
+// the closest sortable column.
+func ParseSortBy[T any](cols *columns.Columns[T], val string) ([]string, error) {
+	sortBy := strings.Split(val, ",")
+	for i, col := range sortBy {
+		sortBy[i] = strings.ToLower(strings.TrimSpace(col))
+	}
+
+	_, invalidCols := columnssort.FilterSortableColumns(cols.ColumnMap, sortBy)
+	if len(invalidCols) == 0 {
+		return sortBy, nil
+	}
+
+	validCols := SortableColumns(cols)
+
+	suggestions := []string{}
+	for _, col := range invalidCols {
+		prefix := ""
+		if strings.HasPrefix(col, "-") {
+			prefix = "-"
+		}
+		if match := ClosestMatch(strings.TrimPrefix(col, "-"), validCols); match != "" {
+			suggestions = append(suggestions, strconv.Quote(prefix+match))
+		}
+	}
+
+	hint := ""
+	if len(suggestions) > 0 {
+		hint = fmt.Sprintf(" (did you mean %s?)", strings.Join(suggestions, ", "))
+	}
+
+	return nil, fmt.Errorf("%q are not valid for %q%s, sortable columns are %s",
+		strings.Join(invalidCols, ","), SortByParam, hint, strings.Join(validCols, ","))
+}
+
+// ClosestMatch returns the value of candidates with the smallest edit
+// distance to name, ignoring the case, or "" if none is close enough to be a
+// typo of it
+func ClosestMatch(name string, candidates []string) string {
+	name = strings.ToLower(name)
+	maxDistance := max(1, len(name)/3)
+
+	closest := ""
+	closestDistance := maxDistance + 1
+	for _, candidate := range candidates {
+		if d := editDistance(name, strings.ToLower(candidate)); d < closestDistance {
+			closest = candidate
+			closestDistance = d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and
+// transpositions of adjacent characters needed to turn a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// MarshalEvent marshals ev using the given output format. The batch format
+// returns a single JSON object holding all the stats. The JSON Lines format
+// returns one JSON object per row, each one including the timestamp of the
+// batch in its "timestamp" field and, when known, the interval boundaries in
+// the "intervalStart" and "intervalEnd" fields, as well as "droppedBatches" if
+// any batch was dropped, "totalBeforeFilter" and "totalAfterFilter" if
+// counted and "node" if the node is known. A heartbeat event without any
+// row is marshaled as a single object with those fields and "heartbeat". Events
+// reporting an error are always marshaled as a single object.
+func MarshalEvent[T any](ev *Event[T], format string, timestamp time.Time) ([]string, error) {
+	if format != OutputFormatJSONLines || ev.Error != "" {
+		r, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(r)}, nil
+	}
+
+	ts, err := json.Marshal(timestamp.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	prefix := `{"timestamp":` + string(ts)
+	if ev.IntervalStart != 0 || ev.IntervalEnd != 0 {
+		prefix += fmt.Sprintf(`,"intervalStart":%d,"intervalEnd":%d`, ev.IntervalStart, ev.IntervalEnd)
+	}
+	if ev.DroppedBatches != 0 {
+		prefix += fmt.Sprintf(`,"droppedBatches":%d`, ev.DroppedBatches)
+	}
+	if ev.TotalBeforeFilter != 0 {
+		prefix += fmt.Sprintf(`,"totalBeforeFilter":%d,"totalAfterFilter":%d`, ev.TotalBeforeFilter, ev.TotalAfterFilter)
+	}
+	if ev.Node != "" {
+		node, err := json.Marshal(ev.Node)
+		if err != nil {
+			return nil, err
+		}
+		prefix += `,"node":` + string(node)
+	}
+
+	if ev.Heartbeat && len(ev.Stats) == 0 {
+		return []string{prefix + `,"heartbeat":true}`}, nil
+	}
+
+	lines := make([]string, 0, len(ev.Stats))
+	for _, stat := range ev.Stats {
+		r, err := json.Marshal(stat)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) < 2 || r[0] != '{' {
+			return nil, fmt.Errorf("stats must be marshaled as a JSON object")
+		}
+
+		line := prefix
+		if len(r) > 2 {
+			line += ","
+		}
+		lines = append(lines, line+string(r[1:]))
+	}
+	return lines, nil
+}
+
 // ComputeIterations returns the number of iterations to perform to get the
 // desired timeout. It returns zero if timeout is zero.
 func ComputeIterations(interval, timeout time.Duration) (int, error) {
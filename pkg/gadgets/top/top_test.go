@@ -0,0 +1,437 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+)
+
+type testStats struct {
+	Pid  int    `json:"pid" column:"pid"`
+	Sent uint64 `json:"sent" column:"sent"`
+	Recv uint64 `json:"recv" column:"recv"`
+}
+
+func TestSortStats(t *testing.T) {
+	cols := columns.MustCreateColumns[testStats]()
+	colMap := cols.GetColumnMap()
+
+	type testDefinition struct {
+		sortBy   []string
+		expected []int
+	}
+
+	tests := map[string]testDefinition{
+		"ascending": {
+			sortBy:   []string{"sent"},
+			expected: []int{3, 1, 2, 4},
+		},
+		"descending": {
+			sortBy:   []string{"-sent"},
+			expected: []int{4, 2, 1, 3},
+		},
+		"descending_then_ascending": {
+			sortBy:   []string{"-recv", "sent"},
+			expected: []int{3, 2, 1, 4},
+		},
+		"ascending_then_descending": {
+			sortBy:   []string{"recv", "-sent"},
+			expected: []int{4, 1, 2, 3},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			stats := []*testStats{
+				{Pid: 1, Sent: 20, Recv: 5},
+				{Pid: 2, Sent: 30, Recv: 50},
+				{Pid: 3, Sent: 10, Recv: 50},
+				{Pid: 4, Sent: 40, Recv: 5},
+			}
+
+			SortStats(stats, test.sortBy, &colMap)
+
+			pids := make([]int, 0, len(stats))
+			for _, s := range stats {
+				pids = append(pids, s.Pid)
+			}
+			require.Equal(t, test.expected, pids)
+		})
+	}
+}
+
+func TestMarshalEvent(t *testing.T) {
+	ev := &Event[testStats]{
+		Stats: []*testStats{
+			{Pid: 1, Sent: 20, Recv: 5},
+			{Pid: 2, Sent: 30, Recv: 50},
+		},
+	}
+	ts := time.Unix(0, 42)
+
+	lines, err := MarshalEvent(ev, OutputFormatBatch, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`{"stats":[{"pid":1,"sent":20,"recv":5},{"pid":2,"sent":30,"recv":50}]}`,
+	}, lines)
+
+	lines, err = MarshalEvent(ev, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`{"timestamp":42,"pid":1,"sent":20,"recv":5}`,
+		`{"timestamp":42,"pid":2,"sent":30,"recv":50}`,
+	}, lines)
+
+	ev.SetInterval(time.Unix(0, 10), time.Unix(0, 40))
+
+	lines, err = MarshalEvent(ev, OutputFormatBatch, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`{"stats":[{"pid":1,"sent":20,"recv":5},{"pid":2,"sent":30,"recv":50}],"intervalStart":10,"intervalEnd":40}`,
+	}, lines)
+
+	lines, err = MarshalEvent(ev, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`{"timestamp":42,"intervalStart":10,"intervalEnd":40,"pid":1,"sent":20,"recv":5}`,
+		`{"timestamp":42,"intervalStart":10,"intervalEnd":40,"pid":2,"sent":30,"recv":50}`,
+	}, lines)
+
+	lines, err = MarshalEvent(&Event[testStats]{Error: "failed"}, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"error":"failed"}`}, lines)
+
+	// Intervals without stats are only reported as heartbeats in JSON Lines
+	empty := &Event[testStats]{}
+	empty.SetInterval(time.Unix(0, 10), time.Unix(0, 40))
+
+	lines, err = MarshalEvent(empty, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	empty.Heartbeat = true
+
+	lines, err = MarshalEvent(empty, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"timestamp":42,"intervalStart":10,"intervalEnd":40,"heartbeat":true}`}, lines)
+
+	lines, err = MarshalEvent(empty, OutputFormatBatch, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"intervalStart":10,"intervalEnd":40,"heartbeat":true}`}, lines)
+
+	ev.DroppedBatches = 3
+
+	lines, err = MarshalEvent(ev, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, `{"timestamp":42,"intervalStart":10,"intervalEnd":40,"droppedBatches":3,"pid":1,"sent":20,"recv":5}`, lines[0])
+
+	ev.Node = "node-1"
+
+	lines, err = MarshalEvent(ev, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, `{"timestamp":42,"intervalStart":10,"intervalEnd":40,"droppedBatches":3,"node":"node-1","pid":1,"sent":20,"recv":5}`, lines[0])
+
+	ev.TotalBeforeFilter, ev.TotalAfterFilter = 5, 2
+
+	lines, err = MarshalEvent(ev, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, `{"timestamp":42,"intervalStart":10,"intervalEnd":40,"droppedBatches":3,"totalBeforeFilter":5,"totalAfterFilter":2,"node":"node-1","pid":1,"sent":20,"recv":5}`, lines[0])
+
+	empty.TotalBeforeFilter = 3
+
+	lines, err = MarshalEvent(empty, OutputFormatBatch, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"intervalStart":10,"intervalEnd":40,"heartbeat":true,"totalBeforeFilter":3}`}, lines)
+
+	empty.TotalBeforeFilter = 0
+	empty.Node = "node-1"
+
+	lines, err = MarshalEvent(empty, OutputFormatJSONLines, ts)
+	require.NoError(t, err)
+	require.Equal(t, []string{`{"timestamp":42,"intervalStart":10,"intervalEnd":40,"node":"node-1","heartbeat":true}`}, lines)
+}
+
+func TestWithTiebreakers(t *testing.T) {
+	require.Equal(t, []string{"-sent", "pid", "src"}, WithTiebreakers([]string{"-sent"}, []string{"pid", "src"}))
+	require.Equal(t, []string{"-pid", "sent", "src"}, WithTiebreakers([]string{"-pid", "sent"}, []string{"pid", "src"}))
+	require.Equal(t, []string{"pid"}, WithTiebreakers(nil, []string{"pid"}))
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := map[string]struct {
+		params        map[string]string
+		allowZero     bool
+		expected      time.Duration
+		expectedError bool
+	}{
+		"default":            {params: map[string]string{}, expected: time.Second},
+		"seconds":            {params: map[string]string{"interval": "5"}, expected: 5 * time.Second},
+		"duration":           {params: map[string]string{"interval": "1500ms"}, expected: 1500 * time.Millisecond},
+		"invalid":            {params: map[string]string{"interval": "foo"}, expectedError: true},
+		"negative":           {params: map[string]string{"interval": "-1"}, expectedError: true},
+		"zero":               {params: map[string]string{"interval": "0"}, expectedError: true},
+		"zero_allowed":       {params: map[string]string{"interval": "0"}, allowZero: true, expected: 0},
+		"below_floor":        {params: map[string]string{"interval": "100ms"}, expectedError: true},
+		"below_floor_denied": {params: map[string]string{"interval": "100ms", "allow-short-interval": "false"}, expectedError: true},
+		"below_floor_allowed": {
+			params:   map[string]string{"interval": "100ms", "allow-short-interval": "true"},
+			expected: 100 * time.Millisecond,
+		},
+		"zero_with_short_allowed": {
+			params:        map[string]string{"interval": "0", "allow-short-interval": "true"},
+			expectedError: true,
+		},
+		"invalid_override": {
+			params:        map[string]string{"interval": "100ms", "allow-short-interval": "maybe"},
+			expectedError: true,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			interval, err := ParseInterval(test.params, test.allowZero)
+			if test.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, interval)
+		})
+	}
+}
+
+func TestColumnsInfo(t *testing.T) {
+	cols := columns.MustCreateColumns[testStats]()
+	cols.MustAddColumn(columns.Attributes{Name: "virtual", Order: 1000}, func(*testStats) any { return "" })
+
+	require.Equal(t, []ColumnInfo{
+		{Name: "pid", Type: "int", Sortable: true, Visible: true},
+		{Name: "sent", Type: "uint64", Sortable: true, Visible: true},
+		{Name: "recv", Type: "uint64", Sortable: true, Visible: true},
+		{Name: "virtual", Type: "string", Sortable: false, Visible: false},
+	}, ColumnsInfo(cols))
+}
+
+func TestHistory(t *testing.T) {
+	require.Nil(t, NewHistory[testStats](0))
+
+	var nilHistory *History[testStats]
+	nilHistory.Add(&Event[testStats]{})
+	require.Empty(t, nilHistory.Events())
+
+	pids := func(events []*Event[testStats]) []int {
+		ret := make([]int, 0, len(events))
+		for _, ev := range events {
+			ret = append(ret, ev.Stats[0].Pid)
+		}
+		return ret
+	}
+
+	h := NewHistory[testStats](3)
+	require.Empty(t, h.Events())
+
+	for pid := 1; pid <= 5; pid++ {
+		h.Add(&Event[testStats]{Stats: []*testStats{{Pid: pid}}})
+		if pid == 2 {
+			require.Equal(t, []int{1, 2}, pids(h.Events()))
+		}
+	}
+	require.Equal(t, []int{3, 4, 5}, pids(h.Events()))
+}
+
+func TestDescribeError(t *testing.T) {
+	require.Equal(t, "loading ebpf program: foo", DescribeError(fmt.Errorf("loading ebpf program: %w", errors.New("foo"))))
+
+	log := make([]string, VerifierLogLines+5)
+	for i := range log {
+		log[i] = fmt.Sprintf("line %d", i)
+	}
+	ve := &ebpf.VerifierError{Cause: errors.New("permission denied"), Log: log}
+	desc := DescribeError(fmt.Errorf("loading ebpf program: %w", ve))
+
+	lines := strings.Split(desc, "\n")
+	require.Len(t, lines, VerifierLogLines+3)
+	require.Equal(t, "verifier log:", lines[1])
+	require.Equal(t, "\t(5 line(s) omitted)", lines[2])
+	require.Equal(t, "\tline 5", lines[3])
+	require.Equal(t, fmt.Sprintf("\tline %d", len(log)-1), lines[len(lines)-1])
+}
+
+func TestFormatters(t *testing.T) {
+	formatters := Formatters[testStats]{}
+	formatters.Register("sent", BytesFormatter(func(stats *testStats) uint64 { return stats.Sent }))
+	formatters.Register("pid", BytesRateFormatter(func(stats *testStats) uint64 { return uint64(stats.Pid) }))
+
+	stats := &testStats{Pid: 2048, Sent: 1536, Recv: 1536}
+
+	cols := columns.MustCreateColumns[testStats]()
+	formatters.Apply(cols, true)
+	sent, _ := cols.GetColumn("sent")
+	recv, _ := cols.GetColumn("recv")
+	require.Equal(t, "1.5KiB", sent.Get(stats).Interface())
+	pid, _ := cols.GetColumn("pid")
+	require.Equal(t, "2KiB/s", pid.Get(stats).Interface())
+	require.Equal(t, uint64(1536), recv.Get(stats).Interface())
+
+	cols = columns.MustCreateColumns[testStats]()
+	formatters.Apply(cols, false)
+	sent, _ = cols.GetColumn("sent")
+	require.Equal(t, uint64(1536), sent.Get(stats).Interface())
+}
+
+func TestParseSortBy(t *testing.T) {
+	cols := columns.MustCreateColumns[testStats]()
+
+	sortBy, err := ParseSortBy(cols, "-sent,pid")
+	require.NoError(t, err)
+	require.Equal(t, []string{"-sent", "pid"}, sortBy)
+
+	_, err = ParseSortBy(cols, "-snet,pid")
+	require.EqualError(t, err, `"-snet" are not valid for "sort_by" (did you mean "-sent"?), sortable columns are pid,sent,recv`)
+
+	_, err = ParseSortBy(cols, "foo,rcv")
+	require.EqualError(t, err, `"foo,rcv" are not valid for "sort_by" (did you mean "recv"?), sortable columns are pid,sent,recv`)
+
+	tests := map[string]struct {
+		val      string
+		expected []string
+		invalid  string
+	}{
+		"single":                 {val: "sent", expected: []string{"sent"}},
+		"descending":             {val: "-recv", expected: []string{"-recv"}},
+		"mixed":                  {val: "pid,-sent,recv", expected: []string{"pid", "-sent", "recv"}},
+		"spaces":                 {val: " -sent , pid ", expected: []string{"-sent", "pid"}},
+		"case":                   {val: "-Sent,PID", expected: []string{"-sent", "pid"}},
+		"empty":                  {val: "", invalid: `""`},
+		"empty column":           {val: "sent,,pid", invalid: `""`},
+		"dash only":              {val: "-", invalid: `"-"`},
+		"double dash":            {val: "--sent", invalid: `"--sent"`},
+		"descending and unknown": {val: "-foo", invalid: `"-foo"`},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			sortBy, err := ParseSortBy(cols, test.val)
+			if test.invalid != "" {
+				require.ErrorContains(t, err, test.invalid+` are not valid for "sort_by"`)
+				require.Nil(t, sortBy)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, sortBy)
+		})
+	}
+}
+
+func TestSortableColumns(t *testing.T) {
+	cols := columns.MustCreateColumns[testStats]()
+	require.Equal(t, []string{"pid", "sent", "recv"}, SortableColumns(cols))
+
+	// Virtual columns can only be sorted by with a comparator
+	cols.MustAddColumn(columns.Attributes{Name: "virtual", Order: 1000}, func(*testStats) any { return "" })
+	require.Equal(t, []string{"pid", "sent", "recv"}, SortableColumns(cols))
+
+	cols.MustSetComparator("virtual", func(a, b *testStats) int { return 0 })
+	require.Equal(t, []string{"pid", "sent", "recv", "virtual"}, SortableColumns(cols))
+}
+
+func TestParseCommonParams(t *testing.T) {
+	cols := columns.MustCreateColumns[testStats]()
+
+	config, err := ParseCommonParams(nil, cols, []string{"-sent"}, false)
+	require.NoError(t, err)
+	require.Equal(t, CommonConfig{
+		MaxRows:      MaxRowsDefault,
+		Interval:     time.Second,
+		SortBy:       []string{"-sent"},
+		OutputFormat: OutputFormatBatch,
+	}, config)
+
+	config, err = ParseCommonParams(map[string]string{
+		"max_rows":       "5",
+		"interval":       "2",
+		"sort_by":        "pid",
+		"output_format":  "jsonl",
+		"align-to-clock": "true",
+	}, cols, []string{"-sent"}, false)
+	require.NoError(t, err)
+	require.Equal(t, CommonConfig{
+		MaxRows:      5,
+		Interval:     2 * time.Second,
+		SortBy:       []string{"pid"},
+		OutputFormat: OutputFormatJSONLines,
+		AlignToClock: true,
+	}, config)
+
+	var paramErr *ParamError
+	_, err = ParseCommonParams(map[string]string{"max_rows": "0"}, cols, nil, false)
+	require.ErrorAs(t, err, &paramErr)
+	require.Equal(t, &ParamError{Param: "max_rows", Value: "0", Reason: "must be positive"}, paramErr)
+	require.EqualError(t, err, `"0" is not valid for "max_rows": must be positive`)
+
+	_, err = ParseCommonParams(map[string]string{"interval": "-1"}, cols, nil, false)
+	require.ErrorAs(t, err, &paramErr)
+	require.Equal(t, "interval", paramErr.Param)
+
+	_, err = ParseCommonParams(map[string]string{"output_format": "xml"}, cols, nil, false)
+	require.EqualError(t, err, `"xml" is not valid for "output_format"`)
+
+	_, err = ParseCommonParams(map[string]string{"align-to-clock": "sometimes"}, cols, nil, false)
+	require.EqualError(t, err, `"sometimes" is not valid for "align-to-clock"`)
+}
+
+func TestPublisher(t *testing.T) {
+	var published []string
+	blocked := make(chan struct{})
+	unblock := make(chan struct{})
+	p := NewPublisher(func(line string) {
+		if line == "block" {
+			close(blocked)
+			<-unblock
+		}
+		published = append(published, line)
+	})
+
+	// Keep the consumer busy so the next batches are queued
+	p.Publish([]string{"block"})
+	<-blocked
+
+	for i := 0; i < PublisherQueueSize+2; i++ {
+		p.Publish([]string{fmt.Sprintf("batch %d", i)})
+	}
+	require.Equal(t, uint64(2), p.Dropped())
+
+	close(unblock)
+	p.Close()
+	p.Close()
+
+	// The oldest batches were dropped, the queued ones are flushed by Close
+	require.Len(t, published, PublisherQueueSize+1)
+	require.Equal(t, "block", published[0])
+	require.Equal(t, "batch 2", published[1])
+	require.Equal(t, fmt.Sprintf("batch %d", PublisherQueueSize+1), published[len(published)-1])
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: GPL-2.0
+/* Copyright (c) 2024 The Inspektor Gadget authors */
+#include <vmlinux.h>
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_core_read.h>
+#include <bpf/bpf_tracing.h>
+#include <bpf/bpf_endian.h>
+
+#include "udptop.h"
+#include <gadget/mntns_filter.h>
+
+/* Taken from kernel include/linux/socket.h. */
+#define AF_INET 2 /* Internet IP Protocol 	*/
+#define AF_INET6 10 /* IP version 6			*/
+
+const volatile pid_t target_pid = 0;
+const volatile int target_family = -1;
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 10240);
+	__type(key, struct ip_key_t);
+	__type(value, struct traffic_t);
+} ip_map SEC(".maps");
+
+static int probe_ip(bool receiving, struct sock *sk, size_t size)
+{
+	struct ip_key_t ip_key = {};
+	struct traffic_t *trafficp;
+	u64 mntns_id;
+	u16 family;
+	u32 pid;
+
+	pid = bpf_get_current_pid_tgid() >> 32;
+	if (target_pid != 0 && target_pid != pid)
+		return 0;
+
+	family = BPF_CORE_READ(sk, __sk_common.skc_family);
+	if (target_family != -1 && target_family != family)
+		return 0;
+
+	/* drop */
+	if (family != AF_INET && family != AF_INET6)
+		return 0;
+
+	mntns_id = gadget_get_current_mntns_id();
+
+	if (gadget_should_discard_mntns_id(mntns_id))
+		return 0;
+
+	ip_key.pid = pid;
+	bpf_get_current_comm(&ip_key.name, sizeof(ip_key.name));
+	ip_key.lport = BPF_CORE_READ(sk, __sk_common.skc_num);
+	ip_key.dport = bpf_ntohs(BPF_CORE_READ(sk, __sk_common.skc_dport));
+	ip_key.family = family;
+	ip_key.mntnsid = mntns_id;
+
+	/*
+	 * The destination is only known for connected sockets, it's left to zero
+	 * for the ones passing the address to each sendmsg() call.
+	 */
+	if (family == AF_INET) {
+		bpf_probe_read_kernel(&ip_key.saddr,
+				      sizeof(sk->__sk_common.skc_rcv_saddr),
+				      &sk->__sk_common.skc_rcv_saddr);
+		bpf_probe_read_kernel(&ip_key.daddr,
+				      sizeof(sk->__sk_common.skc_daddr),
+				      &sk->__sk_common.skc_daddr);
+	} else {
+		bpf_probe_read_kernel(
+			&ip_key.saddr,
+			sizeof(sk->__sk_common.skc_v6_rcv_saddr.in6_u.u6_addr32),
+			&sk->__sk_common.skc_v6_rcv_saddr.in6_u.u6_addr32);
+		bpf_probe_read_kernel(
+			&ip_key.daddr,
+			sizeof(sk->__sk_common.skc_v6_daddr.in6_u.u6_addr32),
+			&sk->__sk_common.skc_v6_daddr.in6_u.u6_addr32);
+	}
+
+	trafficp = bpf_map_lookup_elem(&ip_map, &ip_key);
+	if (!trafficp) {
+		struct traffic_t zero = {};
+
+		if (receiving) {
+			zero.received = size;
+			zero.received_packets = 1;
+		} else {
+			zero.sent = size;
+			zero.sent_packets = 1;
+		}
+
+		bpf_map_update_elem(&ip_map, &ip_key, &zero, BPF_NOEXIST);
+	} else {
+		if (receiving) {
+			__sync_fetch_and_add(&trafficp->received, size);
+			__sync_fetch_and_add(&trafficp->received_packets, 1);
+		} else {
+			__sync_fetch_and_add(&trafficp->sent, size);
+			__sync_fetch_and_add(&trafficp->sent_packets, 1);
+		}
+	}
+
+	return 0;
+}
+
+SEC("kprobe/udp_sendmsg")
+int BPF_KPROBE(ig_topudp_sdmsg, struct sock *sk, struct msghdr *msg,
+	       size_t size)
+{
+	return probe_ip(false, sk, size);
+}
+
+SEC("kprobe/udpv6_sendmsg")
+int BPF_KPROBE(ig_topudp_sdmsg6, struct sock *sk, struct msghdr *msg,
+	       size_t size)
+{
+	return probe_ip(false, sk, size);
+}
+
+/*
+ * skb_consume_udp() is called by both udp_recvmsg() and udpv6_recvmsg() once
+ * the datagram was copied to userspace, len being the number of bytes copied.
+ * It's negative when the datagram was only peeked at.
+ */
+SEC("kprobe/skb_consume_udp")
+int BPF_KPROBE(ig_topudp_consume, struct sock *sk, struct sk_buff *skb,
+	       int len)
+{
+	if (len <= 0)
+		return 0;
+
+	return probe_ip(true, sk, len);
+}
+
+char LICENSE[] SEC("license") = "GPL";
@@ -0,0 +1,84 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracer is deprecated.
+//
+// Deprecated: Switch to image-based gadgets instead. Check
+// https://github.com/inspektor-gadget/inspektor-gadget/tree/main/examples/gadgets
+package tracer
+
+import (
+	gadgetregistry "github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-registry"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/udp/types"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/parser"
+)
+
+type GadgetDesc struct {
+	gadgets.GadgetDeprecated
+}
+
+func (g *GadgetDesc) Name() string {
+	return "udp"
+}
+
+func (g *GadgetDesc) Category() string {
+	return gadgets.CategoryTop
+}
+
+func (g *GadgetDesc) Type() gadgets.GadgetType {
+	return gadgets.TypeTraceIntervals
+}
+
+func (g *GadgetDesc) Description() string {
+	return "Periodically report UDP activity"
+}
+
+func (g *GadgetDesc) ParamDescs() params.ParamDescs {
+	return params.ParamDescs{
+		{
+			Key:          types.PidParam,
+			Title:        "PID",
+			Description:  "Show only UDP events generated by this particular PID (0 for all)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeInt32,
+		},
+		{
+			Key:            types.FamilyParam,
+			Alias:          "f",
+			DefaultValue:   "all",
+			Description:    "Show only UDP events for this IP version: either 4 or 6 (by default all will be printed)",
+			PossibleValues: []string{"all", "4", "6"},
+		},
+		top.AlignToClockParamDesc(),
+	}
+}
+
+func (g *GadgetDesc) Parser() parser.Parser {
+	return parser.NewParser[types.Stats](types.GetColumns())
+}
+
+func (g *GadgetDesc) EventPrototype() any {
+	return &types.Stats{}
+}
+
+func (g *GadgetDesc) SortByDefault() []string {
+	return types.SortByDefault
+}
+
+func init() {
+	gadgetregistry.Register(&GadgetDesc{})
+}
@@ -0,0 +1,336 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !withoutebpf
+
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/columns"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets/top/udp/types"
+	eventtypes "github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -no-global-types -target $TARGET -type ip_key_t -type traffic_t -cc clang -cflags ${CFLAGS} udptop ./bpf/udptop.bpf.c -- -I./bpf/
+
+type Config struct {
+	MountnsMap   *ebpf.Map
+	TargetPid    int32
+	TargetFamily int32
+	MaxRows      int
+	Interval     time.Duration
+	Iterations   int
+	SortBy       []string
+	// AlignToClock ends the intervals on multiples of the interval on the
+	// wall clock
+	AlignToClock bool
+}
+
+type Tracer struct {
+	config           *Config
+	objs             udptopObjects
+	udpSendmsgLink   link.Link
+	udpv6SendmsgLink link.Link
+	consumeLink      link.Link
+	enricher         gadgets.DataEnricherByMntNs
+	eventCallback    func(*top.Event[types.Stats])
+	done             chan bool
+	colMap           columns.ColumnMap[types.Stats]
+}
+
+func NewTracer(config *Config, enricher gadgets.DataEnricherByMntNs,
+	eventCallback func(*top.Event[types.Stats]),
+) (*Tracer, error) {
+	t := &Tracer{
+		config:        config,
+		enricher:      enricher,
+		eventCallback: eventCallback,
+		done:          make(chan bool),
+	}
+
+	if err := t.install(); err != nil {
+		t.close()
+		return nil, err
+	}
+
+	statCols, err := columns.NewColumns[types.Stats]()
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	t.colMap = statCols.GetColumnMap()
+
+	go t.run(context.TODO())
+
+	return t, nil
+}
+
+// Stop stops the tracer
+// TODO: Remove after refactoring
+func (t *Tracer) Stop() {
+	t.close()
+}
+
+func (t *Tracer) close() {
+	close(t.done)
+
+	t.udpSendmsgLink = gadgets.CloseLink(t.udpSendmsgLink)
+	t.udpv6SendmsgLink = gadgets.CloseLink(t.udpv6SendmsgLink)
+	t.consumeLink = gadgets.CloseLink(t.consumeLink)
+
+	t.objs.Close()
+}
+
+func (t *Tracer) install() error {
+	spec, err := loadUdptop()
+	if err != nil {
+		return fmt.Errorf("loading ebpf program: %w", err)
+	}
+
+	consts := map[string]interface{}{
+		"target_pid":    t.config.TargetPid,
+		"target_family": t.config.TargetFamily,
+	}
+
+	if err := gadgets.LoadeBPFSpec(t.config.MountnsMap, spec, consts, &t.objs); err != nil {
+		return fmt.Errorf("loading ebpf spec: %w", err)
+	}
+
+	t.udpSendmsgLink, err = link.Kprobe("udp_sendmsg", t.objs.IgTopudpSdmsg, nil)
+	if err != nil {
+		return fmt.Errorf("attaching kprobe: %w", err)
+	}
+
+	t.udpv6SendmsgLink, err = link.Kprobe("udpv6_sendmsg", t.objs.IgTopudpSdmsg6, nil)
+	if err != nil {
+		return fmt.Errorf("attaching kprobe: %w", err)
+	}
+
+	t.consumeLink, err = link.Kprobe("skb_consume_udp", t.objs.IgTopudpConsume, nil)
+	if err != nil {
+		return fmt.Errorf("attaching kprobe: %w", err)
+	}
+
+	return nil
+}
+
+func (t *Tracer) nextStats() ([]*types.Stats, error) {
+	stats := []*types.Stats{}
+
+	var prev *udptopIpKeyT = nil
+	key := udptopIpKeyT{}
+	ips := t.objs.IpMap
+
+	defer func() {
+		// delete elements
+		err := ips.NextKey(nil, unsafe.Pointer(&key))
+		if err != nil {
+			return
+		}
+
+		for {
+			if err := ips.Delete(key); err != nil {
+				return
+			}
+
+			prev = &key
+			if err := ips.NextKey(unsafe.Pointer(prev), unsafe.Pointer(&key)); err != nil {
+				return
+			}
+		}
+	}()
+
+	// gather elements
+	err := ips.NextKey(nil, unsafe.Pointer(&key))
+	if err != nil {
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return stats, nil
+		}
+		return nil, fmt.Errorf("getting next key: %w", err)
+	}
+
+	for {
+		val := udptopTrafficT{}
+		if err := ips.Lookup(key, unsafe.Pointer(&val)); err != nil {
+			return nil, err
+		}
+
+		ipversion := gadgets.IPVerFromAF(key.Family)
+
+		stat := types.Stats{
+			WithMountNsID: eventtypes.WithMountNsID{MountNsID: key.Mntnsid},
+			Pid:           int32(key.Pid),
+			Comm:          gadgets.FromCString(key.Name[:]),
+			SrcEndpoint: eventtypes.L4Endpoint{
+				L3Endpoint: eventtypes.L3Endpoint{
+					Addr:    gadgets.IPStringFromBytes(key.Saddr, ipversion),
+					Version: uint8(ipversion),
+				},
+				Port: key.Lport,
+			},
+			DstEndpoint: eventtypes.L4Endpoint{
+				L3Endpoint: eventtypes.L3Endpoint{
+					Addr:    gadgets.IPStringFromBytes(key.Daddr, ipversion),
+					Version: uint8(ipversion),
+				},
+				Port: key.Dport,
+			},
+			IPVersion:       ipversion,
+			Sent:            val.Sent,
+			Received:        val.Received,
+			SentPackets:     val.SentPackets,
+			ReceivedPackets: val.ReceivedPackets,
+		}
+
+		if t.enricher != nil {
+			t.enricher.EnrichByMntNs(&stat.CommonData, stat.MountNsID)
+		}
+
+		stats = append(stats, &stat)
+
+		prev = &key
+		if err := ips.NextKey(unsafe.Pointer(prev), unsafe.Pointer(&key)); err != nil {
+			if errors.Is(err, ebpf.ErrKeyNotExist) {
+				break
+			}
+			return nil, fmt.Errorf("getting next key: %w", err)
+		}
+	}
+
+	top.SortStats(stats, t.config.SortBy, &t.colMap)
+
+	return stats, nil
+}
+func (t *Tracer) run(ctx context.Context) error {
+	// Don't use a context with a timeout but a counter to avoid having to deal
+	// with two timers: one for the timeout and another for the ticker.
+	count := t.config.Iterations
+	ticker := top.NewTicker(t.config.Interval, t.config.AlignToClock)
+	defer ticker.Stop()
+
+	intervalStart := time.Now()
+
+	for {
+		select {
+		case <-t.done:
+			// TODO: Once we completely move to use Run instead of NewTracer,
+			// we can remove this as nobody will directly call Stop (cleanup).
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			intervalEnd := time.Now()
+			ticker.Next()
+			stats, err := t.nextStats()
+			if err != nil {
+				return fmt.Errorf("getting next stats: %w", err)
+			}
+
+			n := len(stats)
+			if n > t.config.MaxRows {
+				n = t.config.MaxRows
+			}
+			ev := &top.Event[types.Stats]{Stats: stats[:n]}
+			ev.SetInterval(intervalStart, intervalEnd)
+			intervalStart = intervalEnd
+
+			t.eventCallback(ev)
+
+			// Count down only if user requested a finite number of iterations
+			// through a timeout.
+			if t.config.Iterations > 0 {
+				count--
+				if count == 0 {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) Run(gadgetCtx gadgets.GadgetContext) error {
+	if err := t.init(gadgetCtx); err != nil {
+		return fmt.Errorf("initializing tracer: %w", err)
+	}
+
+	defer t.close()
+	if err := t.install(); err != nil {
+		return fmt.Errorf("installing tracer: %w", err)
+	}
+
+	return t.run(gadgetCtx.Context())
+}
+
+func (t *Tracer) SetEventHandlerArray(handler any) {
+	nh, ok := handler.(func(ev []*types.Stats))
+	if !ok {
+		panic("event handler invalid")
+	}
+
+	// TODO: add errorHandler
+	t.eventCallback = func(ev *top.Event[types.Stats]) {
+		if ev.Error != "" {
+			return
+		}
+		nh(ev.Stats)
+	}
+}
+
+func (t *Tracer) SetMountNsMap(mntnsMap *ebpf.Map) {
+	t.config.MountnsMap = mntnsMap
+}
+
+func (g *GadgetDesc) NewInstance() (gadgets.Gadget, error) {
+	tracer := &Tracer{
+		config: &Config{
+			TargetFamily: -1,
+		},
+		done: make(chan bool),
+	}
+	return tracer, nil
+}
+
+func (t *Tracer) init(gadgetCtx gadgets.GadgetContext) error {
+	params := gadgetCtx.GadgetParams()
+	t.config.MaxRows = params.Get(gadgets.ParamMaxRows).AsInt()
+	t.config.SortBy = params.Get(gadgets.ParamSortBy).AsStringSlice()
+	t.config.Interval = time.Second * time.Duration(params.Get(gadgets.ParamInterval).AsInt())
+	t.config.AlignToClock = params.Get(top.AlignToClockParam).AsBool()
+	t.config.TargetFamily, _ = types.ParseFilterByFamily(params.Get(types.FamilyParam).AsString())
+	t.config.TargetPid = params.Get(types.PidParam).AsInt32()
+
+	var err error
+	if t.config.Iterations, err = top.ComputeIterations(t.config.Interval, gadgetCtx.Timeout()); err != nil {
+		return err
+	}
+
+	statCols, err := columns.NewColumns[types.Stats]()
+	if err != nil {
+		return err
+	}
+	t.colMap = statCols.GetColumnMap()
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build 386 || amd64
+
+package tracer
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+type udptopIpKeyT struct {
+	Saddr   [16]uint8
+	Daddr   [16]uint8
+	Mntnsid uint64
+	Pid     uint32
+	Name    [16]uint8
+	Lport   uint16
+	Dport   uint16
+	Family  uint16
+	_       [6]byte
+}
+
+type udptopTrafficT struct {
+	Sent            uint64
+	Received        uint64
+	SentPackets     uint64
+	ReceivedPackets uint64
+}
+
+// loadUdptop returns the embedded CollectionSpec for udptop.
+func loadUdptop() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_UdptopBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load udptop: %w", err)
+	}
+
+	return spec, err
+}
+
+// loadUdptopObjects loads udptop and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*udptopObjects
+//	*udptopPrograms
+//	*udptopMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func loadUdptopObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := loadUdptop()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// udptopSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type udptopSpecs struct {
+	udptopProgramSpecs
+	udptopMapSpecs
+	udptopVariableSpecs
+}
+
+// udptopProgramSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type udptopProgramSpecs struct {
+	IgTopudpConsume *ebpf.ProgramSpec `ebpf:"ig_topudp_consume"`
+	IgTopudpSdmsg   *ebpf.ProgramSpec `ebpf:"ig_topudp_sdmsg"`
+	IgTopudpSdmsg6  *ebpf.ProgramSpec `ebpf:"ig_topudp_sdmsg6"`
+}
+
+// udptopMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type udptopMapSpecs struct {
+	GadgetMntnsFilterMap *ebpf.MapSpec `ebpf:"gadget_mntns_filter_map"`
+	IpMap                *ebpf.MapSpec `ebpf:"ip_map"`
+}
+
+// udptopVariableSpecs contains global variables before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type udptopVariableSpecs struct {
+	GadgetFilterByMntns *ebpf.VariableSpec `ebpf:"gadget_filter_by_mntns"`
+	TargetFamily        *ebpf.VariableSpec `ebpf:"target_family"`
+	TargetPid           *ebpf.VariableSpec `ebpf:"target_pid"`
+}
+
+// udptopObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to loadUdptopObjects or ebpf.CollectionSpec.LoadAndAssign.
+type udptopObjects struct {
+	udptopPrograms
+	udptopMaps
+	udptopVariables
+}
+
+func (o *udptopObjects) Close() error {
+	return _UdptopClose(
+		&o.udptopPrograms,
+		&o.udptopMaps,
+	)
+}
+
+// udptopMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to loadUdptopObjects or ebpf.CollectionSpec.LoadAndAssign.
+type udptopMaps struct {
+	GadgetMntnsFilterMap *ebpf.Map `ebpf:"gadget_mntns_filter_map"`
+	IpMap                *ebpf.Map `ebpf:"ip_map"`
+}
+
+func (m *udptopMaps) Close() error {
+	return _UdptopClose(
+		m.GadgetMntnsFilterMap,
+		m.IpMap,
+	)
+}
+
+// udptopVariables contains all global variables after they have been loaded into the kernel.
+//
+// It can be passed to loadUdptopObjects or ebpf.CollectionSpec.LoadAndAssign.
+type udptopVariables struct {
+	GadgetFilterByMntns *ebpf.Variable `ebpf:"gadget_filter_by_mntns"`
+	TargetFamily        *ebpf.Variable `ebpf:"target_family"`
+	TargetPid           *ebpf.Variable `ebpf:"target_pid"`
+}
+
+// udptopPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to loadUdptopObjects or ebpf.CollectionSpec.LoadAndAssign.
+type udptopPrograms struct {
+	IgTopudpConsume *ebpf.Program `ebpf:"ig_topudp_consume"`
+	IgTopudpSdmsg   *ebpf.Program `ebpf:"ig_topudp_sdmsg"`
+	IgTopudpSdmsg6  *ebpf.Program `ebpf:"ig_topudp_sdmsg6"`
+}
+
+func (p *udptopPrograms) Close() error {
+	return _UdptopClose(
+		p.IgTopudpConsume,
+		p.IgTopudpSdmsg,
+		p.IgTopudpSdmsg6,
+	)
+}
+
+func _UdptopClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//
+//go:embed udptop_x86_bpfel.o
+var _UdptopBytes []byte
@@ -0,0 +1,311 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cgroupresolver provides an operator that enriches events by
+// resolving the pid of the process that generated them to its cgroup, as
+// listed in /proc/<pid>/cgroup on the host. The cgroup v2 path is preferred,
+// the path in the systemd hierarchy is used on hosts without cgroup v2.
+// Results are cached by pid until the process exits.
+package cgroupresolver
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/container-utils/cgroups"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
+)
+
+const (
+	OperatorName = "CgroupResolver"
+
+	// sweepInterval is the interval at which the entries of the processes
+	// that exited are removed from the cache
+	sweepInterval = 10 * time.Second
+)
+
+type CgroupResolverInterface interface {
+	GetPid() uint32
+	SetCgroupPath(string)
+}
+
+// CgroupIDResolverInterface is implemented by events that want the id of the
+// cgroup v2 of the process, i.e. the inode number of its directory. It's not
+// set on hosts without cgroup v2.
+type CgroupIDResolverInterface interface {
+	GetPid() uint32
+	SetCgroupID(uint64)
+}
+
+type CgroupResolver struct{}
+
+func (c *CgroupResolver) Name() string {
+	return OperatorName
+}
+
+func (c *CgroupResolver) Description() string {
+	return "CgroupResolver resolves pids to the path and id of their cgroup"
+}
+
+func (c *CgroupResolver) GlobalParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (c *CgroupResolver) ParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (c *CgroupResolver) Dependencies() []string {
+	return nil
+}
+
+// OptionalDependencies orders the resolver after the container enrichers, if
+// they are used, so the events carry their container and their cgroup
+// together whatever the order the operators were registered in
+func (c *CgroupResolver) OptionalDependencies() []string {
+	return operators.ContainerEnrichers
+}
+
+func (c *CgroupResolver) CanOperateOn(gadget gadgets.GadgetDesc) bool {
+	prototype := gadget.EventPrototype()
+	hasCgroupResolverInterface := implements[CgroupResolverInterface](prototype)
+	hasCgroupIDResolverInterface := implements[CgroupIDResolverInterface](prototype)
+	return hasCgroupResolverInterface || hasCgroupIDResolverInterface
+}
+
+// implements returns whether prototype or a pointer to it implements T, as
+// the events are passed as pointers even when the prototype is a value.
+func implements[T any](prototype any) bool {
+	if prototype == nil {
+		return false
+	}
+	if _, ok := prototype.(T); ok {
+		return true
+	}
+
+	iface := reflect.TypeOf((*T)(nil)).Elem()
+	typ := reflect.TypeOf(prototype)
+	if typ.Kind() == reflect.Pointer {
+		return false
+	}
+	return reflect.PointerTo(typ).Implements(iface)
+}
+
+func (c *CgroupResolver) Init(params *params.Params) error {
+	return nil
+}
+
+func (c *CgroupResolver) Close() error {
+	return nil
+}
+
+func (c *CgroupResolver) Instantiate(gadgetCtx operators.GadgetContext, gadgetInstance any, params *params.Params) (operators.OperatorInstance, error) {
+	return &CgroupResolverInstance{
+		cache: newCgroupCache(resolveCgroup, procStartedAt),
+	}, nil
+}
+
+type CgroupResolverInstance struct {
+	cache *cgroupCache
+
+	sweepStop     chan struct{}
+	sweepFinished chan struct{}
+}
+
+func (m *CgroupResolverInstance) Name() string {
+	return "CgroupResolverInstance"
+}
+
+func (m *CgroupResolverInstance) PreGadgetRun() error {
+	m.sweepStop = make(chan struct{})
+	m.sweepFinished = make(chan struct{})
+	go m.sweepLoop()
+	return nil
+}
+
+func (m *CgroupResolverInstance) PostGadgetRun() error {
+	if m.sweepStop != nil {
+		close(m.sweepStop)
+		<-m.sweepFinished
+		m.sweepStop = nil
+	}
+	return nil
+}
+
+func (m *CgroupResolverInstance) sweepLoop() {
+	defer close(m.sweepFinished)
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.sweepStop:
+			return
+		case <-ticker.C:
+			m.cache.sweep()
+		}
+	}
+}
+
+func (m *CgroupResolverInstance) enrich(ev any) {
+	pathResolver, hasPath := ev.(CgroupResolverInterface)
+	idResolver, hasID := ev.(CgroupIDResolverInterface)
+	if !hasPath && !hasID {
+		return
+	}
+
+	var pid uint32
+	if hasPath {
+		pid = pathResolver.GetPid()
+	} else {
+		pid = idResolver.GetPid()
+	}
+
+	entry, ok := m.cache.get(pid)
+	if !ok {
+		return
+	}
+	if hasPath {
+		pathResolver.SetCgroupPath(entry.path)
+	}
+	if hasID && entry.id != 0 {
+		idResolver.SetCgroupID(entry.id)
+	}
+}
+
+func (m *CgroupResolverInstance) EnrichEvent(ev any) error {
+	m.enrich(ev)
+	return nil
+}
+
+type cacheEntry struct {
+	startedAt types.Time
+	path      string
+	id        uint64
+}
+
+// cgroupCache caches the cgroup of processes. Entries are keyed by pid and
+// validated against the start time of the process, so that they are
+// invalidated once the process exits, even if its pid is reused.
+type cgroupCache struct {
+	resolve   func(pid uint32) (string, uint64, error)
+	startedAt func(pid uint32) (types.Time, error)
+
+	mu      sync.Mutex
+	entries map[uint32]cacheEntry
+}
+
+func newCgroupCache(
+	resolve func(pid uint32) (string, uint64, error),
+	startedAt func(pid uint32) (types.Time, error),
+) *cgroupCache {
+	return &cgroupCache{
+		resolve:   resolve,
+		startedAt: startedAt,
+		entries:   make(map[uint32]cacheEntry),
+	}
+}
+
+// get returns the cgroup of the given process. It returns false if the
+// process is gone or its cgroup can't be resolved.
+func (c *cgroupCache) get(pid uint32) (cacheEntry, bool) {
+	if pid == 0 {
+		return cacheEntry{}, false
+	}
+
+	startedAt, err := c.startedAt(pid)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.entries, pid)
+		c.mu.Unlock()
+		return cacheEntry{}, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[pid]
+	c.mu.Unlock()
+	if ok && entry.startedAt == startedAt {
+		return entry, true
+	}
+
+	path, id, err := c.resolve(pid)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	entry = cacheEntry{startedAt: startedAt, path: path, id: id}
+	c.mu.Lock()
+	c.entries[pid] = entry
+	c.mu.Unlock()
+
+	return entry, true
+}
+
+// sweep removes the entries of the processes that exited
+func (c *cgroupCache) sweep() {
+	c.mu.Lock()
+	pids := make(map[uint32]types.Time, len(c.entries))
+	for pid, entry := range c.entries {
+		pids[pid] = entry.startedAt
+	}
+	c.mu.Unlock()
+
+	for pid, startedAt := range pids {
+		if current, err := c.startedAt(pid); err == nil && current == startedAt {
+			continue
+		}
+		c.mu.Lock()
+		if entry, ok := c.entries[pid]; ok && entry.startedAt == startedAt {
+			delete(c.entries, pid)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func procStartedAt(pid uint32) (types.Time, error) {
+	stat, err := host.GetProcStat(int(pid))
+	if err != nil {
+		return 0, err
+	}
+	return stat.StartedAt, nil
+}
+
+// resolveCgroup returns the cgroup path of the process and, with cgroup v2,
+// the cgroup id
+func resolveCgroup(pid uint32) (string, uint64, error) {
+	pathV1, pathV2, err := cgroups.GetCgroupPaths(int(pid))
+	if err != nil {
+		return "", 0, err
+	}
+	if pathV2 == "" {
+		return pathV1, 0, nil
+	}
+
+	// The id is optional, don't fail if it can't be read
+	var id uint64
+	if pathWithMountpoint, err := cgroups.CgroupPathV2AddMountpoint(pathV2); err == nil {
+		id, _ = cgroups.GetCgroupID(pathWithMountpoint)
+	}
+	return pathV2, id, nil
+}
+
+func init() {
+	operators.Register(&CgroupResolver{})
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroupresolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/types"
+)
+
+type event struct {
+	pid  uint32
+	path string
+	id   uint64
+}
+
+func (e *event) GetPid() uint32            { return e.pid }
+func (e *event) SetCgroupPath(path string) { e.path = path }
+func (e *event) SetCgroupID(id uint64)     { e.id = id }
+
+// fakeProcs simulates processes, identified by their start time, and counts
+// the cgroup resolutions
+type fakeProcs struct {
+	startedAt map[uint32]types.Time
+	resolved  int
+}
+
+func (f *fakeProcs) resolve(pid uint32) (string, uint64, error) {
+	f.resolved++
+	return "/system.slice/test.service", uint64(pid) * 10, nil
+}
+
+func (f *fakeProcs) getStartedAt(pid uint32) (types.Time, error) {
+	t, ok := f.startedAt[pid]
+	if !ok {
+		return 0, errors.New("no such process")
+	}
+	return t, nil
+}
+
+func TestEnrich(t *testing.T) {
+	procs := &fakeProcs{startedAt: map[uint32]types.Time{42: 1000}}
+	m := &CgroupResolverInstance{cache: newCgroupCache(procs.resolve, procs.getStartedAt)}
+
+	ev := &event{pid: 42}
+	require.NoError(t, m.EnrichEvent(ev))
+	require.Equal(t, "/system.slice/test.service", ev.path)
+	require.Equal(t, uint64(420), ev.id)
+
+	// Cached
+	require.NoError(t, m.EnrichEvent(&event{pid: 42}))
+	require.Equal(t, 1, procs.resolved)
+
+	// The pid was reused by another process
+	procs.startedAt[42] = 2000
+	require.NoError(t, m.EnrichEvent(&event{pid: 42}))
+	require.Equal(t, 2, procs.resolved)
+
+	// The process exited
+	delete(procs.startedAt, 42)
+	ev = &event{pid: 42}
+	require.NoError(t, m.EnrichEvent(ev))
+	require.Empty(t, ev.path)
+	require.Empty(t, m.cache.entries)
+}
+
+func TestSweep(t *testing.T) {
+	procs := &fakeProcs{startedAt: map[uint32]types.Time{1: 10, 2: 20, 3: 30}}
+	c := newCgroupCache(procs.resolve, procs.getStartedAt)
+
+	for pid := uint32(1); pid <= 3; pid++ {
+		_, ok := c.get(pid)
+		require.True(t, ok)
+	}
+
+	delete(procs.startedAt, 1)
+	procs.startedAt[2] = 21
+	c.sweep()
+
+	require.Len(t, c.entries, 1)
+	require.Contains(t, c.entries, uint32(3))
+}
+
+func TestImplements(t *testing.T) {
+	require.True(t, implements[CgroupResolverInterface](event{}))
+	require.True(t, implements[CgroupIDResolverInterface](&event{}))
+	require.False(t, implements[CgroupResolverInterface](struct{}{}))
+	require.False(t, implements[CgroupResolverInterface](nil))
+}
+
+// localManager only implements what SortOperators needs, calling any other
+// method panics
+type localManager struct {
+	operators.Operator
+}
+
+func (localManager) Name() string           { return operators.LocalManagerName }
+func (localManager) Dependencies() []string { return nil }
+
+func TestOptionalDependencies(t *testing.T) {
+	ops, err := operators.SortOperators(operators.Operators{&CgroupResolver{}, localManager{}})
+	require.NoError(t, err)
+	require.Equal(t, []string{operators.LocalManagerName, OperatorName}, []string{ops[0].Name(), ops[1].Name()})
+}
@@ -0,0 +1,259 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exepathresolver provides an operator that enriches events by
+// resolving the pid of the process that generated them to the absolute path
+// of its executable, as reported by /proc/<pid>/exe on the host. The path
+// can't be resolved for processes that already exited.
+package exepathresolver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
+)
+
+const (
+	OperatorName = "ExePathResolver"
+)
+
+type ExePathResolverInterface interface {
+	GetPid() uint32
+	SetExePath(string)
+}
+
+// StartTimeGetter is implemented by the events that know when their process
+// started, in nanoseconds since boot. The cache then relies on it instead of
+// reading /proc/<pid>/stat for each event.
+type StartTimeGetter interface {
+	GetStartTime() uint64
+}
+
+// userHZ is the unit of the start time in /proc/<pid>/stat. The kernel
+// always reports it in USER_HZ, which is 100 on all architectures.
+const userHZ = 100
+
+// pruneInterval is how often the entries of the processes that exited are
+// removed from the cache
+const pruneInterval = 30 * time.Second
+
+type ExePathResolver struct{}
+
+func (e *ExePathResolver) Name() string {
+	return OperatorName
+}
+
+func (e *ExePathResolver) Description() string {
+	return "ExePathResolver resolves pids to the path of their executable"
+}
+
+func (e *ExePathResolver) GlobalParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (e *ExePathResolver) ParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (e *ExePathResolver) Dependencies() []string {
+	return nil
+}
+
+// OptionalDependencies runs the resolver once the container enrichers, if
+// used, are done with the event
+func (e *ExePathResolver) OptionalDependencies() []string {
+	return operators.ContainerEnrichers
+}
+
+func (e *ExePathResolver) CanOperateOn(gadget gadgets.GadgetDesc) bool {
+	_, hasExePathResolverInterface := gadget.EventPrototype().(ExePathResolverInterface)
+	return hasExePathResolverInterface
+}
+
+func (e *ExePathResolver) Init(params *params.Params) error {
+	return nil
+}
+
+func (e *ExePathResolver) Close() error {
+	return nil
+}
+
+func (e *ExePathResolver) Instantiate(gadgetCtx operators.GadgetContext, gadgetInstance any, params *params.Params) (operators.OperatorInstance, error) {
+	return &ExePathResolverInstance{
+		cache: newExePathCache(host.HostProcFs),
+	}, nil
+}
+
+type ExePathResolverInstance struct {
+	cache *exePathCache
+}
+
+func (m *ExePathResolverInstance) Name() string {
+	return "ExePathResolverInstance"
+}
+
+func (m *ExePathResolverInstance) PreGadgetRun() error {
+	return nil
+}
+
+func (m *ExePathResolverInstance) PostGadgetRun() error {
+	return nil
+}
+
+func (m *ExePathResolverInstance) enrich(ev any) {
+	resolver, ok := ev.(ExePathResolverInterface)
+	if !ok {
+		return
+	}
+
+	startTime := uint64(0)
+	if getter, ok := ev.(StartTimeGetter); ok {
+		startTime = getter.GetStartTime()
+	}
+
+	// The path is left empty if the process is gone
+	if path := m.cache.get(resolver.GetPid(), startTime); path != "" {
+		resolver.SetExePath(path)
+	}
+}
+
+func (m *ExePathResolverInstance) EnrichEvent(ev any) error {
+	m.enrich(ev)
+	return nil
+}
+
+type cacheEntry struct {
+	startTime uint64
+	path      string
+}
+
+// exePathCache caches the executable path of processes. Entries are keyed by
+// pid and validated against the start time of the process, so that a reused
+// pid doesn't get the path of the process that had it before. The entries of
+// the processes that exited are removed every pruneInterval.
+type exePathCache struct {
+	procFs string
+
+	mu        sync.Mutex
+	entries   map[uint32]cacheEntry
+	lastPrune time.Time
+}
+
+func newExePathCache(procFs string) *exePathCache {
+	return &exePathCache{
+		procFs:    procFs,
+		entries:   make(map[uint32]cacheEntry),
+		lastPrune: time.Now(),
+	}
+}
+
+// get returns the executable path of the given process, or an empty string if
+// it can't be resolved. startTime is the time the process started at, in
+// nanoseconds since boot, or 0 to read it from /proc/<pid>/stat.
+func (c *exePathCache) get(pid uint32, startTime uint64) string {
+	if pid == 0 {
+		return ""
+	}
+
+	if startTime == 0 {
+		var err error
+		startTime, err = c.readStartTime(pid)
+		if err != nil {
+			c.mu.Lock()
+			delete(c.entries, pid)
+			c.mu.Unlock()
+			return ""
+		}
+	}
+
+	c.mu.Lock()
+	c.pruneLocked(time.Now())
+	entry, ok := c.entries[pid]
+	c.mu.Unlock()
+	if ok && entry.startTime == startTime {
+		return entry.path
+	}
+
+	path, err := os.Readlink(filepath.Join(c.procFs, strconv.FormatUint(uint64(pid), 10), "exe"))
+	if err != nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	c.entries[pid] = cacheEntry{startTime: startTime, path: path}
+	c.mu.Unlock()
+
+	return path
+}
+
+// pruneLocked removes the entries of the processes that exited. It must be
+// called with c.mu held.
+func (c *exePathCache) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < pruneInterval {
+		return
+	}
+	c.lastPrune = now
+
+	for pid := range c.entries {
+		if _, err := os.Stat(filepath.Join(c.procFs, strconv.FormatUint(uint64(pid), 10))); err != nil {
+			delete(c.entries, pid)
+		}
+	}
+}
+
+// readStartTime returns the start time of the process, in nanoseconds since
+// boot, from /proc/<pid>/stat.
+func (c *exePathCache) readStartTime(pid uint32) (uint64, error) {
+	buf, err := os.ReadFile(filepath.Join(c.procFs, strconv.FormatUint(uint64(pid), 10), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	ticks, err := parseStartTime(string(buf))
+	if err != nil {
+		return 0, err
+	}
+	return ticks * uint64(time.Second/userHZ), nil
+}
+
+// parseStartTime returns the start time of the process, in clock ticks after
+// system boot, from the content of /proc/<pid>/stat
+func parseStartTime(stat string) (uint64, error) {
+	// The comm field can contain spaces and parentheses, skip it
+	idx := strings.LastIndexByte(stat, ')')
+	if idx == -1 {
+		return 0, fmt.Errorf("invalid stat format")
+	}
+
+	// The fields after comm start with the state (field 3), the start time
+	// is field 22
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("invalid stat format: %d fields after comm", len(fields))
+	}
+
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+func init() {
+	operators.Register(&ExePathResolver{})
+}
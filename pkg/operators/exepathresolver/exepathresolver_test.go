@@ -0,0 +1,142 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exepathresolver
+
+import (
+	"math"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+)
+
+type exeEvent struct {
+	pid     uint32
+	exePath string
+}
+
+func (e *exeEvent) GetPid() uint32         { return e.pid }
+func (e *exeEvent) SetExePath(path string) { e.exePath = path }
+
+func TestExePathCache(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	c := newExePathCache("/proc")
+	pid := uint32(os.Getpid())
+	require.Equal(t, exe, c.get(pid, 0))
+	require.Contains(t, c.entries, pid)
+	require.Equal(t, exe, c.get(pid, 0), "the path is served from the cache")
+
+	// The pid of a process that exited can't be resolved
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	exited := uint32(cmd.Process.Pid)
+	require.Empty(t, c.get(exited, 0))
+	require.NotContains(t, c.entries, exited)
+
+	// A stale entry is dropped once its process is gone
+	c.entries[exited] = cacheEntry{startTime: 1, path: "/usr/bin/true"}
+	require.Empty(t, c.get(exited, 0))
+	require.NotContains(t, c.entries, exited)
+
+	require.Empty(t, c.get(0, 0))
+}
+
+func TestExePathCacheStartTime(t *testing.T) {
+	c := newExePathCache(t.TempDir())
+	c.entries[42] = cacheEntry{startTime: 7, path: "/usr/bin/app"}
+
+	// The start time given by the event is trusted, /proc isn't read
+	require.Equal(t, "/usr/bin/app", c.get(42, 7))
+	require.Empty(t, c.get(42, 8), "the pid was reused")
+}
+
+func TestExePathCachePrune(t *testing.T) {
+	c := newExePathCache("/proc")
+	c.entries[uint32(os.Getpid())] = cacheEntry{startTime: 1, path: "/usr/bin/running"}
+	c.entries[math.MaxUint32] = cacheEntry{startTime: 1, path: "/usr/bin/exited"}
+
+	c.lastPrune = time.Now().Add(-2 * pruneInterval)
+	c.pruneLocked(time.Now())
+	require.Contains(t, c.entries, uint32(os.Getpid()))
+	require.NotContains(t, c.entries, uint32(math.MaxUint32))
+}
+
+func TestEnrich(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	m := &ExePathResolverInstance{cache: newExePathCache("/proc")}
+	ev := &exeEvent{pid: uint32(os.Getpid())}
+	require.NoError(t, m.EnrichEvent(ev))
+	require.Equal(t, exe, ev.exePath)
+
+	ev = &exeEvent{exePath: "unchanged"}
+	require.NoError(t, m.EnrichEvent(ev))
+	require.Equal(t, "unchanged", ev.exePath)
+}
+
+func TestParseStartTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		stat     string
+		expected uint64
+		err      bool
+	}{
+		{
+			name:     "simple",
+			stat:     "1 (systemd) S 0 1 1 0 -1 4194560 12 34 5 6 7 8 9 10 20 0 1 0 42 100 200",
+			expected: 42,
+		},
+		{
+			name:     "comm with spaces and parentheses",
+			stat:     "2 (a (b) c) S 0 1 1 0 -1 4194560 12 34 5 6 7 8 9 10 20 0 1 0 1234 100 200",
+			expected: 1234,
+		},
+		{name: "no comm", stat: "3 S 0", err: true},
+		{name: "truncated", stat: "4 (sh) S 0 1 1", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			startTime, err := parseStartTime(test.stat)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, startTime)
+		})
+	}
+}
+
+// localManager only implements what SortOperators needs, calling any other
+// method panics
+type localManager struct {
+	operators.Operator
+}
+
+func (localManager) Name() string           { return operators.LocalManagerName }
+func (localManager) Dependencies() []string { return nil }
+
+func TestOptionalDependencies(t *testing.T) {
+	ops, err := operators.SortOperators(operators.Operators{&ExePathResolver{}, localManager{}})
+	require.NoError(t, err)
+	require.Equal(t, []string{operators.LocalManagerName, OperatorName}, []string{ops[0].Name(), ops[1].Name()})
+}
@@ -0,0 +1,256 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package geoipresolver provides an operator that enriches events with the
+// autonomous system and the country of their remote address, as found in
+// local MaxMind DB (MMDB) databases, e.g. GeoLite2-ASN and GeoLite2-Country.
+package geoipresolver
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+)
+
+const (
+	OperatorName = "GeoIPResolver"
+
+	ParamDatabases = "geoip-databases"
+
+	// The lookups are cached per /24 IPv4 and /48 IPv6 prefix: the addresses
+	// of such a prefix nearly always belong to the same network.
+	ipv4CachePrefixLen = 24
+	ipv6CachePrefixLen = 48
+
+	// maxCacheEntries bounds the memory used by the cache, it's cleared once
+	// full
+	maxCacheEntries = 1 << 16
+)
+
+type RemoteAddrGeoInterface interface {
+	GetRemoteAddr() string
+	SetRemoteGeo(asn uint32, asOrg string, country string)
+}
+
+// geoInfo is what the databases know about an address
+type geoInfo struct {
+	asn     uint32
+	asOrg   string
+	country string
+}
+
+type GeoIPResolver struct {
+	// dbs are the databases that could be loaded. The operator isn't
+	// instantiated if there is none.
+	dbs []*mmdb
+
+	cacheMutex sync.Mutex
+	cache      map[netip.Prefix]geoInfo
+}
+
+func (g *GeoIPResolver) Name() string {
+	return OperatorName
+}
+
+func (g *GeoIPResolver) Description() string {
+	return "GeoIPResolver resolves remote IP addresses to their autonomous system and country"
+}
+
+func (g *GeoIPResolver) GlobalParamDescs() params.ParamDescs {
+	return params.ParamDescs{
+		{
+			Key:          ParamDatabases,
+			Title:        "GeoIP databases",
+			Description:  "Comma-separated paths of MaxMind DB (MMDB) files, e.g. GeoLite2-ASN.mmdb and GeoLite2-Country.mmdb, used to resolve remote addresses. The resolution is disabled if none can be loaded.",
+			DefaultValue: "",
+		},
+	}
+}
+
+func (g *GeoIPResolver) ParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (g *GeoIPResolver) Dependencies() []string {
+	return nil
+}
+
+func (g *GeoIPResolver) CanOperateOn(gadget gadgets.GadgetDesc) bool {
+	_, hasRemoteAddrGeoInterface := gadget.EventPrototype().(RemoteAddrGeoInterface)
+	return hasRemoteAddrGeoInterface
+}
+
+func (g *GeoIPResolver) Init(params *params.Params) error {
+	g.dbs = nil
+	g.cache = make(map[netip.Prefix]geoInfo)
+
+	if params == nil {
+		return nil
+	}
+	p := params.Get(ParamDatabases)
+	if p == nil || p.AsString() == "" {
+		return nil
+	}
+
+	// A missing or invalid database only disables the resolution, it
+	// mustn't prevent the gadgets from running
+	for _, path := range strings.Split(p.AsString(), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		db, err := openMMDB(path)
+		if err != nil {
+			log.Warnf("GeoIPResolver: loading %q: %v", path, err)
+			continue
+		}
+		g.dbs = append(g.dbs, db)
+	}
+	if len(g.dbs) == 0 {
+		log.Warnf("GeoIPResolver: no database could be loaded, remote addresses won't be resolved")
+	}
+
+	return nil
+}
+
+func (g *GeoIPResolver) Close() error {
+	return nil
+}
+
+func (g *GeoIPResolver) Instantiate(gadgetCtx operators.GadgetContext, gadgetInstance any, params *params.Params) (operators.OperatorInstance, error) {
+	if len(g.dbs) == 0 {
+		return nil, nil
+	}
+
+	return &GeoIPResolverInstance{resolver: g}, nil
+}
+
+// resolve returns what the databases know about addr, looking up the cache
+// first
+func (g *GeoIPResolver) resolve(addr netip.Addr) geoInfo {
+	addr = addr.Unmap()
+	bits := ipv6CachePrefixLen
+	if addr.Is4() {
+		bits = ipv4CachePrefixLen
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return geoInfo{}
+	}
+
+	g.cacheMutex.Lock()
+	info, ok := g.cache[prefix]
+	g.cacheMutex.Unlock()
+	if ok {
+		return info
+	}
+
+	info = g.lookup(addr)
+
+	g.cacheMutex.Lock()
+	defer g.cacheMutex.Unlock()
+	if len(g.cache) >= maxCacheEntries {
+		clear(g.cache)
+	}
+	g.cache[prefix] = info
+
+	return info
+}
+
+// lookup merges what each database knows about addr
+func (g *GeoIPResolver) lookup(addr netip.Addr) geoInfo {
+	var info geoInfo
+	for _, db := range g.dbs {
+		data, err := db.lookup(addr)
+		if err != nil {
+			log.Debugf("GeoIPResolver: looking up %s: %v", addr, err)
+			continue
+		}
+		record, ok := data.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if asn, ok := record["autonomous_system_number"].(uint64); ok && info.asn == 0 {
+			info.asn = uint32(asn)
+		}
+		if asOrg, ok := record["autonomous_system_organization"].(string); ok && info.asOrg == "" {
+			info.asOrg = asOrg
+		}
+		if info.country == "" {
+			info.country = isoCode(record, "country")
+		}
+		if info.country == "" {
+			info.country = isoCode(record, "registered_country")
+		}
+	}
+	return info
+}
+
+// isoCode returns the ISO code of the country stored under key in record
+func isoCode(record map[string]any, key string) string {
+	country, ok := record[key].(map[string]any)
+	if !ok {
+		return ""
+	}
+	code, _ := country["iso_code"].(string)
+	return code
+}
+
+type GeoIPResolverInstance struct {
+	resolver *GeoIPResolver
+}
+
+func (m *GeoIPResolverInstance) Name() string {
+	return "GeoIPResolverInstance"
+}
+
+func (m *GeoIPResolverInstance) PreGadgetRun() error {
+	return nil
+}
+
+func (m *GeoIPResolverInstance) PostGadgetRun() error {
+	return nil
+}
+
+func (m *GeoIPResolverInstance) enrich(ev any) {
+	resolver, ok := ev.(RemoteAddrGeoInterface)
+	if !ok {
+		return
+	}
+
+	addr, err := netip.ParseAddr(resolver.GetRemoteAddr())
+	if err != nil {
+		return
+	}
+
+	if info := m.resolver.resolve(addr); info != (geoInfo{}) {
+		resolver.SetRemoteGeo(info.asn, info.asOrg, info.country)
+	}
+}
+
+func (m *GeoIPResolverInstance) EnrichEvent(ev any) error {
+	m.enrich(ev)
+	return nil
+}
+
+func init() {
+	operators.Register(&GeoIPResolver{})
+}
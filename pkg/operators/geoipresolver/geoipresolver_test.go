@@ -0,0 +1,82 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoipresolver
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type remoteEvent struct {
+	addr    string
+	asn     uint32
+	asOrg   string
+	country string
+}
+
+func (e *remoteEvent) GetRemoteAddr() string { return e.addr }
+
+func (e *remoteEvent) SetRemoteGeo(asn uint32, asOrg string, country string) {
+	e.asn, e.asOrg, e.country = asn, asOrg, country
+}
+
+func TestEnrichEvent(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.mmdb")
+	require.NoError(t, os.WriteFile(dbPath, buildMMDB(t, 24, 6, testValues(), []testEntry{
+		{prefix: netip.MustParsePrefix("192.0.2.0/24"), data: 0},
+		{prefix: netip.MustParsePrefix("2001:db8::/32"), data: 1},
+	}), 0o644))
+
+	g := &GeoIPResolver{}
+	p := g.GlobalParamDescs().ToParams()
+
+	// A missing database disables the operator without failing
+	require.NoError(t, p.Set(ParamDatabases, filepath.Join(dir, "missing.mmdb")))
+	require.NoError(t, g.Init(p))
+	instance, err := g.Instantiate(nil, nil, nil)
+	require.NoError(t, err)
+	require.Nil(t, instance)
+
+	require.NoError(t, p.Set(ParamDatabases, filepath.Join(dir, "missing.mmdb")+", "+dbPath))
+	require.NoError(t, g.Init(p))
+	instance, err = g.Instantiate(nil, nil, nil)
+	require.NoError(t, err)
+	enricher := instance.(*GeoIPResolverInstance)
+
+	ev := &remoteEvent{addr: "192.0.2.1"}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Equal(t, &remoteEvent{addr: "192.0.2.1", asn: 64500, asOrg: "Example Networks"}, ev)
+
+	ev = &remoteEvent{addr: "2001:db8::1"}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Equal(t, "FR", ev.country)
+
+	ev = &remoteEvent{addr: "10.0.0.1"}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Equal(t, &remoteEvent{addr: "10.0.0.1"}, ev)
+
+	ev = &remoteEvent{addr: "not an address"}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Equal(t, &remoteEvent{addr: "not an address"}, ev)
+
+	// The lookups are cached per /24
+	require.Len(t, g.cache, 3)
+	require.Contains(t, g.cache, netip.MustParsePrefix("192.0.2.0/24"))
+}
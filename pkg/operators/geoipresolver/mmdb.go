@@ -0,0 +1,361 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoipresolver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// This file implements the subset of the MaxMind DB format needed to look up
+// addresses, see https://maxmind.github.io/MaxMind-DB/. The whole database is
+// read in memory.
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section
+const dataSectionSeparator = 16
+
+// maxDepth is the number of nested maps and arrays above which a value is
+// refused, so a database whose pointers form a loop can't overflow the stack
+const maxDepth = 512
+
+// Data types of the data section
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBoolean  = 14
+	typeFloat    = 15
+)
+
+// mmdb is a MaxMind DB database
+type mmdb struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// dataStart is the offset of the data section in buf
+	dataStart uint
+	// ipv4Start is the node IPv4 addresses start from in an IPv6 tree
+	ipv4Start uint
+}
+
+func openMMDB(path string) (*mmdb, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newMMDB(buf)
+}
+
+func newMMDB(buf []byte) (*mmdb, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("no metadata found")
+	}
+
+	d := decoder{buf: buf[start+len(metadataMarker):]}
+	metadata, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	m, ok := metadata.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata isn't a map")
+	}
+
+	db := &mmdb{buf: buf}
+	for key, field := range map[string]*uint{
+		"node_count":  &db.nodeCount,
+		"record_size": &db.recordSize,
+		"ip_version":  &db.ipVersion,
+	} {
+		val, ok := m[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("invalid %q in metadata", key)
+		}
+		*field = uint(val)
+	}
+
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", db.ipVersion)
+	}
+
+	// Checked first, so the size of the tree can't overflow
+	if db.nodeCount > uint(start) {
+		return nil, errors.New("search tree larger than the database")
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	db.dataStart = treeSize + dataSectionSeparator
+	if db.dataStart > uint(start) {
+		return nil, errors.New("search tree larger than the database")
+	}
+
+	if db.ipVersion == 6 {
+		// IPv4 addresses are stored as ::a.b.c.d
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node
+func (db *mmdb) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.buf[node*8+bit*4:]))
+	}
+}
+
+// lookup returns the data stored for addr, or nil if there is none
+func (db *mmdb) lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+
+	node := uint(0)
+	var ip []byte
+	switch {
+	case addr.Is4() && db.ipVersion == 6:
+		node = db.ipv4Start
+		ip = addr.AsSlice()
+	case addr.Is6() && db.ipVersion == 4:
+		return nil, nil
+	default:
+		ip = addr.AsSlice()
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount+dataSectionSeparator {
+		return nil, errors.New("invalid search tree")
+	}
+
+	offset := node - db.nodeCount - dataSectionSeparator
+	d := decoder{buf: db.buf[db.dataStart:]}
+	val, _, err := d.decode(offset)
+	return val, err
+}
+
+// decoder decodes the values of a data section
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) bytes(offset, size uint) ([]byte, error) {
+	// Written so that it can't overflow
+	if offset > uint(len(d.buf)) || size > uint(len(d.buf))-offset {
+		return nil, errors.New("unexpected end of data")
+	}
+	return d.buf[offset : offset+size], nil
+}
+
+// decode returns the value at offset and the offset following it
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+// decodeDepth is decode for a value nested in depth maps and arrays
+func (d *decoder) decodeDepth(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+
+	typ := uint(ctrl[0] >> 5)
+	if typ == typePointer {
+		target, next, err := d.pointer(ctrl[0], offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// The format doesn't allow pointers to pointers, following them
+		// could loop forever
+		targetCtrl, err := d.bytes(target, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if uint(targetCtrl[0]>>5) == typePointer {
+			return nil, 0, errors.New("pointer to a pointer")
+		}
+		val, _, err := d.decodeDepth(target, depth)
+		return val, next, err
+	}
+	if typ == typeExtended {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset++
+		typ = 7 + uint(ext[0])
+	}
+
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key isn't a string")
+			}
+			m[k], offset, err = d.decodeDepth(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			var val any
+			val, offset, err = d.decodeDepth(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, val)
+		}
+		return a, offset, nil
+	case typeBoolean:
+		return size != 0, offset, nil
+	}
+
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return b, offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		// uint128 values larger than 64 bits aren't needed, they're
+		// truncated
+		val := uint64(0)
+		for _, c := range b {
+			val = val<<8 | uint64(c)
+		}
+		return val, offset, nil
+	case typeInt32:
+		val := uint32(0)
+		for _, c := range b {
+			val = val<<8 | uint32(c)
+		}
+		return int64(int32(val)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// pointer returns the offset a pointer points to and the offset following it
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	val := uint(0)
+	if n < 4 {
+		val = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		val = val<<8 | uint(c)
+	}
+
+	switch n {
+	case 2:
+		val += 2048
+	case 3:
+		val += 526336
+	}
+	return val, offset + n, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoipresolver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The helpers below encode the values of a data section. Only the sizes below
+// 285 bytes are supported.
+
+func encodeString(s string) []byte {
+	if len(s) >= 29 {
+		return append([]byte{typeString<<5 | 29, byte(len(s) - 29)}, s...)
+	}
+	return append([]byte{typeString<<5 | byte(len(s))}, s...)
+}
+
+func encodeUint(typ byte, val uint64, size int) []byte {
+	b := binary.BigEndian.AppendUint64(nil, val)
+	return append([]byte{typ<<5 | byte(size)}, b[8-size:]...)
+}
+
+func encodeMap(kvs ...[]byte) []byte {
+	b := []byte{typeMap<<5 | byte(len(kvs)/2)}
+	for _, kv := range kvs {
+		b = append(b, kv...)
+	}
+	return b
+}
+
+func encodePointer(offset int) []byte {
+	return []byte{typePointer<<5 | byte(offset>>8), byte(offset)}
+}
+
+// testNode is a node of the search tree built by buildMMDB. Its records are
+// either the index of another node, emptyRecord or the index of a value of
+// the data section encoded as -(2+index).
+type testNode [2]int
+
+const emptyRecord = -1
+
+type testEntry struct {
+	prefix netip.Prefix
+	data   int
+}
+
+// buildMMDB returns a database with the given record size and IP version,
+// storing the data at the given index of values for each prefix of entries
+func buildMMDB(t *testing.T, recordSize, ipVersion int, values [][]byte, entries []testEntry) []byte {
+	t.Helper()
+
+	nodes := []testNode{{emptyRecord, emptyRecord}}
+	for _, e := range entries {
+		addr := e.prefix.Addr()
+		bits := e.prefix.Bits()
+		if ipVersion == 6 && addr.Is4() {
+			addr = netip.AddrFrom16(addr.As16())
+			// ::a.b.c.d instead of ::ffff:a.b.c.d
+			b := addr.As16()
+			b[10], b[11] = 0, 0
+			addr = netip.AddrFrom16(b)
+			bits += 96
+		}
+		ip := addr.AsSlice()
+
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := (ip[i/8] >> (7 - i%8)) & 1
+			if i == bits-1 {
+				nodes[node][bit] = -(2 + e.data)
+				break
+			}
+			if nodes[node][bit] == emptyRecord {
+				nodes = append(nodes, testNode{emptyRecord, emptyRecord})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var data []byte
+	offsets := make([]int, len(values))
+	for i, v := range values {
+		offsets[i] = len(data)
+		data = append(data, v...)
+	}
+
+	nodeCount := len(nodes)
+	recordValue := func(r int) uint32 {
+		switch {
+		case r == emptyRecord:
+			return uint32(nodeCount)
+		case r < 0:
+			return uint32(nodeCount + dataSectionSeparator + offsets[-r-2])
+		default:
+			return uint32(r)
+		}
+	}
+
+	var buf []byte
+	for _, n := range nodes {
+		left, right := recordValue(n[0]), recordValue(n[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left))
+			buf = append(buf, byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left))
+			buf = append(buf, byte(left>>24)<<4|byte(right>>24))
+			buf = append(buf, byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			buf = binary.BigEndian.AppendUint32(buf, left)
+			buf = binary.BigEndian.AppendUint32(buf, right)
+		}
+	}
+	buf = append(buf, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, data...)
+
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, encodeMap(
+		encodeString("node_count"), encodeUint(typeUint32, uint64(nodeCount), 4),
+		encodeString("record_size"), encodeUint(typeUint16, uint64(recordSize), 2),
+		encodeString("ip_version"), encodeUint(typeUint16, uint64(ipVersion), 2),
+	)...)
+	return buf
+}
+
+// testValues are an ASN record, a country record and a record pointing to
+// the country of the previous one
+func testValues() [][]byte {
+	asn := encodeMap(
+		encodeString("autonomous_system_number"), encodeUint(typeUint32, 64500, 4),
+		encodeString("autonomous_system_organization"), encodeString("Example Networks"),
+	)
+	country := encodeMap(
+		encodeString("country"), encodeMap(encodeString("iso_code"), encodeString("FR")),
+	)
+	// The country map of the previous record starts after its control byte
+	// and its key
+	countryOffset := len(asn) + 1 + len(encodeString("country"))
+	registered := encodeMap(
+		encodeString("registered_country"), encodePointer(countryOffset),
+	)
+	return [][]byte{asn, country, registered}
+}
+
+func TestMMDBLookup(t *testing.T) {
+	entries := []testEntry{
+		{prefix: netip.MustParsePrefix("192.0.2.0/24"), data: 0},
+		{prefix: netip.MustParsePrefix("198.51.100.0/25"), data: 1},
+		{prefix: netip.MustParsePrefix("203.0.113.0/24"), data: 2},
+	}
+
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			t.Run(fmt.Sprintf("ipv%d/%d", ipVersion, recordSize), func(t *testing.T) {
+				db, err := newMMDB(buildMMDB(t, recordSize, ipVersion, testValues(), entries))
+				require.NoError(t, err)
+
+				val, err := db.lookup(netip.MustParseAddr("192.0.2.42"))
+				require.NoError(t, err)
+				require.Equal(t, map[string]any{
+					"autonomous_system_number":       uint64(64500),
+					"autonomous_system_organization": "Example Networks",
+				}, val)
+
+				val, err = db.lookup(netip.MustParseAddr("::ffff:198.51.100.1"))
+				require.NoError(t, err)
+				require.Equal(t, map[string]any{"country": map[string]any{"iso_code": "FR"}}, val)
+
+				val, err = db.lookup(netip.MustParseAddr("203.0.113.1"))
+				require.NoError(t, err)
+				require.Equal(t, map[string]any{"registered_country": map[string]any{"iso_code": "FR"}}, val)
+
+				// Outside of the /25
+				val, err = db.lookup(netip.MustParseAddr("198.51.100.200"))
+				require.NoError(t, err)
+				require.Nil(t, val)
+
+				val, err = db.lookup(netip.MustParseAddr("2001:db8::1"))
+				require.NoError(t, err)
+				require.Nil(t, val)
+			})
+		}
+	}
+}
+
+func TestMMDBInvalid(t *testing.T) {
+	_, err := newMMDB([]byte("not a database"))
+	require.Error(t, err)
+
+	buf := append([]byte{}, metadataMarker...)
+	buf = append(buf, encodeMap(encodeString("node_count"), encodeUint(typeUint32, 1, 4))...)
+	_, err = newMMDB(buf)
+	require.Error(t, err)
+}
+
+func TestMMDBPointerLoop(t *testing.T) {
+	// A pointer to itself
+	d := decoder{buf: []byte{typePointer << 5, 0x00}}
+	_, _, err := d.decode(0)
+	require.Error(t, err)
+
+	// A map whose value points to the map itself
+	d = decoder{buf: append(append([]byte{typeMap<<5 | 1}, encodeString("a")...), typePointer<<5, 0x00)}
+	_, _, err = d.decode(0)
+	require.Error(t, err)
+}
+
+func TestMMDBInvalidRecord(t *testing.T) {
+	entries := []testEntry{{prefix: netip.MustParsePrefix("0.0.0.0/1"), data: 0}}
+	buf := buildMMDB(t, 32, 4, testValues(), entries)
+	// The left record of the only node points to the last byte of the
+	// separator between the search tree and the data section
+	binary.BigEndian.PutUint32(buf, 1+dataSectionSeparator-1)
+
+	db, err := newMMDB(buf)
+	require.NoError(t, err)
+	_, err = db.lookup(netip.MustParseAddr("1.2.3.4"))
+	require.Error(t, err)
+}
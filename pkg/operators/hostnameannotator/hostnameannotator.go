@@ -0,0 +1,151 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hostnameannotator provides an operator that annotates events with
+// the hostname last seen for their remote endpoint, e.g. the SNI of a TLS
+// handshake or the name of a DNS query. The operator doesn't gather the
+// hostnames itself: they're provided by a HostnameProvider registered with
+// RegisterProvider, which keeps the source pluggable.
+package hostnameannotator
+
+import (
+	"sync"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+)
+
+const (
+	OperatorName = "HostnameAnnotator"
+)
+
+// HostnameAnnotatorInterface is implemented by the events having a remote
+// endpoint that can be annotated with a hostname
+type HostnameAnnotatorInterface interface {
+	GetRemoteEndpoint() (addr string, port uint16)
+	SetHostname(string)
+}
+
+// HostnameProvider maps a remote endpoint to the hostname last seen for it.
+// Hostname is called for each event, so it must be fast and safe for
+// concurrent use.
+type HostnameProvider interface {
+	Hostname(addr string, port uint16) (string, bool)
+}
+
+var (
+	providerMutex sync.RWMutex
+	provider      HostnameProvider
+)
+
+// RegisterProvider sets the provider used to annotate the events. Only one
+// provider can be registered, registering nil removes it. Gadgets started
+// before the registration aren't annotated.
+func RegisterProvider(p HostnameProvider) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	provider = p
+}
+
+func getProvider() HostnameProvider {
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+	return provider
+}
+
+type HostnameAnnotator struct{}
+
+func (a *HostnameAnnotator) Name() string {
+	return OperatorName
+}
+
+func (a *HostnameAnnotator) Description() string {
+	return "HostnameAnnotator annotates remote endpoints with the hostname given by a registered provider"
+}
+
+func (a *HostnameAnnotator) GlobalParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (a *HostnameAnnotator) ParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (a *HostnameAnnotator) Dependencies() []string {
+	return nil
+}
+
+func (a *HostnameAnnotator) CanOperateOn(gadget gadgets.GadgetDesc) bool {
+	_, hasHostnameAnnotatorInterface := gadget.EventPrototype().(HostnameAnnotatorInterface)
+	return hasHostnameAnnotatorInterface
+}
+
+func (a *HostnameAnnotator) Init(params *params.Params) error {
+	return nil
+}
+
+func (a *HostnameAnnotator) Close() error {
+	return nil
+}
+
+func (a *HostnameAnnotator) Instantiate(gadgetCtx operators.GadgetContext, gadgetInstance any, params *params.Params) (operators.OperatorInstance, error) {
+	p := getProvider()
+	if p == nil {
+		return nil, nil
+	}
+
+	return &HostnameAnnotatorInstance{provider: p}, nil
+}
+
+type HostnameAnnotatorInstance struct {
+	provider HostnameProvider
+}
+
+func (m *HostnameAnnotatorInstance) Name() string {
+	return "HostnameAnnotatorInstance"
+}
+
+func (m *HostnameAnnotatorInstance) PreGadgetRun() error {
+	return nil
+}
+
+func (m *HostnameAnnotatorInstance) PostGadgetRun() error {
+	return nil
+}
+
+func (m *HostnameAnnotatorInstance) enrich(ev any) {
+	annotator, ok := ev.(HostnameAnnotatorInterface)
+	if !ok {
+		return
+	}
+
+	addr, port := annotator.GetRemoteEndpoint()
+	if addr == "" {
+		return
+	}
+
+	if name, ok := m.provider.Hostname(addr, port); ok {
+		annotator.SetHostname(name)
+	}
+}
+
+func (m *HostnameAnnotatorInstance) EnrichEvent(ev any) error {
+	m.enrich(ev)
+	return nil
+}
+
+func init() {
+	operators.Register(&HostnameAnnotator{})
+}
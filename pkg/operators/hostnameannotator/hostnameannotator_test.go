@@ -0,0 +1,69 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostnameannotator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type staticProvider map[uint16]string
+
+func (p staticProvider) Hostname(addr string, port uint16) (string, bool) {
+	name, ok := p[port]
+	return name, ok
+}
+
+type endpointEvent struct {
+	addr     string
+	port     uint16
+	hostname string
+}
+
+func (e *endpointEvent) GetRemoteEndpoint() (string, uint16) { return e.addr, e.port }
+func (e *endpointEvent) SetHostname(name string)             { e.hostname = name }
+
+func TestEnrichEvent(t *testing.T) {
+	a := &HostnameAnnotator{}
+
+	// Without a provider, the operator isn't instantiated
+	instance, err := a.Instantiate(nil, nil, nil)
+	require.NoError(t, err)
+	require.Nil(t, instance)
+
+	RegisterProvider(staticProvider{443: "example.com"})
+	t.Cleanup(func() { RegisterProvider(nil) })
+
+	instance, err = a.Instantiate(nil, nil, nil)
+	require.NoError(t, err)
+	require.NotNil(t, instance)
+	enricher := instance.(*HostnameAnnotatorInstance)
+
+	ev := &endpointEvent{addr: "192.0.2.1", port: 443}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Equal(t, "example.com", ev.hostname)
+
+	// Unknown endpoints and events without a remote address are left as is
+	ev = &endpointEvent{addr: "192.0.2.1", port: 80}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Empty(t, ev.hostname)
+
+	ev = &endpointEvent{port: 443}
+	require.NoError(t, enricher.EnrichEvent(ev))
+	require.Empty(t, ev.hostname)
+
+	require.NoError(t, enricher.EnrichEvent(struct{}{}))
+}
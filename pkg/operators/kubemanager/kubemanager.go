@@ -36,7 +36,7 @@ import (
 )
 
 const (
-	OperatorName       = "KubeManager"
+	OperatorName       = operators.KubeManagerName
 	ParamContainerName = "containername"
 	ParamSelector      = "selector"
 	ParamAllNamespaces = "all-namespaces"
@@ -45,7 +45,7 @@ import (
 )
 
 const (
-	OperatorName           = "LocalManager"
+	OperatorName           = operators.LocalManagerName
 	Runtimes               = "runtimes"
 	ContainerName          = "containername"
 	Host                   = "host"
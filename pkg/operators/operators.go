@@ -17,6 +17,8 @@ package operators
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -92,6 +94,26 @@ type Operator interface {
 	Instantiate(gadgetCtx GadgetContext, gadgetInstance any, params *params.Params) (OperatorInstance, error)
 }
 
+// Names of the operators adding container metadata to events. They are
+// defined here so that resolvers can run after them without importing them.
+const (
+	KubeManagerName  = "KubeManager"
+	LocalManagerName = "LocalManager"
+)
+
+// ContainerEnrichers can be returned by resolvers as their optional
+// dependencies, so that they run on events that already have their container
+// metadata
+var ContainerEnrichers = []string{KubeManagerName, LocalManagerName}
+
+// OptionalDependencies can be implemented by operators that have to run after
+// other operators when those are used, but that also work without them. Unlike
+// Dependencies, the listed operators are only used for ordering and missing
+// ones are ignored.
+type OptionalDependencies interface {
+	OptionalDependencies() []string
+}
+
 type ImageOperator interface {
 	Name() string
 
@@ -215,6 +237,15 @@ func (e *operatorWrapper) Init(params *params.Params) (err error) {
 	return err
 }
 
+// OptionalDependencies forwards the optional dependencies of the wrapped
+// operator, if it has any
+func (e *operatorWrapper) OptionalDependencies() []string {
+	if o, ok := e.Operator.(OptionalDependencies); ok {
+		return o.OptionalDependencies()
+	}
+	return nil
+}
+
 func GetRaw(name string) Operator {
 	if op, ok := allOperators[name]; ok {
 		return op.(*operatorWrapper).Operator
@@ -257,6 +288,11 @@ func GetOperatorsForGadget(gadget gadgets.GadgetDesc) Operators {
 			out = append(out, operator)
 		}
 	}
+	// allOperators is a map: sort by name first so that operators without
+	// dependencies between them always run in the same order
+	slices.SortFunc(out, func(a, b Operator) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
 	out, err := SortOperators(out)
 	if err != nil {
 		panic(fmt.Sprintf("sorting operators: %v", err))
@@ -367,9 +403,24 @@ func SortOperators(operators Operators) (Operators, error) {
 		incomingEdges[e.Name()] = 0
 	}
 
+	// Collect the dependencies of each element, keeping only the optional
+	// ones that are available
+	dependencies := make(map[string][]string, len(operators))
+	for _, e := range operators {
+		deps := slices.Clone(e.Dependencies())
+		if o, ok := e.(OptionalDependencies); ok {
+			for _, d := range o.OptionalDependencies() {
+				if _, ok := incomingEdges[d]; ok && d != e.Name() && !slices.Contains(deps, d) {
+					deps = append(deps, d)
+				}
+			}
+		}
+		dependencies[e.Name()] = deps
+	}
+
 	// Build the graph by adding an incoming edge for each dependency
 	for _, e := range operators {
-		for _, d := range e.Dependencies() {
+		for _, d := range dependencies[e.Name()] {
 			incomingEdges[d]++
 		}
 	}
@@ -417,7 +468,7 @@ outerLoop:
 		}
 
 		// Decrement the incoming edge count for each of the element's dependencies
-		for _, d := range result[0].Dependencies() {
+		for _, d := range dependencies[n] {
 			incomingEdges[d]--
 			// If a dependency's incoming edge count becomes zero, add it to the queue
 			if incomingEdges[d] == 0 {
@@ -193,3 +193,79 @@ func Test_SortOperatorsLargeCyclicDep(t *testing.T) {
 	_, err := SortOperators(ops)
 	assert.ErrorContains(t, err, "dependency cycle detected")
 }
+
+type testOptOp struct {
+	testOp
+	optionalDependencies []string
+}
+
+func (op testOptOp) OptionalDependencies() []string {
+	return op.optionalDependencies
+}
+
+func indexOf(ops Operators, name string) int {
+	for i, op := range ops {
+		if op.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func Test_SortOperatorsOptionalDeps(t *testing.T) {
+	ops := Operators{
+		testOptOp{createOp("resolver", nil), []string{"manager", "missing"}},
+		createOp("manager", nil),
+		createOp("other", []string{"manager"}),
+	}
+
+	sortedOps, err := SortOperators(ops)
+	if assert.NoError(t, err) {
+		assert.Len(t, sortedOps, len(ops))
+		assert.Less(t, indexOf(sortedOps, "manager"), indexOf(sortedOps, "resolver"))
+		assert.Less(t, indexOf(sortedOps, "manager"), indexOf(sortedOps, "other"))
+	}
+}
+
+func Test_SortOperatorsOptionalDepsWrapped(t *testing.T) {
+	ops := Operators{
+		&operatorWrapper{Operator: testOptOp{createOp("resolver", nil), []string{"manager"}}},
+		&operatorWrapper{Operator: createOp("manager", nil)},
+	}
+
+	sortedOps, err := SortOperators(ops)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"manager", "resolver"}, []string{sortedOps[0].Name(), sortedOps[1].Name()})
+	}
+}
+
+func Test_SortOperatorsOptionalCyclicDep(t *testing.T) {
+	ops := Operators{
+		testOptOp{createOp("a", nil), []string{"b"}},
+		createOp("b", []string{"a"}),
+	}
+
+	_, err := SortOperators(ops)
+	assert.ErrorContains(t, err, "dependency cycle detected")
+}
+
+func Test_GetOperatorsForGadgetDeterministic(t *testing.T) {
+	registered := allOperators
+	t.Cleanup(func() { allOperators = registered })
+
+	allOperators = map[string]Operator{}
+	for _, op := range []Operator{
+		createOp("a", nil),
+		createOp("b", nil),
+		createOp("c", []string{"a"}),
+		createOp("d", nil),
+		createOp("e", nil),
+	} {
+		Register(op)
+	}
+
+	first := GetOperatorsForGadget(nil)
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, first, GetOperatorsForGadget(nil))
+	}
+}
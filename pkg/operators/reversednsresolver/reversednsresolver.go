@@ -0,0 +1,263 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reversednsresolver provides an operator that enriches events by
+// resolving remote IP addresses to hostnames using reverse DNS. Lookups are
+// done in the background, so the hostname is only available once the lookup
+// finished: the first events for a given address won't have it.
+package reversednsresolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/operators"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/params"
+)
+
+const (
+	OperatorName = "ReverseDNSResolver"
+
+	ResolveParam    = "resolve"
+	ResolveTTLParam = "resolve-ttl"
+
+	lookupTimeout = 2 * time.Second
+
+	// maxConcurrentLookups is the number of lookups that can be in flight at
+	// the same time. Addresses seen while all of them are busy are looked up
+	// on one of their next events.
+	maxConcurrentLookups = 16
+
+	// maxEntries is the number of addresses that can be cached. New addresses
+	// aren't resolved once it's reached, until expired entries are pruned.
+	maxEntries = 4096
+)
+
+type RemoteAddrResolverInterface interface {
+	GetRemoteAddr() string
+	SetRemoteName(string)
+}
+
+type ReverseDNSResolver struct{}
+
+func (r *ReverseDNSResolver) Name() string {
+	return OperatorName
+}
+
+func (r *ReverseDNSResolver) Description() string {
+	return "ReverseDNSResolver resolves remote IP addresses to hostnames"
+}
+
+func (r *ReverseDNSResolver) GlobalParamDescs() params.ParamDescs {
+	return nil
+}
+
+func (r *ReverseDNSResolver) ParamDescs() params.ParamDescs {
+	return params.ParamDescs{
+		{
+			Key:          ResolveParam,
+			Title:        "Resolve remote addresses",
+			Description:  "Resolve remote IP addresses to hostnames using reverse DNS",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          ResolveTTLParam,
+			Title:        "Resolve TTL",
+			Description:  "Time during which a resolved hostname (or a failed lookup) is cached",
+			DefaultValue: "5m",
+			TypeHint:     params.TypeDuration,
+		},
+	}
+}
+
+func (r *ReverseDNSResolver) Dependencies() []string {
+	return nil
+}
+
+func (r *ReverseDNSResolver) CanOperateOn(gadget gadgets.GadgetDesc) bool {
+	_, hasRemoteAddrResolverInterface := gadget.EventPrototype().(RemoteAddrResolverInterface)
+	return hasRemoteAddrResolverInterface
+}
+
+func (r *ReverseDNSResolver) Init(params *params.Params) error {
+	return nil
+}
+
+func (r *ReverseDNSResolver) Close() error {
+	return nil
+}
+
+func (r *ReverseDNSResolver) Instantiate(gadgetCtx operators.GadgetContext, gadgetInstance any, params *params.Params) (operators.OperatorInstance, error) {
+	if !params.Get(ResolveParam).AsBool() {
+		return nil, nil
+	}
+
+	return &ReverseDNSResolverInstance{
+		gadgetCtx: gadgetCtx,
+		cache:     newNameCache(params.Get(ResolveTTLParam).AsDuration()),
+	}, nil
+}
+
+type ReverseDNSResolverInstance struct {
+	gadgetCtx operators.GadgetContext
+	cache     *nameCache
+}
+
+func (m *ReverseDNSResolverInstance) Name() string {
+	return "ReverseDNSResolverInstance"
+}
+
+func (m *ReverseDNSResolverInstance) PreGadgetRun() error {
+	return nil
+}
+
+func (m *ReverseDNSResolverInstance) PostGadgetRun() error {
+	return nil
+}
+
+func (m *ReverseDNSResolverInstance) enrich(ev any) {
+	resolver, ok := ev.(RemoteAddrResolverInterface)
+	if !ok {
+		return
+	}
+
+	addr := resolver.GetRemoteAddr()
+	if addr == "" {
+		return
+	}
+
+	// An empty name means the lookup failed or is still ongoing: the raw
+	// address is left as is.
+	if name := m.cache.get(m.gadgetCtx.Context(), addr); name != "" {
+		resolver.SetRemoteName(name)
+	}
+}
+
+func (m *ReverseDNSResolverInstance) EnrichEvent(ev any) error {
+	m.enrich(ev)
+	return nil
+}
+
+type cacheEntry struct {
+	name    string
+	expires time.Time
+	pending bool
+}
+
+// lookupFunc returns the names of addr, like net.Resolver.LookupAddr
+type lookupFunc func(ctx context.Context, addr string) ([]string, error)
+
+// nameCache caches reverse DNS lookups. Both successful and failed lookups
+// are cached for ttl, to avoid sending a request for each event.
+type nameCache struct {
+	mu         sync.Mutex
+	entries    map[string]*cacheEntry
+	ttl        time.Duration
+	lastPrune  time.Time
+	maxEntries int
+
+	lookupAddr lookupFunc
+	// slots limits the number of concurrent lookups
+	slots chan struct{}
+}
+
+func newNameCache(ttl time.Duration) *nameCache {
+	return newNameCacheWithLookup(ttl, net.DefaultResolver.LookupAddr)
+}
+
+func newNameCacheWithLookup(ttl time.Duration, lookupAddr lookupFunc) *nameCache {
+	return &nameCache{
+		entries:    make(map[string]*cacheEntry),
+		ttl:        ttl,
+		lastPrune:  time.Now(),
+		maxEntries: maxEntries,
+		lookupAddr: lookupAddr,
+		slots:      make(chan struct{}, maxConcurrentLookups),
+	}
+}
+
+// get returns the cached name for addr, starting a background lookup if
+// there is no valid entry for it.
+func (c *nameCache) get(ctx context.Context, addr string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := c.entries[addr]
+	if ok && (entry.pending || now.Before(entry.expires)) {
+		return entry.name
+	}
+
+	c.pruneLocked(now)
+
+	name := ""
+	if ok {
+		// Keep serving the expired name while it's refreshed
+		name = entry.name
+	} else if len(c.entries) >= c.maxEntries {
+		return ""
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		// Too many lookups in flight, retry on a next event
+		return name
+	}
+
+	c.entries[addr] = &cacheEntry{name: name, pending: true}
+	go c.lookup(ctx, addr)
+
+	return name
+}
+
+func (c *nameCache) lookup(ctx context.Context, addr string) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	name := ""
+	names, err := c.lookupAddr(ctx, addr)
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	<-c.slots
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[addr] = &cacheEntry{name: name, expires: time.Now().Add(c.ttl)}
+}
+
+// pruneLocked removes expired entries so the cache doesn't grow forever. It
+// must be called with c.mu held.
+func (c *nameCache) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < c.ttl {
+		return
+	}
+	c.lastPrune = now
+
+	for addr, entry := range c.entries {
+		if !entry.pending && now.After(entry.expires) {
+			delete(c.entries, addr)
+		}
+	}
+}
+
+func init() {
+	operators.Register(&ReverseDNSResolver{})
+}
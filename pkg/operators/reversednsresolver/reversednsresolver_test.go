@@ -0,0 +1,158 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reversednsresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLookup resolves addr to "host-<addr>." and counts the lookups of each
+// address. Addresses listed in failing can't be resolved. Lookups block until
+// release is closed, if it's set.
+type fakeLookup struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	failing map[string]bool
+	release chan struct{}
+}
+
+func newFakeLookup() *fakeLookup {
+	return &fakeLookup{calls: make(map[string]int), failing: make(map[string]bool)}
+}
+
+func (f *fakeLookup) lookup(ctx context.Context, addr string) ([]string, error) {
+	f.mu.Lock()
+	f.calls[addr]++
+	release := f.release
+	fail := f.failing[addr]
+	f.mu.Unlock()
+
+	if release != nil {
+		<-release
+	}
+	if fail {
+		return nil, errors.New("no such host")
+	}
+	return []string{"host-" + addr + "."}, nil
+}
+
+func (f *fakeLookup) callsOf(addr string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[addr]
+}
+
+// waitResolved waits until the lookup of addr finished
+func waitResolved(t *testing.T, c *nameCache, addr string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		entry, ok := c.entries[addr]
+		return ok && !entry.pending
+	}, time.Second, time.Millisecond)
+}
+
+func TestNameCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("pending", func(t *testing.T) {
+		lookup := newFakeLookup()
+		lookup.release = make(chan struct{})
+		c := newNameCacheWithLookup(time.Minute, lookup.lookup)
+
+		require.Empty(t, c.get(ctx, "10.0.0.1"))
+		require.Empty(t, c.get(ctx, "10.0.0.1"), "the name isn't known while the lookup is pending")
+
+		close(lookup.release)
+		waitResolved(t, c, "10.0.0.1")
+		require.Equal(t, "host-10.0.0.1", c.get(ctx, "10.0.0.1"))
+		require.Equal(t, 1, lookup.callsOf("10.0.0.1"))
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		lookup := newFakeLookup()
+		lookup.failing["10.0.0.2"] = true
+		c := newNameCacheWithLookup(time.Minute, lookup.lookup)
+
+		require.Empty(t, c.get(ctx, "10.0.0.2"))
+		waitResolved(t, c, "10.0.0.2")
+		require.Empty(t, c.get(ctx, "10.0.0.2"))
+		require.Equal(t, 1, lookup.callsOf("10.0.0.2"), "failed lookups are cached too")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		lookup := newFakeLookup()
+		c := newNameCacheWithLookup(time.Minute, lookup.lookup)
+
+		c.get(ctx, "10.0.0.3")
+		waitResolved(t, c, "10.0.0.3")
+
+		c.mu.Lock()
+		c.entries["10.0.0.3"].expires = time.Now().Add(-time.Second)
+		c.mu.Unlock()
+
+		require.Equal(t, "host-10.0.0.3", c.get(ctx, "10.0.0.3"), "the expired name is served while it's refreshed")
+		waitResolved(t, c, "10.0.0.3")
+		require.Equal(t, 2, lookup.callsOf("10.0.0.3"))
+	})
+
+	t.Run("concurrent lookups", func(t *testing.T) {
+		lookup := newFakeLookup()
+		lookup.release = make(chan struct{})
+		c := newNameCacheWithLookup(time.Minute, lookup.lookup)
+
+		for i := 0; i < maxConcurrentLookups+1; i++ {
+			c.get(ctx, fmt.Sprintf("10.0.1.%d", i))
+		}
+		last := fmt.Sprintf("10.0.1.%d", maxConcurrentLookups)
+		c.mu.Lock()
+		require.Len(t, c.entries, maxConcurrentLookups)
+		require.NotContains(t, c.entries, last)
+		c.mu.Unlock()
+
+		close(lookup.release)
+		for i := 0; i < maxConcurrentLookups; i++ {
+			waitResolved(t, c, fmt.Sprintf("10.0.1.%d", i))
+		}
+
+		// A slot is free again
+		c.get(ctx, last)
+		waitResolved(t, c, last)
+		require.Equal(t, "host-"+last, c.get(ctx, last))
+	})
+
+	t.Run("max entries", func(t *testing.T) {
+		lookup := newFakeLookup()
+		c := newNameCacheWithLookup(time.Minute, lookup.lookup)
+		c.maxEntries = 2
+
+		for _, addr := range []string{"10.0.2.1", "10.0.2.2"} {
+			c.get(ctx, addr)
+			waitResolved(t, c, addr)
+		}
+
+		require.Empty(t, c.get(ctx, "10.0.2.3"))
+		require.Zero(t, lookup.callsOf("10.0.2.3"))
+		require.Equal(t, "host-10.0.2.1", c.get(ctx, "10.0.2.1"))
+	})
+}
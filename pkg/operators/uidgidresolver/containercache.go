@@ -0,0 +1,213 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uidgidresolver
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/host"
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/utils/secureopen"
+)
+
+// containerFilesTTL is how long the passwd and group files of a container
+// are cached before being read again, so users added while the container
+// runs are picked up.
+const containerFilesTTL = 30 * time.Second
+
+// containerFiles holds the content of the passwd and group files of a
+// container. users and groups are nil when the corresponding file doesn't
+// exist in the container, so the host files are used instead.
+type containerFiles struct {
+	users       map[uint32]string
+	groups      map[uint32]string
+	memberships map[string][]string
+
+	// pid is the container pid the files were read through, 0 if its
+	// rootfs was given by the event
+	pid     uint32
+	expires time.Time
+}
+
+func (f *containerFiles) username(uid uint32) (string, bool) {
+	if f == nil || f.users == nil {
+		return "", false
+	}
+	name, ok := f.users[uid]
+	return name, ok
+}
+
+func (f *containerFiles) groupname(gid uint32) (string, bool) {
+	if f == nil || f.groups == nil {
+		return "", false
+	}
+	name, ok := f.groups[gid]
+	return name, ok
+}
+
+// groupsForUser returns the groups listing the user in the group file of
+// the container. It returns false if the user isn't known by the container,
+// or if the container has no group file.
+func (f *containerFiles) groupsForUser(uid uint32) ([]string, bool) {
+	username, ok := f.username(uid)
+	if !ok || f.groups == nil {
+		return nil, false
+	}
+	groups := f.memberships[username]
+	if len(groups) == 0 {
+		return nil, true
+	}
+	return append([]string(nil), groups...), true
+}
+
+// containerFileMaxSize is the size above which the passwd and group files of
+// containers are truncated, so a container can't make the agent use an
+// unbounded amount of memory
+const containerFileMaxSize = 16 * 1024 * 1024
+
+// readContainerFiles reads the passwd and group files below rootfs
+func readContainerFiles(rootfs string) *containerFiles {
+	files := &containerFiles{}
+
+	if entries, ok := readContainerFile(rootfs, filepath.Join(baseDirPath, passwdFileName)); ok {
+		files.users = make(map[uint32]string, len(entries))
+		for _, e := range entries {
+			// The first entry wins, as with the C library
+			if _, ok := files.users[e.id]; !ok {
+				files.users[e.id] = e.name
+			}
+		}
+	}
+
+	if entries, ok := readContainerFile(rootfs, filepath.Join(baseDirPath, groupFileName)); ok {
+		files.groups = make(map[uint32]string, len(entries))
+		files.memberships = make(map[string][]string)
+		for _, e := range entries {
+			if _, ok := files.groups[e.id]; !ok {
+				files.groups[e.id] = e.name
+			}
+			if len(e.fields) < 4 {
+				continue
+			}
+			for _, member := range memberList(e.fields[3]) {
+				files.memberships[member] = append(files.memberships[member], e.name)
+			}
+		}
+	}
+
+	return files
+}
+
+// readContainerFile returns the entries of the passwd or group file at path
+// in rootfs. It returns false if the file can't be read, missing files being
+// expected as not all images have them. The path is resolved in rootfs, so
+// the symlinks of the container can't point to the files of the host, and
+// anything but a regular file is refused, so a FIFO can't block the read.
+func readContainerFile(rootfs, path string) ([]entry, bool) {
+	f, err := secureopen.OpenInRoot(rootfs, path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Debugf("UserGroupCache: open %q in %q: %v", path, rootfs, err)
+		}
+		return nil, false
+	}
+	defer f.Close()
+
+	entries, err := parseEntries(io.LimitReader(f, containerFileMaxSize))
+	if err != nil {
+		log.Debugf("UserGroupCache: read %q in %q: %v", path, rootfs, err)
+		return nil, false
+	}
+	return entries, true
+}
+
+// containerCache caches the passwd and group files of containers, keyed by
+// container id. The files of a container are evicted once it's stopped,
+// i.e. once its pid is gone.
+type containerCache struct {
+	mu        sync.Mutex
+	entries   map[string]*containerFiles
+	lastPrune time.Time
+}
+
+func newContainerCache() *containerCache {
+	return &containerCache{
+		entries:   make(map[string]*containerFiles),
+		lastPrune: time.Now(),
+	}
+}
+
+// get returns the files of the given container. They are read below rootfs,
+// or below /proc/<pid>/root if rootfs is empty. It returns nil if neither is
+// known.
+func (c *containerCache) get(containerID string, pid uint32, rootfs string) *containerFiles {
+	if rootfs == "" {
+		if pid == 0 {
+			return nil
+		}
+		rootfs = filepath.Join(host.HostProcFs, strconv.FormatUint(uint64(pid), 10), "root")
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	if files, ok := c.entries[containerID]; ok && files.pid == pid && now.Before(files.expires) {
+		c.mu.Unlock()
+		return files
+	}
+	c.mu.Unlock()
+
+	// The files are read without holding the lock, so a slow container
+	// filesystem doesn't block the events of the other containers. Concurrent
+	// misses of the same container read them more than once, the last read
+	// being cached.
+	files := readContainerFiles(rootfs)
+	files.pid = pid
+	files.expires = now.Add(containerFilesTTL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(now)
+	c.entries[containerID] = files
+
+	return files
+}
+
+// pruneLocked removes the files of the stopped containers and the expired
+// ones. It must be called with c.mu held.
+func (c *containerCache) pruneLocked(now time.Time) {
+	if now.Sub(c.lastPrune) < containerFilesTTL {
+		return
+	}
+	c.lastPrune = now
+
+	for containerID, files := range c.entries {
+		if now.After(files.expires) || (files.pid != 0 && !processExists(files.pid)) {
+			delete(c.entries, containerID)
+		}
+	}
+}
+
+func processExists(pid uint32) bool {
+	_, err := os.Stat(filepath.Join(host.HostProcFs, strconv.FormatUint(uint64(pid), 10)))
+	return err == nil
+}
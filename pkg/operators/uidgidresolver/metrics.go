@@ -0,0 +1,99 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uidgidresolver
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+const (
+	kindUid = "uid"
+	kindGid = "gid"
+)
+
+var (
+	uidAttrs = metric.WithAttributes(attribute.String("kind", kindUid))
+	gidAttrs = metric.WithAttributes(attribute.String("kind", kindGid))
+)
+
+// cacheMetrics counts the lookups and reloads of the cache. The counters are
+// exported through the default Prometheus registry, that is served by the
+// Prometheus operator.
+type cacheMetrics struct {
+	hits      metric.Int64Counter
+	misses    metric.Int64Counter
+	refreshes metric.Int64Counter
+}
+
+func newCacheMetrics() (*cacheMetrics, error) {
+	exporter, err := prometheus.New()
+	if err != nil {
+		return nil, fmt.Errorf("initialize prometheus exporter: %w", err)
+	}
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter)).Meter("uidgidresolver")
+
+	m := &cacheMetrics{}
+	m.hits, err = meter.Int64Counter("uidgidresolver_cache_hits",
+		metric.WithDescription("Number of ids resolved from the cache"))
+	if err != nil {
+		return nil, fmt.Errorf("creating hits counter: %w", err)
+	}
+	m.misses, err = meter.Int64Counter("uidgidresolver_cache_misses",
+		metric.WithDescription("Number of ids that couldn't be resolved"))
+	if err != nil {
+		return nil, fmt.Errorf("creating misses counter: %w", err)
+	}
+	m.refreshes, err = meter.Int64Counter("uidgidresolver_cache_refreshes",
+		metric.WithDescription("Number of reloads of the passwd (uid) and group (gid) files"))
+	if err != nil {
+		return nil, fmt.Errorf("creating refreshes counter: %w", err)
+	}
+	return m, nil
+}
+
+func kindAttrs(kind string) metric.AddOption {
+	if kind == kindGid {
+		return gidAttrs
+	}
+	return uidAttrs
+}
+
+// lookup counts a lookup of the given kind. It's a no-op if m is nil, i.e.
+// when metrics are disabled.
+func (m *cacheMetrics) lookup(kind string, hit bool) {
+	if m == nil {
+		return
+	}
+	if hit {
+		m.hits.Add(context.Background(), 1, kindAttrs(kind))
+	} else {
+		m.misses.Add(context.Background(), 1, kindAttrs(kind))
+	}
+}
+
+// refresh counts a reload of the file of the given kind. It's a no-op if m is
+// nil.
+func (m *cacheMetrics) refresh(kind string) {
+	if m == nil {
+		return
+	}
+	m.refreshes.Add(context.Background(), 1, kindAttrs(kind))
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo && !osusergo
+
+package uidgidresolver
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// nssAvailable is true when os/user goes through getpwuid_r and getgrgid_r,
+// and hence through the name service switch, rather than parsing /etc/passwd
+// and /etc/group of the local filesystem.
+const nssAvailable = true
+
+func lookupUserNSS(uid uint32) (string, bool) {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return "", false
+	}
+	return u.Username, true
+}
+
+func lookupGroupNSS(gid uint32) (string, bool) {
+	g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10))
+	if err != nil {
+		return "", false
+	}
+	return g.Name, true
+}
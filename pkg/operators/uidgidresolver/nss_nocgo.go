@@ -0,0 +1,30 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo || osusergo
+
+package uidgidresolver
+
+// nssAvailable is false without cgo: the pure Go implementation of os/user
+// only parses the files of the local filesystem, which aren't the ones of the
+// host, so the ids are only resolved through the passwd and group files.
+const nssAvailable = false
+
+func lookupUserNSS(uid uint32) (string, bool) {
+	return "", false
+}
+
+func lookupGroupNSS(gid uint32) (string, bool) {
+	return "", false
+}
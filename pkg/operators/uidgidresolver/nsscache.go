@@ -0,0 +1,169 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uidgidresolver
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// missTTL is how long a failed lookup is cached. It's kept short so an id
+// that becomes known later is resolved soon after, while the events carrying
+// an unknown id, e.g. one only known in a container, don't each trigger a
+// lookup.
+const missTTL = 30 * time.Second
+
+// nssCache is a size-bounded least recently used cache of the names resolved
+// through the name service switch. Unlike the files, the name service switch
+// can return any number of different users (e.g. dynamic users of systemd or
+// SSSD), so the names can't be all kept. Failed lookups are cached too, for
+// missTTL.
+type nssCache struct {
+	mu      sync.Mutex
+	maxSize int
+	order   *list.List
+	entries map[uint32]*list.Element
+}
+
+type nssCacheEntry struct {
+	id   uint32
+	name string
+	// found is false for failed lookups, which are only valid until expires
+	found   bool
+	expires time.Time
+}
+
+func newNSSCache(maxSize int) *nssCache {
+	return &nssCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[uint32]*list.Element),
+	}
+}
+
+// resolve returns the name of id, calling lookup if it isn't cached. A nil
+// cache always calls lookup.
+func (c *nssCache) resolve(id uint32, lookup func(uint32) (string, bool)) (string, bool) {
+	if c == nil {
+		return lookup(id)
+	}
+
+	if entry, ok := c.cached(id); ok {
+		return entry.name, entry.found
+	}
+
+	// Don't hold the lock during the lookup, it can be slow
+	name, found := lookup(id)
+	if found {
+		c.add(id, name)
+	} else {
+		c.addMiss(id)
+	}
+	return name, found
+}
+
+// get returns the name of id if it's cached and was found
+func (c *nssCache) get(id uint32) (string, bool) {
+	entry, ok := c.cached(id)
+	if !ok || !entry.found {
+		return "", false
+	}
+	return entry.name, true
+}
+
+// cached returns a copy of the entry of id, if any. Expired failed lookups
+// are removed instead.
+func (c *nssCache) cached(id uint32) (nssCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nssCacheEntry{}, false
+	}
+	entry := elem.Value.(*nssCacheEntry)
+	if !entry.found && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+		return nssCacheEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *entry, true
+}
+
+func (c *nssCache) add(id uint32, name string) {
+	c.put(&nssCacheEntry{id: id, name: name, found: true})
+}
+
+// addMiss caches a failed lookup of id for missTTL
+func (c *nssCache) addMiss(id uint32) {
+	c.put(&nssCacheEntry{id: id, expires: time.Now().Add(missTTL)})
+}
+
+func (c *nssCache) put(entry *nssCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.id]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[entry.id] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nssCacheEntry).id)
+	}
+}
+
+// clear removes all the cached names. It does nothing on a nil cache.
+func (c *nssCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+// copyTo adds the cached names to names, leaving the failed lookups out. It
+// does nothing on a nil cache.
+func (c *nssCache) copyTo(names map[uint32]string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, elem := range c.entries {
+		if entry := elem.Value.(*nssCacheEntry); entry.found {
+			names[id] = entry.name
+		}
+	}
+}
+
+func (c *nssCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -14,12 +14,18 @@
 
 // Package uidgidresolver provides an operator that enriches events by looking
 // up uid and gid resolving them to the corresponding username and groupname.
-// Only /etc/passwd and /etc/group is read on the host. Therefore the name for a
-// corresponding id could be wrong.
+// By default, only /etc/passwd and /etc/group is read on the host. Therefore the
+// name for a corresponding id could be wrong, unless the name service switch
+// backend is enabled. Both files are watched and reloaded when they
+// change; if the watch can't be set up, they are only read once. Events from
+// containers are resolved with the files of their container first, if it has
+// them.
 package uidgidresolver
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
 
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/datasource"
 	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadget-service/api"
@@ -34,6 +40,50 @@ const (
 	OperatorName          = "UidGidResolver"
 	DefaultUserFieldName  = "user"
 	DefaultGroupFieldName = "group"
+
+	ParamPasswdPath      = "passwd-path"
+	ParamGroupPath       = "group-path"
+	ParamRefreshInterval = "refresh-interval"
+	ParamFallbackToID    = "fallback-to-id"
+	ParamMetrics         = "metrics"
+	ParamBackend         = "backend"
+	ParamCacheSize       = "cache-size"
+	ParamSkipRoot        = "skip-root"
+	ParamStaticMappings  = "static-mappings"
+	ParamResolution      = "uidgid-resolution"
+	ParamGroupLoading    = "group-loading"
+	ParamNameSource      = "name-source"
+
+	DefaultCacheSize = 1024
+)
+
+const (
+	// BackendFiles only resolves the ids listed in the passwd and group
+	// files
+	BackendFiles = "files"
+	// BackendNSS resolves the ids through the name service switch, e.g. to
+	// use SSSD. It requires cgo, ids are never resolved without it.
+	BackendNSS = "nss"
+	// BackendFilesNSS tries the files first and then the name service switch
+	BackendFilesNSS = "files+nss"
+)
+
+const (
+	// GroupLoadingEager reads the whole group file when the cache starts and
+	// each time it changes
+	GroupLoadingEager = "eager"
+	// GroupLoadingLazy only looks up the group file when a gid is resolved,
+	// keeping the resolved names in a cache of cache-size entries. It makes
+	// the start cheaper with huge group files.
+	GroupLoadingLazy = "lazy"
+)
+
+const (
+	// NameSourceLogin resolves uids to login names
+	NameSourceLogin = "login"
+	// NameSourceGecos resolves uids to the full names of the GECOS field of
+	// the passwd file, falling back to the login names when it's empty
+	NameSourceGecos = "gecos"
 )
 
 type UidResolverInterface interface {
@@ -46,7 +96,77 @@ type GidResolverInterface interface {
 	SetGroupName(string)
 }
 
-type UidGidResolver struct{}
+// SupplementaryGroupsResolverInterface is implemented by events that want the
+// names of all the groups the user is a member of, according to the group
+// file.
+type SupplementaryGroupsResolverInterface interface {
+	GetUid() uint32
+	SetSupplementaryGroups([]string)
+}
+
+// ExtendedUidResolverInterface is implemented by events carrying both the real
+// and the effective ids of the process, e.g. security events where they can
+// differ. Each of its parts is optional: an event only implementing
+// EffectiveUidResolverInterface gets only its effective user name set. Events
+// implementing none of them keep being handled through UidResolverInterface
+// and GidResolverInterface.
+type ExtendedUidResolverInterface interface {
+	RealUidResolverInterface
+	EffectiveUidResolverInterface
+	RealGidResolverInterface
+	EffectiveGidResolverInterface
+}
+
+type RealUidResolverInterface interface {
+	GetRealUid() uint32
+	SetRealUserName(string)
+}
+
+type EffectiveUidResolverInterface interface {
+	GetEffectiveUid() uint32
+	SetEffectiveUserName(string)
+}
+
+type RealGidResolverInterface interface {
+	GetRealGid() uint32
+	SetRealGroupName(string)
+}
+
+type EffectiveGidResolverInterface interface {
+	GetEffectiveGid() uint32
+	SetEffectiveGroupName(string)
+}
+
+// ResolvableList is implemented by events holding sub-events, e.g. batches,
+// whose ids need to be resolved too. Each element is enriched as a standalone
+// event, so it has to implement the same interfaces as one.
+type ResolvableList interface {
+	ResolvableElements() []any
+}
+
+// ContainerResolverInterface is implemented by events that can come from
+// containers. Their ids are resolved with the passwd and group files of the
+// container, read through /proc/<container pid>/root, falling back to the host
+// files for the ids the container doesn't know or if it doesn't have the
+// files. Events with an empty container id are resolved on the host.
+type ContainerResolverInterface interface {
+	GetContainerID() string
+	GetContainerPid() uint32
+}
+
+// ContainerRootfsResolverInterface can be implemented by events implementing
+// ContainerResolverInterface that know the path of the root filesystem of
+// their container on the host. It's used instead of the one derived from the
+// container pid when it isn't empty.
+type ContainerRootfsResolverInterface interface {
+	GetContainerRootfs() string
+}
+
+type UidGidResolver struct {
+	// disabled is set when ParamResolution is false, the operator isn't
+	// instantiated then
+	disabled bool
+}
 
 func (k *UidGidResolver) Name() string {
 	return OperatorName
@@ -57,33 +177,298 @@ func (k *UidGidResolver) Description() string {
 }
 
 func (k *UidGidResolver) GlobalParamDescs() params.ParamDescs {
-	return nil
+	return params.ParamDescs{
+		{
+			Key:          ParamResolution,
+			Title:        "Uid and gid resolution",
+			Description:  "Resolve uids and gids to user and group names. When disabled, the names are left empty.",
+			DefaultValue: "true",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          ParamPasswdPath,
+			Title:        "Passwd path",
+			Description:  "Path of the passwd file used to resolve uids",
+			DefaultValue: fullPasswdPath,
+		},
+		{
+			Key:          ParamGroupPath,
+			Title:        "Group path",
+			Description:  "Path of the group file used to resolve gids",
+			DefaultValue: fullGroupPath,
+		},
+		{
+			Key:          ParamRefreshInterval,
+			Title:        "Refresh interval",
+			Description:  "Interval at which the passwd and group files are re-read (0 to only rely on file change notifications)",
+			DefaultValue: "0",
+			TypeHint:     params.TypeDuration,
+		},
+		{
+			Key:          ParamMetrics,
+			Title:        "Metrics",
+			Description:  "Export Prometheus metrics about cache hits, misses and refreshes",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:            ParamBackend,
+			Title:          "Backend",
+			Description:    "Where to look up uids and gids: the passwd and group files, the name service switch (requires cgo) or the files and then the name service switch",
+			DefaultValue:   BackendFiles,
+			PossibleValues: []string{BackendFiles, BackendNSS, BackendFilesNSS},
+		},
+		{
+			Key:          ParamCacheSize,
+			Title:        "Cache size",
+			Description:  "Maximum number of users and of groups resolved through the name service switch to keep in cache (0 to disable the cache)",
+			DefaultValue: strconv.Itoa(DefaultCacheSize),
+			TypeHint:     params.TypeUint,
+		},
+		{
+			Key:            ParamGroupLoading,
+			Title:          "Group loading",
+			Description:    "Read the whole group file when starting (eager) or look up each gid when it's first resolved (lazy), which is faster to start with huge group files",
+			DefaultValue:   GroupLoadingEager,
+			PossibleValues: []string{GroupLoadingEager, GroupLoadingLazy},
+		},
+		{
+			Key:            ParamNameSource,
+			Title:          "Name source",
+			Description:    "Resolve uids to login names or to the full names of the GECOS field of the passwd file, when it's set",
+			DefaultValue:   NameSourceLogin,
+			PossibleValues: []string{NameSourceLogin, NameSourceGecos},
+		},
+		{
+			Key:          ParamStaticMappings,
+			Title:        "Static mappings",
+			Description:  "Comma-separated id=name pairs, e.g. 1000=alice,1001=bob, giving the names of these uids and gids regardless of the passwd and group files",
+			DefaultValue: "",
+			Validator: func(value string) error {
+				_, err := ParseStaticMappings(value)
+				return err
+			},
+		},
+	}
 }
 
 func (k *UidGidResolver) GlobalParams() api.Params {
-	return nil
+	return api.Params{
+		{
+			Key:          ParamResolution,
+			Description:  "Resolve uids and gids to user and group names. When disabled, the names are left empty.",
+			DefaultValue: "true",
+			TypeHint:     api.TypeBool,
+		},
+		{
+			Key:          ParamPasswdPath,
+			Description:  "Path of the passwd file used to resolve uids",
+			DefaultValue: fullPasswdPath,
+			TypeHint:     api.TypeString,
+		},
+		{
+			Key:          ParamGroupPath,
+			Description:  "Path of the group file used to resolve gids",
+			DefaultValue: fullGroupPath,
+			TypeHint:     api.TypeString,
+		},
+		{
+			Key:          ParamRefreshInterval,
+			Description:  "Interval at which the passwd and group files are re-read (0 to only rely on file change notifications)",
+			DefaultValue: "0",
+			TypeHint:     api.TypeDuration,
+		},
+		{
+			Key:          ParamMetrics,
+			Description:  "Export Prometheus metrics about cache hits, misses and refreshes",
+			DefaultValue: "false",
+			TypeHint:     api.TypeBool,
+		},
+		{
+			Key:            ParamBackend,
+			Description:    "Where to look up uids and gids: the passwd and group files, the name service switch (requires cgo) or the files and then the name service switch",
+			DefaultValue:   BackendFiles,
+			TypeHint:       api.TypeString,
+			PossibleValues: []string{BackendFiles, BackendNSS, BackendFilesNSS},
+		},
+		{
+			Key:          ParamCacheSize,
+			Description:  "Maximum number of users and of groups resolved through the name service switch to keep in cache (0 to disable the cache)",
+			DefaultValue: strconv.Itoa(DefaultCacheSize),
+			TypeHint:     api.TypeUint,
+		},
+		{
+			Key:            ParamGroupLoading,
+			Description:    "Read the whole group file when starting (eager) or look up each gid when it's first resolved (lazy), which is faster to start with huge group files",
+			DefaultValue:   GroupLoadingEager,
+			TypeHint:       api.TypeString,
+			PossibleValues: []string{GroupLoadingEager, GroupLoadingLazy},
+		},
+		{
+			Key:            ParamNameSource,
+			Description:    "Resolve uids to login names or to the full names of the GECOS field of the passwd file, when it's set",
+			DefaultValue:   NameSourceLogin,
+			TypeHint:       api.TypeString,
+			PossibleValues: []string{NameSourceLogin, NameSourceGecos},
+		},
+		{
+			Key:          ParamStaticMappings,
+			Description:  "Comma-separated id=name pairs, e.g. 1000=alice,1001=bob, giving the names of these uids and gids regardless of the passwd and group files",
+			DefaultValue: "",
+			TypeHint:     api.TypeString,
+		},
+	}
 }
 
 func (k *UidGidResolver) InstanceParams() api.Params {
-	return nil
+	return api.Params{
+		{
+			Key:          ParamFallbackToID,
+			Description:  "Use the numeric id as name when a uid or gid can't be resolved",
+			DefaultValue: "false",
+			TypeHint:     api.TypeBool,
+		},
+		{
+			Key:          ParamSkipRoot,
+			Description:  "Don't resolve the uid and gid 0, leaving their names untouched",
+			DefaultValue: "false",
+			TypeHint:     api.TypeBool,
+		},
+	}
 }
 
 func (k *UidGidResolver) ParamDescs() params.ParamDescs {
-	return nil
+	return params.ParamDescs{
+		{
+			Key:          ParamFallbackToID,
+			Title:        "Fallback to id",
+			Description:  "Use the numeric id as name when a uid or gid can't be resolved",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+		{
+			Key:          ParamSkipRoot,
+			Title:        "Skip root",
+			Description:  "Don't resolve the uid and gid 0, leaving their names untouched",
+			DefaultValue: "false",
+			TypeHint:     params.TypeBool,
+		},
+	}
 }
 
 func (k *UidGidResolver) Dependencies() []string {
 	return nil
 }
 
+// OptionalDependencies makes the resolver run after the container enrichers,
+// if they are used
+func (k *UidGidResolver) OptionalDependencies() []string {
+	return operators.ContainerEnrichers
+}
+
 func (k *UidGidResolver) CanOperateOn(gadget gadgets.GadgetDesc) bool {
-	_, hasUidResolverInterface := gadget.EventPrototype().(UidResolverInterface)
-	_, hasGidResolverInterface := gadget.EventPrototype().(GidResolverInterface)
-	return hasUidResolverInterface || hasGidResolverInterface
+	prototype := gadget.EventPrototype()
+	hasUidResolverInterface := implements[UidResolverInterface](prototype)
+	hasGidResolverInterface := implements[GidResolverInterface](prototype)
+	hasSupplementaryGroupsResolverInterface := implements[SupplementaryGroupsResolverInterface](prototype)
+	hasResolvableList := implements[ResolvableList](prototype)
+	return hasUidResolverInterface || hasGidResolverInterface || hasSupplementaryGroupsResolverInterface ||
+		implementsExtended(prototype) || hasResolvableList
+}
+
+// implementsExtended returns whether prototype implements any part of
+// ExtendedUidResolverInterface.
+func implementsExtended(prototype any) bool {
+	return implements[RealUidResolverInterface](prototype) ||
+		implements[EffectiveUidResolverInterface](prototype) ||
+		implements[RealGidResolverInterface](prototype) ||
+		implements[EffectiveGidResolverInterface](prototype)
+}
+
+// implements returns whether prototype or a pointer to it implements T.
+// Gadgets don't agree on whether their event prototype is a value or a
+// pointer, so a value whose methods have pointer receivers must be matched
+// too, as the events themselves are passed as pointers.
+func implements[T any](prototype any) bool {
+	if prototype == nil {
+		return false
+	}
+	if _, ok := prototype.(T); ok {
+		return true
+	}
+
+	iface := reflect.TypeOf((*T)(nil)).Elem()
+	typ := reflect.TypeOf(prototype)
+	if typ.Kind() == reflect.Pointer {
+		// The method set of a pointer already includes the one of the value
+		return false
+	}
+	return reflect.PointerTo(typ).Implements(iface)
 }
 
 func (k *UidGidResolver) Init(params *params.Params) error {
-	return nil
+	if params == nil {
+		return nil
+	}
+
+	if p := params.Get(ParamResolution); p != nil {
+		k.disabled = !p.AsBool()
+	}
+	if k.disabled {
+		// The cache won't be used, don't bother configuring it
+		return nil
+	}
+
+	// The cache is shared, so both the operator and the data operator
+	// configure it: only values different from the defaults are applied, so
+	// that one doesn't revert what the other one set.
+	passwdPath := ""
+	if p := params.Get(ParamPasswdPath); p != nil && p.AsString() != fullPasswdPath {
+		passwdPath = p.AsString()
+	}
+	groupPath := ""
+	if p := params.Get(ParamGroupPath); p != nil && p.AsString() != fullGroupPath {
+		groupPath = p.AsString()
+	}
+
+	cache := GetUserGroupCache()
+	if p := params.Get(ParamRefreshInterval); p != nil && p.AsDuration() != 0 {
+		cache.SetRefreshInterval(p.AsDuration())
+	}
+	if p := params.Get(ParamMetrics); p != nil && p.AsBool() {
+		if err := cache.EnableMetrics(); err != nil {
+			return fmt.Errorf("enabling metrics: %w", err)
+		}
+	}
+	if p := params.Get(ParamCacheSize); p != nil && p.AsUint() != DefaultCacheSize {
+		if err := cache.SetCacheSize(int(p.AsUint())); err != nil {
+			return err
+		}
+	}
+	if p := params.Get(ParamStaticMappings); p != nil && p.AsString() != "" {
+		mappings, err := ParseStaticMappings(p.AsString())
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", ParamStaticMappings, err)
+		}
+		cache.SetStaticMappings(mappings)
+	}
+	if p := params.Get(ParamBackend); p != nil && p.AsString() != BackendFiles {
+		if err := cache.SetBackend(p.AsString()); err != nil {
+			return err
+		}
+	}
+	if p := params.Get(ParamGroupLoading); p != nil && p.AsString() != GroupLoadingEager {
+		if err := cache.SetGroupLoading(p.AsString()); err != nil {
+			return err
+		}
+	}
+	if p := params.Get(ParamNameSource); p != nil && p.AsString() != NameSourceLogin {
+		if err := cache.SetNameSource(p.AsString()); err != nil {
+			return err
+		}
+	}
+
+	return cache.SetPaths(passwdPath, groupPath)
 }
 
 func (k *UidGidResolver) Close() error {
@@ -95,12 +480,19 @@ func (k *UidGidResolver) Priority() int {
 }
 
 func (k *UidGidResolver) Instantiate(gadgetCtx operators.GadgetContext, gadgetInstance any, params *params.Params) (operators.OperatorInstance, error) {
+	if k.disabled {
+		return nil, nil
+	}
+
 	uidGidCache := GetUserGroupCache()
 
 	return &UidGidResolverInstance{
 		gadgetCtx:      gadgetCtx,
 		gadgetInstance: gadgetInstance,
 		uidGidCache:    uidGidCache,
+		containers:     newContainerCache(),
+		fallbackToID:   params.Get(ParamFallbackToID).AsBool(),
+		skipRoot:       params.Get(ParamSkipRoot).AsBool(),
 	}, nil
 }
 
@@ -110,6 +502,10 @@ type fieldAccPair struct {
 }
 
 func (k *UidGidResolver) InstantiateDataOperator(gadgetCtx operators.GadgetContext, paramValues api.ParamValues) (operators.DataOperatorInstance, error) {
+	if k.disabled {
+		return nil, nil
+	}
+
 	logger := gadgetCtx.Logger()
 	fieldsUid := make(map[datasource.DataSource][]fieldAccPair)
 	fieldsGid := make(map[datasource.DataSource][]fieldAccPair)
@@ -165,10 +561,30 @@ func (k *UidGidResolver) InstantiateDataOperator(gadgetCtx operators.GadgetConte
 		return nil, nil
 	}
 
+	fallbackToID := false
+	if val, ok := paramValues[ParamFallbackToID]; ok && val != "" {
+		var err error
+		fallbackToID, err = strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", ParamFallbackToID, err)
+		}
+	}
+
+	skipRoot := false
+	if val, ok := paramValues[ParamSkipRoot]; ok && val != "" {
+		var err error
+		skipRoot, err = strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", ParamSkipRoot, err)
+		}
+	}
+
 	return &UidGidResolverInstance{
-		uidGidCache: GetUserGroupCache(),
-		fieldsUid:   fieldsUid,
-		fieldsGid:   fieldsGid,
+		uidGidCache:  GetUserGroupCache(),
+		fieldsUid:    fieldsUid,
+		fieldsGid:    fieldsGid,
+		fallbackToID: fallbackToID,
+		skipRoot:     skipRoot,
 	}, nil
 }
 
@@ -178,6 +594,19 @@ type UidGidResolverInstance struct {
 	uidGidCache    UserGroupCache
 	fieldsUid      map[datasource.DataSource][]fieldAccPair
 	fieldsGid      map[datasource.DataSource][]fieldAccPair
+
+	// fallbackToID makes unresolved ids be reported as their decimal value
+	// instead of an empty string (or "uid:<id>" and "gid:<id>" for data
+	// sources)
+	fallbackToID bool
+
+	// skipRoot leaves the names of the uid and gid 0, as reported by the
+	// events, untouched
+	skipRoot bool
+
+	// containers is only used for events implementing
+	// ContainerResolverInterface
+	containers *containerCache
 }
 
 func (m *UidGidResolverInstance) Name() string {
@@ -193,17 +622,92 @@ func (m *UidGidResolverInstance) PostGadgetRun() error {
 	return nil
 }
 
+// containerFiles returns the passwd and group files of the container of ev,
+// or nil if it doesn't come from a container.
+func (m *UidGidResolverInstance) containerFiles(ev any) *containerFiles {
+	containerResolver, ok := ev.(ContainerResolverInterface)
+	if !ok || m.containers == nil {
+		return nil
+	}
+
+	containerID := containerResolver.GetContainerID()
+	if containerID == "" {
+		return nil
+	}
+
+	rootfs := ""
+	if rootfsResolver, ok := ev.(ContainerRootfsResolverInterface); ok {
+		rootfs = rootfsResolver.GetContainerRootfs()
+	}
+	return m.containers.get(containerID, containerResolver.GetContainerPid(), rootfs)
+}
+
 func (m *UidGidResolverInstance) enrich(ev any) {
-	uidResolver := ev.(UidResolverInterface)
-	if uidResolver != nil {
-		uid := uidResolver.GetUid()
-		uidResolver.SetUserName(m.uidGidCache.GetUsername(uid))
+	container := m.containerFiles(ev)
+
+	// setUser and setGroup resolve id, as reported by the event, and pass
+	// its name to set, unless it's root and skipRoot is set.
+	setUser := func(id uint32, set func(string)) {
+		if m.skipRoot && id == 0 {
+			return
+		}
+		if name, ok := container.username(id); ok {
+			set(name)
+			return
+		}
+		set(m.uidGidCache.GetUsername(id, m.fallbackToID))
+	}
+	setGroup := func(id uint32, set func(string)) {
+		if m.skipRoot && id == 0 {
+			return
+		}
+		if name, ok := container.groupname(id); ok {
+			set(name)
+			return
+		}
+		set(m.uidGidCache.GetGroupname(id, m.fallbackToID))
+	}
+
+	if uidResolver, ok := ev.(UidResolverInterface); ok {
+		setUser(uidResolver.GetUid(), uidResolver.SetUserName)
+	}
+
+	if gidResolver, ok := ev.(GidResolverInterface); ok {
+		setGroup(gidResolver.GetGid(), gidResolver.SetGroupName)
+	}
+
+	if realUidResolver, ok := ev.(RealUidResolverInterface); ok {
+		setUser(realUidResolver.GetRealUid(), realUidResolver.SetRealUserName)
 	}
 
-	gidResolver := ev.(GidResolverInterface)
-	if gidResolver != nil {
-		gid := gidResolver.GetGid()
-		gidResolver.SetGroupName(m.uidGidCache.GetGroupname(gid))
+	if effectiveUidResolver, ok := ev.(EffectiveUidResolverInterface); ok {
+		setUser(effectiveUidResolver.GetEffectiveUid(), effectiveUidResolver.SetEffectiveUserName)
+	}
+
+	if realGidResolver, ok := ev.(RealGidResolverInterface); ok {
+		setGroup(realGidResolver.GetRealGid(), realGidResolver.SetRealGroupName)
+	}
+
+	if effectiveGidResolver, ok := ev.(EffectiveGidResolverInterface); ok {
+		setGroup(effectiveGidResolver.GetEffectiveGid(), effectiveGidResolver.SetEffectiveGroupName)
+	}
+
+	if groupsResolver, ok := ev.(SupplementaryGroupsResolverInterface); ok {
+		if uid := groupsResolver.GetUid(); !m.skipRoot || uid != 0 {
+			if groups, ok := container.groupsForUser(uid); ok {
+				groupsResolver.SetSupplementaryGroups(groups)
+			} else {
+				groupsResolver.SetSupplementaryGroups(m.uidGidCache.GetGroupsForUser(uid))
+			}
+		}
+	}
+
+	if list, ok := ev.(ResolvableList); ok {
+		for _, elem := range list.ResolvableElements() {
+			if elem != nil {
+				m.enrich(elem)
+			}
+		}
 	}
 }
 
@@ -215,7 +719,10 @@ func (m *UidGidResolverInstance) PreStart(gadgetCtx operators.GadgetContext) err
 				if err != nil {
 					return err
 				}
-				username := m.uidGidCache.GetUsername(uid)
+				if m.skipRoot && uid == 0 {
+					return nil
+				}
+				username := m.uidGidCache.GetUsername(uid, m.fallbackToID)
 				if username == "" {
 					username = fmt.Sprintf("uid:%d", uid)
 				}
@@ -232,7 +739,10 @@ func (m *UidGidResolverInstance) PreStart(gadgetCtx operators.GadgetContext) err
 				if err != nil {
 					return err
 				}
-				groupname := m.uidGidCache.GetGroupname(gid)
+				if m.skipRoot && gid == 0 {
+					return nil
+				}
+				groupname := m.uidGidCache.GetGroupname(gid, m.fallbackToID)
 				if groupname == "" {
 					groupname = fmt.Sprintf("gid:%d", gid)
 				}
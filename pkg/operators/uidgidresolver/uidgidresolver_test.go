@@ -0,0 +1,824 @@
+// Copyright 2024 The Inspektor Gadget authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uidgidresolver
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/inspektor-gadget/inspektor-gadget/pkg/gadgets"
+)
+
+// fakeGadgetDesc only implements EventPrototype, calling any other method
+// panics.
+type fakeGadgetDesc struct {
+	gadgets.GadgetDesc
+	prototype any
+}
+
+func (f *fakeGadgetDesc) EventPrototype() any {
+	return f.prototype
+}
+
+// valueEvent has its methods on the value type
+type valueEvent struct {
+	uid, gid uint32
+}
+
+func (e valueEvent) GetUid() uint32      { return e.uid }
+func (e valueEvent) SetUserName(string)  {}
+func (e valueEvent) GetGid() uint32      { return e.gid }
+func (e valueEvent) SetGroupName(string) {}
+
+// pointerEvent has its methods on the pointer type
+type pointerEvent struct {
+	uid, gid uint32
+	user     string
+	group    string
+}
+
+func (e *pointerEvent) GetUid() uint32           { return e.uid }
+func (e *pointerEvent) SetUserName(name string)  { e.user = name }
+func (e *pointerEvent) GetGid() uint32           { return e.gid }
+func (e *pointerEvent) SetGroupName(name string) { e.group = name }
+
+type unrelatedEvent struct{}
+
+// uidOnlyEvent only implements UidResolverInterface
+type uidOnlyEvent struct {
+	uid  uint32
+	user string
+}
+
+func (e *uidOnlyEvent) GetUid() uint32          { return e.uid }
+func (e *uidOnlyEvent) SetUserName(name string) { e.user = name }
+
+// gidOnlyEvent only implements GidResolverInterface
+type gidOnlyEvent struct {
+	gid   uint32
+	group string
+}
+
+func (e *gidOnlyEvent) GetGid() uint32           { return e.gid }
+func (e *gidOnlyEvent) SetGroupName(name string) { e.group = name }
+
+// effectiveUidOnlyEvent only implements EffectiveUidResolverInterface
+type effectiveUidOnlyEvent struct {
+	euid  uint32
+	euser string
+}
+
+func (e *effectiveUidOnlyEvent) GetEffectiveUid() uint32          { return e.euid }
+func (e *effectiveUidOnlyEvent) SetEffectiveUserName(name string) { e.euser = name }
+
+// credentialsEvent implements both UidResolverInterface and the whole
+// ExtendedUidResolverInterface
+type credentialsEvent struct {
+	uidOnlyEvent
+	ruid, euid, rgid, egid       uint32
+	ruser, euser, rgroup, egroup string
+}
+
+func (e *credentialsEvent) GetRealUid() uint32                { return e.ruid }
+func (e *credentialsEvent) SetRealUserName(name string)       { e.ruser = name }
+func (e *credentialsEvent) GetEffectiveUid() uint32           { return e.euid }
+func (e *credentialsEvent) SetEffectiveUserName(name string)  { e.euser = name }
+func (e *credentialsEvent) GetRealGid() uint32                { return e.rgid }
+func (e *credentialsEvent) SetRealGroupName(name string)      { e.rgroup = name }
+func (e *credentialsEvent) GetEffectiveGid() uint32           { return e.egid }
+func (e *credentialsEvent) SetEffectiveGroupName(name string) { e.egroup = name }
+
+// batchEvent holds sub-events through ResolvableList
+type batchEvent struct {
+	uidOnlyEvent
+	events []*pointerEvent
+}
+
+func (e *batchEvent) ResolvableElements() []any {
+	elems := make([]any, len(e.events))
+	for i, ev := range e.events {
+		elems[i] = ev
+	}
+	return elems
+}
+
+// containerEvent comes from the container whose root filesystem is rootfs
+type containerEvent struct {
+	credentialsEvent
+	containerID string
+	rootfs      string
+	groups      []string
+}
+
+func (e *containerEvent) GetContainerID() string            { return e.containerID }
+func (e *containerEvent) GetContainerPid() uint32           { return 0 }
+func (e *containerEvent) GetContainerRootfs() string        { return e.rootfs }
+func (e *containerEvent) SetSupplementaryGroups(g []string) { e.groups = g }
+
+type fakeUserGroupCache struct{}
+
+func (fakeUserGroupCache) Start() error { return nil }
+func (fakeUserGroupCache) Stop()        {}
+
+func (fakeUserGroupCache) GetUsername(uid uint32, fallbackToID bool) string {
+	return fmt.Sprintf("user%d", uid)
+}
+
+func (fakeUserGroupCache) GetGroupname(gid uint32, fallbackToID bool) string {
+	return fmt.Sprintf("group%d", gid)
+}
+
+func (fakeUserGroupCache) GetGroupsForUser(uint32) []string { return nil }
+
+func (fakeUserGroupCache) GetUidByName(string) (uint32, bool) { return 0, false }
+func (fakeUserGroupCache) GetGidByName(string) (uint32, bool) { return 0, false }
+
+func (fakeUserGroupCache) Dump() (map[uint32]string, map[uint32]string) { return nil, nil }
+func (fakeUserGroupCache) Reload() error                                { return nil }
+
+func TestCanOperateOn(t *testing.T) {
+	tests := map[string]struct {
+		prototype any
+		expected  bool
+	}{
+		"value_methods_value_prototype":     {prototype: valueEvent{}, expected: true},
+		"value_methods_pointer_prototype":   {prototype: &valueEvent{}, expected: true},
+		"pointer_methods_value_prototype":   {prototype: pointerEvent{}, expected: true},
+		"pointer_methods_pointer_prototype": {prototype: &pointerEvent{}, expected: true},
+		"effective_uid_only":                {prototype: effectiveUidOnlyEvent{}, expected: true},
+		"resolvable_list":                   {prototype: batchEvent{}, expected: true},
+		"unrelated_value":                   {prototype: unrelatedEvent{}, expected: false},
+		"unrelated_pointer":                 {prototype: &unrelatedEvent{}, expected: false},
+		"nil":                               {prototype: nil, expected: false},
+	}
+
+	op := &UidGidResolver{}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, op.CanOperateOn(&fakeGadgetDesc{prototype: test.prototype}))
+		})
+	}
+}
+
+func TestImplements(t *testing.T) {
+	require.True(t, implements[UidResolverInterface](pointerEvent{}))
+	require.True(t, implements[GidResolverInterface](pointerEvent{}))
+	require.True(t, implements[GidResolverInterface](valueEvent{}))
+	require.False(t, implements[SupplementaryGroupsResolverInterface](valueEvent{}))
+	require.False(t, implements[UidResolverInterface](unrelatedEvent{}))
+}
+
+func TestEnrichPartialEvents(t *testing.T) {
+	m := &UidGidResolverInstance{uidGidCache: fakeUserGroupCache{}}
+
+	uidEv := &uidOnlyEvent{uid: 1000}
+	require.NotPanics(t, func() { m.EnrichEvent(uidEv) })
+	require.Equal(t, "user1000", uidEv.user)
+
+	gidEv := &gidOnlyEvent{gid: 100}
+	require.NotPanics(t, func() { m.EnrichEvent(gidEv) })
+	require.Equal(t, "group100", gidEv.group)
+
+	require.NotPanics(t, func() { m.EnrichEvent(&unrelatedEvent{}) })
+}
+
+func TestEnrichExtendedEvents(t *testing.T) {
+	m := &UidGidResolverInstance{uidGidCache: fakeUserGroupCache{}}
+
+	euidEv := &effectiveUidOnlyEvent{euid: 0}
+	require.NotPanics(t, func() { m.EnrichEvent(euidEv) })
+	require.Equal(t, "user0", euidEv.euser)
+
+	credsEv := &credentialsEvent{
+		uidOnlyEvent: uidOnlyEvent{uid: 1000},
+		ruid:         1000,
+		euid:         0,
+		rgid:         100,
+		egid:         0,
+	}
+	m.EnrichEvent(credsEv)
+	require.Equal(t, "user1000", credsEv.user)
+	require.Equal(t, "user1000", credsEv.ruser)
+	require.Equal(t, "user0", credsEv.euser)
+	require.Equal(t, "group100", credsEv.rgroup)
+	require.Equal(t, "group0", credsEv.egroup)
+
+	var _ ExtendedUidResolverInterface = credsEv
+}
+
+func TestEnrichResolvableList(t *testing.T) {
+	m := &UidGidResolverInstance{uidGidCache: fakeUserGroupCache{}}
+
+	ev := &batchEvent{
+		uidOnlyEvent: uidOnlyEvent{uid: 1},
+		events: []*pointerEvent{
+			{uid: 1000, gid: 100},
+			{uid: 1001, gid: 101},
+		},
+	}
+	require.NotPanics(t, func() { m.EnrichEvent(ev) })
+	require.Equal(t, "user1", ev.user)
+	require.Equal(t, "user1000", ev.events[0].user)
+	require.Equal(t, "group100", ev.events[0].group)
+	require.Equal(t, "user1001", ev.events[1].user)
+	require.Equal(t, "group101", ev.events[1].group)
+
+	require.NotPanics(t, func() { m.EnrichEvent(&batchEvent{}) })
+}
+
+func TestSkipRoot(t *testing.T) {
+	for _, skipRoot := range []bool{false, true} {
+		m := &UidGidResolverInstance{uidGidCache: fakeUserGroupCache{}, skipRoot: skipRoot}
+
+		rootEv := &pointerEvent{user: "unchanged", group: "unchanged"}
+		m.EnrichEvent(rootEv)
+
+		credsEv := &credentialsEvent{ruid: 1000, euid: 0, rgid: 100, egid: 0}
+		m.EnrichEvent(credsEv)
+
+		if skipRoot {
+			require.Equal(t, "unchanged", rootEv.user)
+			require.Equal(t, "unchanged", rootEv.group)
+			require.Empty(t, credsEv.euser)
+			require.Empty(t, credsEv.egroup)
+		} else {
+			require.Equal(t, "user0", rootEv.user)
+			require.Equal(t, "group0", rootEv.group)
+			require.Equal(t, "user0", credsEv.euser)
+			require.Equal(t, "group0", credsEv.egroup)
+		}
+
+		// Other ids are always resolved
+		require.Equal(t, "user1000", credsEv.ruser)
+		require.Equal(t, "group100", credsEv.rgroup)
+	}
+}
+
+func TestResolutionDisabled(t *testing.T) {
+	k := &UidGidResolver{}
+	globalParams := k.GlobalParamDescs().ToParams()
+	require.NoError(t, globalParams.Set(ParamResolution, "false"))
+	require.NoError(t, k.Init(globalParams))
+
+	inst, err := k.Instantiate(nil, nil, nil)
+	require.NoError(t, err)
+	require.Nil(t, inst)
+
+	dataInst, err := k.InstantiateDataOperator(nil, nil)
+	require.NoError(t, err)
+	require.Nil(t, dataInst)
+}
+
+func TestContainerFiles(t *testing.T) {
+	rootfs := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(rootfs, "etc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "etc", "passwd"),
+		[]byte("root:x:0:0::/root:/bin/sh\napp:x:1000:1000::/app:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "etc", "group"),
+		[]byte("root:x:0:\napp:x:1000:\nwheel:x:10:app\n"), 0o644))
+
+	m := &UidGidResolverInstance{uidGidCache: fakeUserGroupCache{}, containers: newContainerCache()}
+
+	tests := []struct {
+		name           string
+		containerID    string
+		rootfs         string
+		expectedUser   string
+		expectedGroup  string
+		expectedGroups []string
+	}{
+		{
+			name:           "container",
+			containerID:    "c1",
+			rootfs:         rootfs,
+			expectedUser:   "app",
+			expectedGroup:  "app",
+			expectedGroups: []string{"wheel"},
+		},
+		{
+			name:          "host",
+			rootfs:        rootfs,
+			expectedUser:  "user1000",
+			expectedGroup: "group1000",
+		},
+		{
+			name:          "container_without_files",
+			containerID:   "c2",
+			rootfs:        t.TempDir(),
+			expectedUser:  "user1000",
+			expectedGroup: "group1000",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ev := &containerEvent{
+				credentialsEvent: credentialsEvent{uidOnlyEvent: uidOnlyEvent{uid: 1000}, rgid: 1000, euid: 1001},
+				containerID:      test.containerID,
+				rootfs:           test.rootfs,
+			}
+			m.EnrichEvent(ev)
+			require.Equal(t, test.expectedUser, ev.user)
+			require.Equal(t, test.expectedGroup, ev.rgroup)
+			require.Equal(t, test.expectedGroups, ev.groups)
+
+			// Ids the container doesn't know are resolved on the host
+			require.Equal(t, "user1001", ev.euser)
+		})
+	}
+
+	// The files are cached per container
+	require.NoError(t, os.Remove(filepath.Join(rootfs, "etc", "passwd")))
+	ev := &containerEvent{credentialsEvent: credentialsEvent{uidOnlyEvent: uidOnlyEvent{uid: 1000}}, containerID: "c1", rootfs: rootfs}
+	m.EnrichEvent(ev)
+	require.Equal(t, "app", ev.user)
+}
+
+func TestContainerFilesUnsafe(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "passwd"),
+		[]byte("host:x:1000:1000::/:/bin/sh\n"), 0o644))
+
+	rootfs := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(rootfs, "etc"), 0o755))
+	// The symlink is resolved in the rootfs, where its target doesn't exist
+	require.NoError(t, os.Symlink(filepath.Join(outside, "passwd"), filepath.Join(rootfs, "etc", "passwd")))
+	// Opening a FIFO would block until something writes to it
+	require.NoError(t, unix.Mkfifo(filepath.Join(rootfs, "etc", "group"), 0o644))
+
+	files := readContainerFiles(rootfs)
+	require.Nil(t, files.users)
+	require.Nil(t, files.groups)
+}
+
+func TestContainerCachePrune(t *testing.T) {
+	c := newContainerCache()
+	c.entries["running"] = &containerFiles{pid: uint32(os.Getpid()), expires: time.Now().Add(time.Hour)}
+	c.entries["stopped"] = &containerFiles{pid: math.MaxUint32, expires: time.Now().Add(time.Hour)}
+	c.entries["expired"] = &containerFiles{expires: time.Now().Add(-time.Second)}
+
+	c.lastPrune = time.Now().Add(-2 * containerFilesTTL)
+	c.pruneLocked(time.Now())
+	require.Contains(t, c.entries, "running")
+	require.NotContains(t, c.entries, "stopped")
+	require.NotContains(t, c.entries, "expired")
+}
+
+func TestBackend(t *testing.T) {
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte("alice:x:1000:\n"), 0o644))
+
+	cache := &userGroupCache{passwdPath: passwdPath, groupPath: groupPath, backend: BackendFiles}
+	require.Error(t, cache.SetBackend("ldap"))
+	require.NoError(t, cache.SetBackend(BackendFilesNSS))
+
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	require.Error(t, cache.SetBackend(BackendFiles), "backend can't change while in use")
+
+	require.Equal(t, "alice", cache.GetUsername(1000, false))
+	require.Equal(t, "alice", cache.GetGroupname(1000, false))
+
+	// root isn't in the files, it's only resolved through the name service
+	// switch
+	expected := ""
+	if nssAvailable {
+		expected = "root"
+	}
+	require.Equal(t, expected, cache.GetUsername(0, false))
+	require.Equal(t, expected, cache.GetGroupname(0, false))
+}
+
+func TestGetIDByName(t *testing.T) {
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte(
+		"alice:x:1000:1000::/home/alice:/bin/sh\n"+
+			"bob:x:1001:1001::/home/bob:/bin/sh\n"+
+			"alice:x:2000:2000::/home/alice2:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte(
+		"users:x:100:alice,bob\n"+
+			"users:x:200:\n"), 0o644))
+
+	cache := &userGroupCache{passwdPath: passwdPath, groupPath: groupPath, backend: BackendFiles}
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	uid, ok := cache.GetUidByName("bob")
+	require.True(t, ok)
+	require.Equal(t, uint32(1001), uid)
+
+	// The first entry wins
+	uid, ok = cache.GetUidByName("alice")
+	require.True(t, ok)
+	require.Equal(t, uint32(1000), uid)
+
+	gid, ok := cache.GetGidByName("users")
+	require.True(t, ok)
+	require.Equal(t, uint32(100), gid)
+
+	_, ok = cache.GetUidByName("users")
+	require.False(t, ok)
+	_, ok = cache.GetGidByName("alice")
+	require.False(t, ok)
+}
+
+func TestStaticMappings(t *testing.T) {
+	mappings, err := ParseStaticMappings(" 1000=carol, 42=answer")
+	require.NoError(t, err)
+	require.Equal(t, map[uint32]string{1000: "carol", 42: "answer"}, mappings)
+
+	mappings, err = ParseStaticMappings("")
+	require.NoError(t, err)
+	require.Nil(t, mappings)
+
+	for _, invalid := range []string{"1000", "1000=", "alice=1000", "1=a,1=b"} {
+		_, err := ParseStaticMappings(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte("alice:x:1000:\n"), 0o644))
+
+	cache := &userGroupCache{passwdPath: passwdPath, groupPath: groupPath, backend: BackendFiles}
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	cache.SetStaticMappings(map[uint32]string{1000: "carol", 42: "answer"})
+
+	// The static mappings take precedence over the files
+	require.Equal(t, "carol", cache.GetUsername(1000, false))
+	require.Equal(t, "carol", cache.GetGroupname(1000, false))
+	require.Equal(t, "answer", cache.GetUsername(42, false))
+	require.Equal(t, "answer", cache.GetGroupname(42, false))
+
+	cache.SetStaticMappings(nil)
+	require.Equal(t, "alice", cache.GetUsername(1000, false))
+	require.Equal(t, "", cache.GetUsername(42, false))
+}
+
+func TestNameSource(t *testing.T) {
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte(
+		"alice:x:1000:1000:Alice Smith,Room 42,,:/home/alice:/bin/sh\n"+
+			"bob:x:1001:1001::/home/bob:/bin/sh\n"+
+			"carol:x:1002:1002:,,,:/home/carol:/bin/sh\n"+
+			"dave:x:1003:1003: Dave Jones,,,\n"+
+			"eve:x:1004:1004\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte("users:x:100:alice\n"), 0o644))
+
+	cache := &userGroupCache{passwdPath: passwdPath, groupPath: groupPath, backend: BackendFiles, nameSource: NameSourceLogin}
+	require.Error(t, cache.SetNameSource("nickname"))
+	require.NoError(t, cache.SetNameSource(NameSourceGecos))
+
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	require.Error(t, cache.SetNameSource(NameSourceLogin), "name source can't change while in use")
+
+	require.Equal(t, "Alice Smith", cache.GetUsername(1000, false))
+	// Empty GECOS fields fall back to the login name
+	require.Equal(t, "bob", cache.GetUsername(1001, false))
+	require.Equal(t, "carol", cache.GetUsername(1002, false))
+	require.Equal(t, "Dave Jones", cache.GetUsername(1003, false))
+	require.Equal(t, "eve", cache.GetUsername(1004, false))
+	require.Equal(t, "", cache.GetUsername(2000, false))
+	require.Equal(t, "2000", cache.GetUsername(2000, true))
+
+	// Names are still looked up by login name
+	require.Equal(t, []string{"users"}, cache.GetGroupsForUser(1000))
+	uid, ok := cache.GetUidByName("alice")
+	require.True(t, ok)
+	require.Equal(t, uint32(1000), uid)
+	_, ok = cache.GetUidByName("Alice Smith")
+	require.False(t, ok)
+}
+
+func TestDump(t *testing.T) {
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte(
+		"root:x:0:0:root:/root:/bin/sh\n"+
+			"alice:x:1000:1000:Alice Smith:/home/alice:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte(
+		"root:x:0:\n"+
+			"users:x:100:alice\n"), 0o644))
+
+	cache := &userGroupCache{passwdPath: passwdPath, groupPath: groupPath, backend: BackendFiles, nameSource: NameSourceLogin}
+	users, groups := cache.Dump()
+	require.Empty(t, users, "nothing is known before the cache starts")
+	require.Empty(t, groups)
+
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	users, groups = cache.Dump()
+	require.Equal(t, map[uint32]string{0: "root", 1000: "alice"}, users)
+	require.Equal(t, map[uint32]string{0: "root", 100: "users"}, groups)
+
+	// The dump is a copy
+	users[1000] = "mallory"
+	require.Equal(t, "alice", cache.GetUsername(1000, false))
+
+	cache.SetStaticMappings(map[uint32]string{1000: "carol", 42: "answer"})
+	users, groups = cache.Dump()
+	require.Equal(t, map[uint32]string{0: "root", 42: "answer", 1000: "carol"}, users)
+	require.Equal(t, map[uint32]string{0: "root", 42: "answer", 100: "users", 1000: "carol"}, groups)
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte("users:x:100:alice\n"), 0o644))
+
+	cache := &userGroupCache{passwdPath: passwdPath, groupPath: groupPath, backend: BackendFiles}
+	require.Error(t, cache.Reload(), "the cache isn't in use")
+
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+	// Only rely on Reload
+	cache.watcher.Close()
+
+	require.NoError(t, os.WriteFile(passwdPath, []byte(
+		"alice:x:1000:1000::/home/alice:/bin/sh\n"+
+			"bob:x:1001:1001::/home/bob:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte("users:x:100:alice,bob\n"), 0o644))
+	require.Equal(t, "", cache.GetUsername(1001, false))
+
+	require.NoError(t, cache.Reload())
+	require.Equal(t, "bob", cache.GetUsername(1001, false))
+	uid, ok := cache.GetUidByName("bob")
+	require.True(t, ok)
+	require.Equal(t, uint32(1001), uid)
+	require.Equal(t, []string{"users"}, cache.GetGroupsForUser(1001))
+
+	// The names of a file that can't be read are kept
+	require.NoError(t, os.Remove(groupPath))
+	require.ErrorContains(t, cache.Reload(), groupPath)
+	require.Equal(t, "bob", cache.GetUsername(1001, false))
+	require.Equal(t, "users", cache.GetGroupname(100, false))
+}
+
+func TestGroupLoading(t *testing.T) {
+	dir := t.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwdPath, []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0o644))
+	require.NoError(t, os.WriteFile(groupPath, []byte(
+		"alice:x:1000:\n"+
+			"users:x:100:bob, alice\n"), 0o644))
+
+	cache := &userGroupCache{
+		passwdPath:   passwdPath,
+		groupPath:    groupPath,
+		backend:      BackendFiles,
+		groupLoading: GroupLoadingEager,
+		nssCacheSize: DefaultCacheSize,
+	}
+	require.Error(t, cache.SetGroupLoading("sometimes"))
+	require.NoError(t, cache.SetGroupLoading(GroupLoadingLazy))
+
+	require.NoError(t, cache.Start())
+	defer cache.Stop()
+
+	require.Error(t, cache.SetGroupLoading(GroupLoadingEager), "group loading can't change while in use")
+
+	// Nothing is read from the group file until the first lookup
+	require.Zero(t, cache.lazyGroups.len())
+
+	require.Equal(t, "users", cache.GetGroupname(100, false))
+	require.Equal(t, "alice", cache.GetGroupname(1000, false))
+	require.Equal(t, "", cache.GetGroupname(2000, false))
+	require.Equal(t, 3, cache.lazyGroups.len(), "the unknown gid is cached too")
+	_, groups := cache.Dump()
+	require.Equal(t, map[uint32]string{100: "users", 1000: "alice"}, groups)
+
+	// Unknown gids don't rescan the group file for each event
+	scans := 0
+	lookup := func(gid uint32) (string, bool) {
+		scans++
+		return cache.lookupGroupFile(gid)
+	}
+	for i := 0; i < 3; i++ {
+		_, ok := cache.lazyGroups.resolve(3000, lookup)
+		require.False(t, ok)
+	}
+	require.Equal(t, 1, scans)
+
+	require.Equal(t, []string{"users"}, cache.GetGroupsForUser(1000))
+	gid, ok := cache.GetGidByName("users")
+	require.True(t, ok)
+	require.Equal(t, uint32(100), gid)
+	_, ok = cache.GetGidByName("bob")
+	require.False(t, ok)
+}
+
+// BenchmarkStart compares the startup cost of both group loading modes with a
+// large group file
+func BenchmarkStart(b *testing.B) {
+	dir := b.TempDir()
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	require.NoError(b, os.WriteFile(passwdPath, []byte("alice:x:1000:1000::/home/alice:/bin/sh\n"), 0o644))
+
+	var groups strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&groups, "group%d:x:%d:alice,bob\n", i, i)
+	}
+	require.NoError(b, os.WriteFile(groupPath, []byte(groups.String()), 0o644))
+
+	for _, mode := range []string{GroupLoadingEager, GroupLoadingLazy} {
+		b.Run(mode, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				cache := &userGroupCache{
+					passwdPath:   passwdPath,
+					groupPath:    groupPath,
+					backend:      BackendFiles,
+					groupLoading: mode,
+					nssCacheSize: DefaultCacheSize,
+				}
+				if err := cache.Start(); err != nil {
+					b.Fatal(err)
+				}
+				cache.Stop()
+			}
+		})
+	}
+}
+
+func TestNSSCache(t *testing.T) {
+	lookups := 0
+	lookup := func(id uint32) (string, bool) {
+		lookups++
+		if id == 42 {
+			return "", false
+		}
+		return fmt.Sprintf("user%d", id), true
+	}
+
+	c := newNSSCache(2)
+	for _, id := range []uint32{1, 2, 1, 3} {
+		name, ok := c.resolve(id, lookup)
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprintf("user%d", id), name)
+	}
+	require.Equal(t, 3, lookups)
+	require.Equal(t, 2, c.len())
+
+	// 2 was the least recently used, so it was evicted when 3 was added
+	_, ok := c.get(2)
+	require.False(t, ok)
+	_, ok = c.get(1)
+	require.True(t, ok)
+
+	// Failed lookups are cached until they expire
+	for i := 0; i < 3; i++ {
+		_, ok = c.resolve(42, lookup)
+		require.False(t, ok)
+	}
+	require.Equal(t, 4, lookups)
+	_, ok = c.get(42)
+	require.False(t, ok)
+
+	c.mu.Lock()
+	c.entries[42].Value.(*nssCacheEntry).expires = time.Now().Add(-time.Second)
+	c.mu.Unlock()
+	_, ok = c.resolve(42, lookup)
+	require.False(t, ok)
+	require.Equal(t, 5, lookups)
+
+	// A nil cache doesn't cache anything
+	var nilCache *nssCache
+	name, ok := nilCache.resolve(1, lookup)
+	require.True(t, ok)
+	require.Equal(t, "user1", name)
+	require.Equal(t, 6, lookups)
+}
+
+// BenchmarkNSSCacheChurn measures the lookup latency when the ids looked up
+// don't fit in the cache, so that entries are constantly evicted
+func BenchmarkNSSCacheChurn(b *testing.B) {
+	lookup := func(id uint32) (string, bool) {
+		return strconv.FormatUint(uint64(id), 10), true
+	}
+
+	for _, ids := range []uint32{512, 4096} {
+		b.Run(fmt.Sprintf("ids=%d", ids), func(b *testing.B) {
+			c := newNSSCache(1024)
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					c.resolve(uint32(rng.Intn(int(ids))), lookup)
+				}
+			})
+		})
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	type testDefinition struct {
+		input    string
+		expected map[uint32]string
+	}
+
+	tests := map[string]testDefinition{
+		"blank_and_comment_lines": {
+			input:    "\n   \n# comment\n  # indented comment\nroot:x:0:0:root:/root:/bin/bash\n",
+			expected: map[uint32]string{0: "root"},
+		},
+		"trailing_whitespace_and_crlf": {
+			input:    "root:x:0:0:root:/root:/bin/bash   \r\nalice:x:1000:1000::/home/alice:/bin/sh\t\n",
+			expected: map[uint32]string{0: "root", 1000: "alice"},
+		},
+		"whitespace_around_fields": {
+			input:    " alice :x: 1000 :1000::/home/alice:/bin/sh\n",
+			expected: map[uint32]string{1000: "alice"},
+		},
+		"extra_fields": {
+			input:    "alice:x:1000:1000::/home/alice:/bin/sh:extra:fields\n",
+			expected: map[uint32]string{1000: "alice"},
+		},
+		"quotes_and_colons_in_gecos": {
+			input:    "alice:x:1000:1000:\"Alice, Room 42\",,:/home/alice:/bin/sh\n",
+			expected: map[uint32]string{1000: "alice"},
+		},
+		"malformed_lines_are_skipped": {
+			input: "alice:x:1000:1000::/home/alice:/bin/sh\n" +
+				"garbage\n" +
+				"bob:x\n" +
+				"carol:x:notanumber:100::/:/bin/sh\n" +
+				"dave:x:99999999999:100::/:/bin/sh\n" +
+				":x:1001:100::/:/bin/sh\n" +
+				"eve mallory:x:1002:100::/:/bin/sh\n" +
+				"frank:x:1003:100::/home/frank:/bin/sh\n",
+			expected: map[uint32]string{1000: "alice", 1003: "frank"},
+		},
+		"nis_compat_entries": {
+			input:    "alice:x:1000:1000::/home/alice:/bin/sh\n+@admins::::::\n-bob\n+\n",
+			expected: map[uint32]string{1000: "alice"},
+		},
+		"line_too_long": {
+			input:    "alice:x:1000:1000:" + strings.Repeat("a", maxLineLength) + ":/home/alice:/bin/sh\nbob:x:1001:100::/:/bin/sh\n",
+			expected: map[uint32]string{1001: "bob"},
+		},
+		"no_final_newline": {
+			input:    "alice:x:1000:1000::/home/alice:/bin/sh",
+			expected: map[uint32]string{1000: "alice"},
+		},
+		"empty": {
+			input:    "",
+			expected: map[uint32]string{},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			entries, err := parseEntries(strings.NewReader(test.input))
+			require.NoError(t, err)
+
+			got := map[uint32]string{}
+			for _, e := range entries {
+				got[e.id] = e.name
+			}
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
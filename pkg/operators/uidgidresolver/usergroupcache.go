@@ -16,13 +16,19 @@ package uidgidresolver
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/fsnotify/fsnotify"
 	log "github.com/sirupsen/logrus"
@@ -36,14 +42,97 @@ type UserGroupCache interface {
 	Start() error
 	Stop()
 
-	GetUsername(uint32) string
-	GetGroupname(uint32) string
+	// GetUsername and GetGroupname return the name for the given id. If it
+	// can't be resolved, they return the id as a decimal string if
+	// fallbackToID is set, or an empty string otherwise.
+	GetUsername(id uint32, fallbackToID bool) string
+	GetGroupname(id uint32, fallbackToID bool) string
+
+	// GetGroupsForUser returns the names of the groups listing the user as a
+	// member in the group file. The primary group isn't included unless
+	// it's listed there too.
+	GetGroupsForUser(uint32) []string
+
+	// GetUidByName and GetGidByName return the id of the given name
+	// according to the passwd and group files. If several entries have the
+	// same name, the first one in the file wins, as with the C library.
+	GetUidByName(name string) (uint32, bool)
+	GetGidByName(name string) (uint32, bool)
+
+	// Dump returns copies of the names the uids and gids currently known
+	// by the cache resolve to
+	Dump() (users map[uint32]string, groups map[uint32]string)
+
+	// Reload re-reads the passwd and group files
+	Reload() error
 }
 
 type userGroupCache struct {
 	userCache  cachedmap.CachedMap[uint32, string]
 	groupCache cachedmap.CachedMap[uint32, string]
 
+	// memberships maps user names to the names of the groups they are a
+	// member of. It's replaced as a whole on each reload of the group file.
+	memberships      map[string][]string
+	membershipsMutex sync.RWMutex
+
+	// uidsByName and gidsByName map the names of the passwd and group files
+	// to their ids, and fullNames maps the uids to the full names of the
+	// GECOS field. They're replaced as a whole on each reload of the file.
+	uidsByName     map[string]uint32
+	gidsByName     map[string]uint32
+	fullNames      map[uint32]string
+	idsByNameMutex sync.RWMutex
+
+	// staticMappings maps ids to the names they resolve to, both as uids
+	// and gids, regardless of the files and the name service switch
+	staticMappings      map[uint32]string
+	staticMappingsMutex sync.RWMutex
+
+	// passwdPath and groupPath are the files the cache is loaded from. They
+	// can only be changed while the cache isn't in use.
+	passwdPath string
+	groupPath  string
+
+	// backend is one of BackendFiles, BackendNSS and BackendFilesNSS. It can
+	// only be changed while the cache isn't in use.
+	backend string
+
+	// groupLoading is either GroupLoadingEager or GroupLoadingLazy. It can
+	// only be changed while the cache isn't in use. In lazy mode, groupCache,
+	// memberships and gidsByName stay empty: the group file is looked up on
+	// demand and the resolved names are kept in lazyGroups.
+	groupLoading string
+	lazyGroups   *nssCache
+
+	// nameSource is either NameSourceLogin or NameSourceGecos. It can only
+	// be changed while the cache isn't in use. The full names are only
+	// known for the users of the passwd file, the other ones are always
+	// resolved to their login name.
+	nameSource string
+
+	// nssCacheSize is the maximum number of names resolved through the name
+	// service switch that are kept, for users and groups each. 0 disables
+	// the caching. It's taken into account the next time the cache starts
+	// being used.
+	nssCacheSize int
+	nssUsers     *nssCache
+	nssGroups    *nssCache
+
+	// refreshInterval is the interval at which the files are re-read, in
+	// addition to the reloads triggered by the watcher. 0 disables it.
+	refreshInterval time.Duration
+	refreshStop     chan struct{}
+	refreshFinished chan struct{}
+
+	// reloadMutex serializes the reloads done by the watcher and the periodic
+	// refresh
+	reloadMutex sync.Mutex
+
+	// metrics is nil unless metrics were enabled
+	metrics     atomic.Pointer[cacheMetrics]
+	metricsOnce sync.Once
+
 	loopFinished  chan struct{}
 	useCount      int
 	useCountMutex sync.Mutex
@@ -60,19 +149,238 @@ var (
 	fullPasswdPath    = filepath.Join(host.HostRoot, baseDirPath, passwdFileName)
 	fullGroupPath     = filepath.Join(host.HostRoot, baseDirPath, groupFileName)
 	GetUserGroupCache = sync.OnceValue(func() *userGroupCache {
-		return &userGroupCache{}
+		return &userGroupCache{
+			passwdPath:   fullPasswdPath,
+			groupPath:    fullGroupPath,
+			backend:      BackendFiles,
+			groupLoading: GroupLoadingEager,
+			nameSource:   NameSourceLogin,
+			nssCacheSize: DefaultCacheSize,
+		}
 	})
 )
 
+// SetPaths changes the passwd and group files the cache is loaded from. Empty
+// paths keep the current value. It fails if a file can't be read or if the
+// cache is already in use.
+func (cache *userGroupCache) SetPaths(passwdPath, groupPath string) error {
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	if passwdPath == "" {
+		passwdPath = cache.passwdPath
+	}
+	if groupPath == "" {
+		groupPath = cache.groupPath
+	}
+	if passwdPath == cache.passwdPath && groupPath == cache.groupPath {
+		return nil
+	}
+
+	if cache.useCount > 0 {
+		return errors.New("UserGroupCache: can't change paths while in use")
+	}
+
+	for _, path := range []string{passwdPath, groupPath} {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("UserGroupCache: open %q: %w", path, err)
+		}
+		f.Close()
+	}
+
+	cache.passwdPath = filepath.Clean(passwdPath)
+	cache.groupPath = filepath.Clean(groupPath)
+	return nil
+}
+
+// SetStaticMappings makes the given ids resolve to the given names, both as
+// uids and gids, taking precedence over the files and the name service switch.
+// It replaces the previous mappings, nil removes them.
+func (cache *userGroupCache) SetStaticMappings(mappings map[uint32]string) {
+	cache.staticMappingsMutex.Lock()
+	defer cache.staticMappingsMutex.Unlock()
+
+	cache.staticMappings = mappings
+}
+
+// staticName returns the name given to id by the static mappings, if any
+func (cache *userGroupCache) staticName(id uint32) (string, bool) {
+	cache.staticMappingsMutex.RLock()
+	defer cache.staticMappingsMutex.RUnlock()
+
+	name, ok := cache.staticMappings[id]
+	return name, ok
+}
+
+// ParseStaticMappings parses comma-separated id=name pairs, e.g.
+// "1000=alice,1001=bob". An empty string gives no mappings.
+func ParseStaticMappings(s string) (map[uint32]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	mappings := make(map[uint32]string)
+	for _, pair := range strings.Split(s, ",") {
+		idStr, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q isn't an id=name pair", pair)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("%q has an empty name", pair)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q has an invalid id: %w", pair, err)
+		}
+		if _, ok := mappings[uint32(id)]; ok {
+			return nil, fmt.Errorf("id %d is mapped more than once", id)
+		}
+		mappings[uint32(id)] = name
+	}
+	return mappings, nil
+}
+
+// SetBackend changes where the ids are looked up. It fails if the backend is
+// unknown or if the cache is already in use.
+func (cache *userGroupCache) SetBackend(backend string) error {
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	switch backend {
+	case BackendFiles, BackendNSS, BackendFilesNSS:
+	default:
+		return fmt.Errorf("UserGroupCache: backend is either %q, %q or %q, %q was given",
+			BackendFiles, BackendNSS, BackendFilesNSS, backend)
+	}
+	if backend == cache.backend {
+		return nil
+	}
+
+	if cache.useCount > 0 {
+		return errors.New("UserGroupCache: can't change backend while in use")
+	}
+	if backend != BackendFiles && !nssAvailable {
+		log.Warnf("UserGroupCache: built without cgo, ids won't be resolved through the name service switch")
+	}
+
+	cache.backend = backend
+	return nil
+}
+
+// SetGroupLoading changes when the group file is read. It fails if the mode is
+// unknown or if the cache is already in use.
+func (cache *userGroupCache) SetGroupLoading(mode string) error {
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	switch mode {
+	case GroupLoadingEager, GroupLoadingLazy:
+	default:
+		return fmt.Errorf("UserGroupCache: group loading is either %q or %q, %q was given",
+			GroupLoadingEager, GroupLoadingLazy, mode)
+	}
+	if mode == cache.groupLoading {
+		return nil
+	}
+
+	if cache.useCount > 0 {
+		return errors.New("UserGroupCache: can't change group loading while in use")
+	}
+
+	cache.groupLoading = mode
+	return nil
+}
+
+// SetNameSource changes what uids are resolved to. It fails if the source is
+// unknown or if the cache is already in use.
+func (cache *userGroupCache) SetNameSource(source string) error {
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	switch source {
+	case NameSourceLogin, NameSourceGecos:
+	default:
+		return fmt.Errorf("UserGroupCache: name source is either %q or %q, %q was given",
+			NameSourceLogin, NameSourceGecos, source)
+	}
+	if source == cache.nameSource {
+		return nil
+	}
+
+	if cache.useCount > 0 {
+		return errors.New("UserGroupCache: can't change name source while in use")
+	}
+
+	cache.nameSource = source
+	return nil
+}
+
+// lazyGroupLoading returns whether the group file is looked up on demand
+func (cache *userGroupCache) lazyGroupLoading() bool {
+	return cache.groupLoading == GroupLoadingLazy
+}
+
+// SetCacheSize sets the maximum number of names resolved through the name
+// service switch that are cached, for users and groups each. 0 disables the
+// caching. It's taken into account the next time the cache starts being used.
+func (cache *userGroupCache) SetCacheSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("UserGroupCache: cache size must not be negative, %d was given", size)
+	}
+
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	cache.nssCacheSize = size
+	return nil
+}
+
+// SetRefreshInterval sets the interval at which the files are re-read. 0
+// disables the periodic refresh. It's taken into account the next time the
+// cache starts being used.
+func (cache *userGroupCache) SetRefreshInterval(interval time.Duration) {
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	cache.refreshInterval = interval
+}
+
+// EnableMetrics starts counting the lookups and reloads of the cache. Calling
+// it more than once has no effect.
+func (cache *userGroupCache) EnableMetrics() error {
+	var err error
+	cache.metricsOnce.Do(func() {
+		var m *cacheMetrics
+		m, err = newCacheMetrics()
+		if err == nil {
+			cache.metrics.Store(m)
+		}
+	})
+	return err
+}
+
+// kindOf returns the kind of ids the given file holds
+func (cache *userGroupCache) kindOf(path string) string {
+	if path == cache.groupPath {
+		return kindGid
+	}
+	return kindUid
+}
+
 func (cache *userGroupCache) Start() error {
 	cache.useCountMutex.Lock()
 	defer cache.useCountMutex.Unlock()
 
 	// No uses before us, we are the first one
 	if cache.useCount == 0 {
-		watcher, err := fsnotify.NewWatcher()
+		// Start watching before the initial read to avoid missing changes
+		// happening in between. Without a watch, the files are read only once.
+		watcher, err := newWatcher(cache.passwdPath, cache.groupPath)
 		if err != nil {
-			return fmt.Errorf("UserGroupCache: create watcher: %w", err)
+			log.Warnf("UserGroupCache: %v: changes to %q and %q won't be taken into account",
+				err, cache.passwdPath, cache.groupPath)
 		}
 		defer func() {
 			// Only close the watcher if we are not going to use it
@@ -81,40 +389,76 @@ func (cache *userGroupCache) Start() error {
 			}
 		}()
 
-		err = watcher.Add(filepath.Join(host.HostRoot, baseDirPath))
-		if err != nil {
-			return fmt.Errorf("UserGroupCache: add watch: %w", err)
-		}
-
 		cache.userCache = cachedmap.NewCachedMap[uint32, string](2 * time.Second)
 		cache.groupCache = cachedmap.NewCachedMap[uint32, string](2 * time.Second)
 
+		cache.nssUsers, cache.nssGroups = nil, nil
+		if cache.backend != BackendFiles && cache.nssCacheSize > 0 {
+			cache.nssUsers = newNSSCache(cache.nssCacheSize)
+			cache.nssGroups = newNSSCache(cache.nssCacheSize)
+		}
+		cache.lazyGroups = nil
+		if cache.lazyGroupLoading() && cache.nssCacheSize > 0 {
+			cache.lazyGroups = newNSSCache(cache.nssCacheSize)
+		}
+
 		// Initial read
 		cache.userCache.Clear()
 		cache.groupCache.Clear()
-		passwdFile, err := os.OpenFile(fullPasswdPath, os.O_RDONLY, 0)
+		passwdFile, err := os.OpenFile(cache.passwdPath, os.O_RDONLY, 0)
 		if err != nil {
-			return fmt.Errorf("UserGroupCache: open /etc/passwd in host file system: %w", err)
+			return fmt.Errorf("UserGroupCache: open %q: %w", cache.passwdPath, err)
 		}
 		defer passwdFile.Close()
-		updateEntries(passwdFile, cache.userCache)
+		cache.setIDsByName(cache.passwdPath, updateEntries(passwdFile, cache.userCache))
 
-		groupFile, err := os.OpenFile(fullGroupPath, os.O_RDONLY, 0)
+		groupFile, err := os.OpenFile(cache.groupPath, os.O_RDONLY, 0)
 		if err != nil {
-			return fmt.Errorf("UserGroupCache: open %q: %w", fullGroupPath, err)
+			return fmt.Errorf("UserGroupCache: open %q: %w", cache.groupPath, err)
 		}
 		defer groupFile.Close()
-		updateEntries(groupFile, cache.groupCache)
+		if !cache.lazyGroupLoading() {
+			groupEntries := updateEntries(groupFile, cache.groupCache)
+			cache.setIDsByName(cache.groupPath, groupEntries)
+			cache.setMemberships(groupEntries)
+		}
+
+		if watcher != nil {
+			cache.watcher = watcher
+			watcher = nil
+			cache.loopFinished = make(chan struct{})
+			go cache.watchUserGroupLoop()
+		}
 
-		cache.watcher = watcher
-		watcher = nil
-		cache.loopFinished = make(chan struct{})
-		go cache.watchUserGroupLoop()
+		if cache.refreshInterval > 0 {
+			cache.refreshStop = make(chan struct{})
+			cache.refreshFinished = make(chan struct{})
+			go cache.refreshLoop(cache.refreshInterval)
+		}
 	}
 	cache.useCount++
 	return nil
 }
 
+// newWatcher watches the directories containing the given files. Watching the
+// files themselves wouldn't work when they are replaced, e.g. by a rename.
+func newWatcher(paths ...string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create watcher: %w", err)
+	}
+
+	for _, path := range paths {
+		err = watcher.Add(filepath.Dir(path))
+		if err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("add watch: %w", err)
+		}
+	}
+
+	return watcher, nil
+}
+
 func (cache *userGroupCache) Close() {
 	if cache.watcher != nil {
 		err := cache.watcher.Close()
@@ -124,10 +468,16 @@ func (cache *userGroupCache) Close() {
 		// Wait until the loop is finished, should be fast
 		<-cache.loopFinished
 		cache.watcher = nil
+	}
 
-		cache.userCache.Close()
-		cache.groupCache.Close()
+	if cache.refreshStop != nil {
+		close(cache.refreshStop)
+		<-cache.refreshFinished
+		cache.refreshStop = nil
 	}
+
+	cache.userCache.Close()
+	cache.groupCache.Close()
 }
 
 func (cache *userGroupCache) Stop() {
@@ -165,6 +515,157 @@ func (cache *userGroupCache) watchUserGroupLoop() {
 	}
 }
 
+func (cache *userGroupCache) refreshLoop(interval time.Duration) {
+	defer close(cache.refreshFinished)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cache.refreshStop:
+			return
+		case <-ticker.C:
+			if err := cache.reload(); err != nil {
+				log.Warnf("UserGroupCache: %v", err)
+			}
+		}
+	}
+}
+
+// Reload re-reads the passwd and group files, for the environments where
+// neither the watcher nor the periodic refresh can be used, e.g. to take
+// users added by a provisioning tool into account. It fails if the cache
+// isn't in use or if a file can't be read, in which case the names of that
+// file are kept as is.
+func (cache *userGroupCache) Reload() error {
+	cache.useCountMutex.Lock()
+	defer cache.useCountMutex.Unlock()
+
+	if cache.useCount == 0 {
+		return errors.New("UserGroupCache: can't reload, the cache isn't in use")
+	}
+	if err := cache.reload(); err != nil {
+		return fmt.Errorf("UserGroupCache: %w", err)
+	}
+	return nil
+}
+
+func (cache *userGroupCache) reload() error {
+	errPasswd := cache.reloadFile(cache.passwdPath, cache.userCache)
+	if cache.lazyGroupLoading() {
+		cache.lazyGroups.clear()
+		return errPasswd
+	}
+	return errors.Join(errPasswd, cache.reloadFile(cache.groupPath, cache.groupCache))
+}
+
+// reloadFile reads the file at path and replaces the names it provides. The
+// file is fully parsed first, so the names of a file that can't be read are
+// kept as is.
+func (cache *userGroupCache) reloadFile(path string, resourceCache cachedmap.CachedMap[uint32, string]) error {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", path, err)
+	}
+	defer file.Close()
+
+	entries, err := parseEntries(file)
+	if err != nil {
+		return fmt.Errorf("read %q: %w", path, err)
+	}
+
+	cache.reloadMutex.Lock()
+	defer cache.reloadMutex.Unlock()
+	cache.metrics.Load().refresh(cache.kindOf(path))
+	applyEntries(entries, resourceCache)
+	cache.setIDsByName(path, entries)
+	if path == cache.groupPath {
+		cache.setMemberships(entries)
+	}
+	return nil
+}
+
+// setMemberships rebuilds the memberships from the entries of the group file,
+// whose fourth field is the comma-separated list of members.
+func (cache *userGroupCache) setMemberships(groupEntries []entry) {
+	memberships := make(map[string][]string)
+	for _, e := range groupEntries {
+		if len(e.fields) < 4 {
+			continue
+		}
+		for _, member := range memberList(e.fields[3]) {
+			memberships[member] = append(memberships[member], e.name)
+		}
+	}
+
+	cache.membershipsMutex.Lock()
+	defer cache.membershipsMutex.Unlock()
+	cache.memberships = memberships
+}
+
+// memberList splits the comma-separated member list of a group entry
+func memberList(field string) []string {
+	var members []string
+	for _, member := range strings.Split(field, ",") {
+		member = strings.TrimSpace(member)
+		if member != "" {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// gecosName returns the full name of a passwd entry, i.e. the first
+// comma-separated subfield of its fifth field, or an empty string if not set
+func gecosName(fields []string) string {
+	if len(fields) < 5 {
+		return ""
+	}
+	name, _, _ := strings.Cut(fields[4], ",")
+	return strings.TrimSpace(name)
+}
+
+// setIDsByName rebuilds the map of names to ids of the file at path from its
+// entries, as well as the full names for the passwd file. Only the first entry
+// of each name is kept.
+func (cache *userGroupCache) setIDsByName(path string, entries []entry) {
+	ids := make(map[string]uint32, len(entries))
+	for _, e := range entries {
+		if _, ok := ids[e.name]; !ok {
+			ids[e.name] = e.id
+		}
+	}
+
+	var fullNames map[uint32]string
+	if path != cache.groupPath {
+		fullNames = make(map[uint32]string)
+		for _, e := range entries {
+			if name := gecosName(e.fields); name != "" {
+				fullNames[e.id] = name
+			}
+		}
+	}
+
+	cache.idsByNameMutex.Lock()
+	defer cache.idsByNameMutex.Unlock()
+	if path == cache.groupPath {
+		cache.gidsByName = ids
+	} else {
+		cache.uidsByName = ids
+		cache.fullNames = fullNames
+	}
+}
+
+// fullName returns the full name of the given uid in the passwd file
+func (cache *userGroupCache) fullName(uid uint32) (string, bool) {
+	cache.idsByNameMutex.RLock()
+	defer cache.idsByNameMutex.RUnlock()
+
+	name, ok := cache.fullNames[uid]
+	return name, ok
+}
+
 func (cache *userGroupCache) handleEvent(event fsnotify.Event) {
 	// Filter out chmod events first, to keep string comparisons to a minimum
 	if event.Has(fsnotify.Chmod) {
@@ -173,11 +674,17 @@ func (cache *userGroupCache) handleEvent(event fsnotify.Event) {
 
 	targetFilePath := ""
 	var resourceCache cachedmap.CachedMap[uint32, string]
-	if event.Name == fullPasswdPath {
-		targetFilePath = fullPasswdPath
+	if event.Name == cache.passwdPath {
+		targetFilePath = cache.passwdPath
 		resourceCache = cache.userCache
-	} else if event.Name == fullGroupPath {
-		targetFilePath = fullGroupPath
+	} else if event.Name == cache.groupPath {
+		if cache.lazyGroupLoading() {
+			// Forget the names looked up in the previous version
+			cache.metrics.Load().refresh(kindGid)
+			cache.lazyGroups.clear()
+			return
+		}
+		targetFilePath = cache.groupPath
 		resourceCache = cache.groupCache
 	} else {
 		return
@@ -199,50 +706,373 @@ func (cache *userGroupCache) handleEvent(event fsnotify.Event) {
 		return
 	}
 
-	updateEntries(targetFile, resourceCache)
+	cache.reloadMutex.Lock()
+	defer cache.reloadMutex.Unlock()
+	cache.metrics.Load().refresh(cache.kindOf(targetFilePath))
+	entries := updateEntries(targetFile, resourceCache)
+	if entries == nil && targetFile != nil {
+		// Read error, the cache was left as is
+		return
+	}
+	cache.setIDsByName(targetFilePath, entries)
+	if targetFilePath == cache.groupPath {
+		cache.setMemberships(entries)
+	}
+}
+
+// entry is a line of the passwd or group file
+type entry struct {
+	id   uint32
+	name string
+	// fields contains all the colon-separated fields of the line
+	fields []string
+}
+
+// updateEntries replaces the content of resourceCache with the entries of
+// file and returns them. The whole file is parsed before the cache is
+// modified, so lookups never see a partially loaded file and a read error
+// leaves the cache as is and returns nil.
+func updateEntries(file *os.File, resourceCache cachedmap.CachedMap[uint32, string]) []entry {
+	var entries []entry
+	if file != nil {
+		var err error
+		entries, err = parseEntries(file)
+		if err != nil {
+			log.Warnf("UserGroupCache: read %q: %v", file.Name(), err)
+			return nil
+		}
+	}
+
+	applyEntries(entries, resourceCache)
+	return entries
 }
 
-func updateEntries(file *os.File, resourceCache cachedmap.CachedMap[uint32, string]) {
-	oldEntries := make(map[uint32]struct{})
+// applyEntries replaces the content of resourceCache with entries
+func applyEntries(entries []entry, resourceCache cachedmap.CachedMap[uint32, string]) {
+	ids := make(map[uint32]string, len(entries))
+	for _, e := range entries {
+		ids[e.id] = e.name
+	}
+
 	for _, id := range resourceCache.Keys() {
-		oldEntries[id] = struct{}{}
+		if _, ok := ids[id]; !ok {
+			resourceCache.Remove(id)
+		}
 	}
+	for id, name := range ids {
+		resourceCache.Add(id, name)
+	}
+}
 
-	if file != nil {
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimLeft(scanner.Text(), " \t")
-			if len(line) == 0 || line[0] == '#' {
-				continue
+func parseEntries(r io.Reader) ([]entry, error) {
+	entries := []entry{}
+
+	err := scanEntries(r, func(e entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// maxLineLength is the length above which a line is skipped instead of
+// being parsed. It matches the default limit of bufio.Scanner.
+const maxLineLength = bufio.MaxScanTokenSize
+
+var (
+	// errSkipLine is returned by parseEntry for lines that don't contain an
+	// entry but aren't malformed either, like blank lines and comments
+	errSkipLine = errors.New("no entry in line")
+
+	errLineTooLong = fmt.Errorf("line longer than %d bytes", maxLineLength)
+)
+
+// scanEntries calls fn for each valid entry read from r, until fn returns
+// false. Malformed lines are logged and skipped, so they don't prevent the
+// following entries from being read. Only read errors are returned.
+func scanEntries(r io.Reader, fn func(entry) bool) error {
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := readLine(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, errLineTooLong) {
+			log.Warnf("UserGroupCache: line %d: %v", lineNum, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		e, err := parseEntry(line)
+		if err != nil {
+			if !errors.Is(err, errSkipLine) {
+				log.Warnf("UserGroupCache: line %d: %v", lineNum, err)
 			}
-			split := strings.Split(line, ":")
-			// We are interested only in the first and third field
-			if len(split) < 3 {
-				continue
+			continue
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+}
+
+// readLine returns the next line of reader without its line ending. Lines
+// longer than maxLineLength are consumed and reported as errLineTooLong.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) && (len(line) > 0 || tooLong) {
+				break
 			}
-			name := split[0]
-			id_u64, err := strconv.ParseUint(split[2], 10, 32)
-			if err != nil {
-				log.Warnf("UserGroupCache: convert id: %v", err)
-				continue
+			return "", err
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(line) > maxLineLength {
+				line, tooLong = nil, true
 			}
-			id := uint32(id_u64)
-			delete(oldEntries, id)
-			resourceCache.Add(id, name)
 		}
+		if !isPrefix {
+			break
+		}
+	}
+	if tooLong {
+		return "", errLineTooLong
 	}
+	return string(line), nil
+}
 
-	for id := range oldEntries {
-		resourceCache.Remove(id)
+// parseEntry parses a line of a passwd or group file. Surrounding
+// whitespace is ignored, both around the line and around the name and id
+// fields, and any field after the third is kept as is without being
+// checked.
+func parseEntry(line string) (entry, error) {
+	line = strings.TrimSpace(line)
+	// NIS compat entries (+name, -name, +@netgroup) don't map a name to an
+	// id by themselves
+	if len(line) == 0 || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+		return entry{}, errSkipLine
+	}
+	split := strings.Split(line, ":")
+	// We are interested only in the first and third field
+	if len(split) < 3 {
+		return entry{}, fmt.Errorf("expected at least 3 fields, got %d", len(split))
+	}
+	name := strings.TrimSpace(split[0])
+	if name == "" {
+		return entry{}, errors.New("empty name")
+	}
+	if strings.ContainsFunc(name, unicode.IsSpace) {
+		return entry{}, fmt.Errorf("name %q contains whitespace", name)
+	}
+	id_u64, err := strconv.ParseUint(strings.TrimSpace(split[2]), 10, 32)
+	if err != nil {
+		return entry{}, fmt.Errorf("convert id of %q: %w", name, err)
 	}
+	split[0] = name
+	return entry{id: uint32(id_u64), name: name, fields: split}, nil
 }
 
-func (cache *userGroupCache) GetUsername(uid uint32) string {
-	name, _ := cache.userCache.Get(uid)
+// scanGroupFile calls fn for each entry of the group file until fn returns
+// false. It's used in lazy group loading mode.
+func (cache *userGroupCache) scanGroupFile(fn func(entry) bool) {
+	groupFile, err := os.Open(cache.groupPath)
+	if err != nil {
+		log.Warnf("UserGroupCache: open %q: %v", cache.groupPath, err)
+		return
+	}
+	defer groupFile.Close()
+
+	if err := scanEntries(groupFile, fn); err != nil {
+		log.Warnf("UserGroupCache: read %q: %v", cache.groupPath, err)
+	}
+}
+
+// lookupGroupFile returns the name of the first entry with the given gid in
+// the group file
+func (cache *userGroupCache) lookupGroupFile(gid uint32) (name string, found bool) {
+	cache.scanGroupFile(func(e entry) bool {
+		if e.id == gid {
+			name, found = e.name, true
+		}
+		return !found
+	})
+	return name, found
+}
+
+func (cache *userGroupCache) GetUsername(uid uint32, fallbackToID bool) string {
+	if name, ok := cache.staticName(uid); ok {
+		return name
+	}
+
+	var name string
+	ok := false
+	if cache.backend != BackendNSS {
+		name, ok = cache.userCache.Get(uid)
+		cache.metrics.Load().lookup(kindUid, ok)
+		if ok && cache.nameSource == NameSourceGecos {
+			if fullName, found := cache.fullName(uid); found {
+				name = fullName
+			}
+		}
+	}
+	if !ok && cache.backend != BackendFiles {
+		name, ok = cache.nssUsers.resolve(uid, lookupUserNSS)
+	}
+	if !ok && fallbackToID {
+		return strconv.FormatUint(uint64(uid), 10)
+	}
 	return name
 }
 
-func (cache *userGroupCache) GetGroupname(gid uint32) string {
-	name, _ := cache.groupCache.Get(gid)
+func (cache *userGroupCache) GetGroupname(gid uint32, fallbackToID bool) string {
+	if name, ok := cache.staticName(gid); ok {
+		return name
+	}
+
+	var name string
+	ok := false
+	if cache.backend != BackendNSS {
+		if cache.lazyGroupLoading() {
+			name, ok = cache.lazyGroups.resolve(gid, cache.lookupGroupFile)
+		} else {
+			name, ok = cache.groupCache.Get(gid)
+		}
+		cache.metrics.Load().lookup(kindGid, ok)
+	}
+	if !ok && cache.backend != BackendFiles {
+		name, ok = cache.nssGroups.resolve(gid, lookupGroupNSS)
+	}
+	if !ok && fallbackToID {
+		return strconv.FormatUint(uint64(gid), 10)
+	}
 	return name
 }
+
+func (cache *userGroupCache) GetGroupsForUser(uid uint32) []string {
+	username, ok := cache.userCache.Get(uid)
+	if !ok {
+		return nil
+	}
+
+	if cache.lazyGroupLoading() {
+		var groups []string
+		cache.scanGroupFile(func(e entry) bool {
+			if len(e.fields) >= 4 && slices.Contains(memberList(e.fields[3]), username) {
+				groups = append(groups, e.name)
+			}
+			return true
+		})
+		return groups
+	}
+
+	cache.membershipsMutex.RLock()
+	defer cache.membershipsMutex.RUnlock()
+
+	groups := cache.memberships[username]
+	if len(groups) == 0 {
+		return nil
+	}
+	return append([]string(nil), groups...)
+}
+
+// Dump returns the names of the ids of the files, of the ids resolved through
+// the name service switch that are cached and of the static mappings, with the
+// same precedence as GetUsername and GetGroupname. The ids resolved through
+// the name service switch without a cache, or looked up in the group file
+// without a cache in lazy mode, are unknown.
+func (cache *userGroupCache) Dump() (map[uint32]string, map[uint32]string) {
+	users := make(map[uint32]string)
+	groups := make(map[uint32]string)
+
+	if cache.backend != BackendFiles {
+		cache.nssUsers.copyTo(users)
+		cache.nssGroups.copyTo(groups)
+	}
+
+	if cache.backend != BackendNSS {
+		if cache.userCache != nil {
+			for _, uid := range cache.userCache.Keys() {
+				if name, ok := cache.userCache.Get(uid); ok {
+					users[uid] = name
+				}
+			}
+		}
+		if cache.nameSource == NameSourceGecos {
+			cache.idsByNameMutex.RLock()
+			for uid, name := range cache.fullNames {
+				if _, ok := users[uid]; ok {
+					users[uid] = name
+				}
+			}
+			cache.idsByNameMutex.RUnlock()
+		}
+
+		if cache.lazyGroupLoading() {
+			cache.lazyGroups.copyTo(groups)
+		} else if cache.groupCache != nil {
+			for _, gid := range cache.groupCache.Keys() {
+				if name, ok := cache.groupCache.Get(gid); ok {
+					groups[gid] = name
+				}
+			}
+		}
+	}
+
+	cache.staticMappingsMutex.RLock()
+	for id, name := range cache.staticMappings {
+		users[id] = name
+		groups[id] = name
+	}
+	cache.staticMappingsMutex.RUnlock()
+
+	return users, groups
+}
+
+// LogDump logs the content of the cache returned by Dump, sorted by id
+func (cache *userGroupCache) LogDump() {
+	users, groups := cache.Dump()
+	for _, kind := range []struct {
+		name  string
+		names map[uint32]string
+	}{{"uid", users}, {"gid", groups}} {
+		ids := slices.Sorted(maps.Keys(kind.names))
+		log.Infof("UserGroupCache: %d %ss known", len(ids), kind.name)
+		for _, id := range ids {
+			log.Infof("UserGroupCache: %s %d: %q", kind.name, id, kind.names[id])
+		}
+	}
+}
+
+func (cache *userGroupCache) GetUidByName(name string) (uint32, bool) {
+	cache.idsByNameMutex.RLock()
+	defer cache.idsByNameMutex.RUnlock()
+
+	uid, ok := cache.uidsByName[name]
+	return uid, ok
+}
+
+func (cache *userGroupCache) GetGidByName(name string) (gid uint32, found bool) {
+	if cache.lazyGroupLoading() {
+		cache.scanGroupFile(func(e entry) bool {
+			if e.name == name {
+				gid, found = e.id, true
+			}
+			return !found
+		})
+		return gid, found
+	}
+
+	cache.idsByNameMutex.RLock()
+	defer cache.idsByNameMutex.RUnlock()
+
+	gid, found = cache.gidsByName[name]
+	return gid, found
+}
@@ -284,6 +284,14 @@ func (c *CommonData) GetContainerImageName() string {
 	return c.Runtime.ContainerImageName
 }
 
+func (c *CommonData) GetContainerID() string {
+	return c.Runtime.ContainerID
+}
+
+func (c *CommonData) GetContainerPid() uint32 {
+	return c.Runtime.ContainerPID
+}
+
 type L3Endpoint struct {
 	// Addr is filled by the gadget
 	Addr    string `json:"addr,omitempty" column:"addr,hide,template:ipaddr"`
@@ -42,6 +42,12 @@ import (
 // https://github.com/torvalds/linux/commit/fddb5d430ad9fa91b49b1d34d0202ffe2fa0e179
 func OpenInContainer(containerPid uint32, unsafePath string) (*os.File, error) {
 	root := filepath.Join(host.HostProcFs, fmt.Sprint(containerPid), "root")
+	return OpenInRoot(root, unsafePath)
+}
+
+// OpenInRoot is like OpenInContainer, for a root filesystem given by its path,
+// e.g. the rootfs of a container known by the runtime.
+func OpenInRoot(root string, unsafePath string) (*os.File, error) {
 	rootDir, err := os.OpenFile(root, unix.O_PATH, 0)
 	if err != nil {
 		return nil, fmt.Errorf("open o_path %q: %w", root, err)